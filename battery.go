@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// バッテリー監視の既定値（%）
+const (
+	defaultBatteryMinTakeOff = 20 // これ未満では離陸させない
+	defaultBatteryCritical   = 10 // 飛行中にこれ以下になったら自動着陸する
+)
+
+// defaultBatteryWarnings は警告を出す残量（%）の既定値
+var defaultBatteryWarnings = []int{50, 30, 20}
+
+// BatteryStatus はバッテリー監視の状態
+type BatteryStatus struct {
+	Known          bool // フライトデータで残量を受信したか
+	Percent        int
+	Warning        int  // 下回った最も低い警告の残量（下回っていなければ0）
+	TakeOffAllowed bool // 離陸できるか（残量が不明なら許可し、自動着陸の後は許可しない）
+	ForcedLanding  bool // 残量が危険な値になり、自動着陸中（または着陸済み）
+}
+
+// batterySupervisor はテレメトリーのバッテリー残量を監視する
+type batterySupervisor struct {
+	mu         sync.Mutex
+	warnings   []int // 警告を出す残量（降順）
+	minTakeOff int
+	critical   int
+	warned     int // 通知済みの最も低い警告の残量（未通知なら0）
+	forced     bool
+
+	// 監視ループ
+	running bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// SetBatteryThresholds はバッテリー監視の警告・離陸下限・自動着陸の残量（%）を設定する
+func (dc *DroneController) SetBatteryThresholds(warnings []int, minTakeOff, critical int) {
+	dc.battery.mu.Lock()
+	defer dc.battery.mu.Unlock()
+
+	dc.battery.warnings = append([]int(nil), warnings...)
+	sort.Sort(sort.Reverse(sort.IntSlice(dc.battery.warnings)))
+	dc.battery.minTakeOff = minTakeOff
+	dc.battery.critical = critical
+}
+
+// BatteryStatus はバッテリー監視の状態を返す
+func (dc *DroneController) BatteryStatus() BatteryStatus {
+	s := dc.telemetry.Snapshot()
+
+	dc.battery.mu.Lock()
+	defer dc.battery.mu.Unlock()
+
+	status := BatteryStatus{
+		Known:          s.HasFlightData,
+		Percent:        s.BatteryPercent,
+		Warning:        dc.battery.warned,
+		TakeOffAllowed: !dc.battery.forced && (!s.HasFlightData || s.BatteryPercent >= dc.battery.minTakeOff),
+		ForcedLanding:  dc.battery.forced,
+	}
+	return status
+}
+
+// takeOffBlocked は残量不足で離陸させない場合にその理由を返す（離陸できれば空文字）
+func (dc *DroneController) takeOffBlocked() string {
+	status := dc.BatteryStatus()
+	if status.TakeOffAllowed {
+		return ""
+	}
+	dc.battery.mu.Lock()
+	minTakeOff := dc.battery.minTakeOff
+	dc.battery.mu.Unlock()
+	return fmt.Sprintf("バッテリー残量 %d%% のため離陸できません（%d%% 以上が必要）", status.Percent, minTakeOff)
+}
+
+// isForcedLanding は自動着陸中かどうかを返す
+func (dc *DroneController) isForcedLanding() bool {
+	dc.battery.mu.Lock()
+	defer dc.battery.mu.Unlock()
+	return dc.battery.forced
+}
+
+// checkBattery はテレメトリーの残量を調べ、警告や自動着陸を行う
+func (dc *DroneController) checkBattery(s TelemetrySnapshot) {
+	if !s.HasFlightData {
+		return
+	}
+	percent := s.BatteryPercent
+
+	dc.battery.mu.Lock()
+	// 新しく下回った警告のうち、最も低いものだけ通知する
+	warning := 0
+	for _, threshold := range dc.battery.warnings {
+		if percent <= threshold && (dc.battery.warned == 0 || threshold < dc.battery.warned) {
+			warning = threshold
+		}
+	}
+	if warning > 0 {
+		dc.battery.warned = warning
+	}
+	critical := percent <= dc.battery.critical
+	startForced := critical && !dc.battery.forced
+	if critical {
+		dc.battery.forced = true
+	} else if dc.battery.forced && percent >= dc.battery.minTakeOff {
+		// 電池を交換するなどして十分な残量に戻ったら解除する
+		dc.battery.forced = false
+		dc.battery.warned = 0
+	}
+	dc.battery.mu.Unlock()
+
+	if warning > 0 && !critical {
+		dc.notify("バッテリー残量が %d%% になりました（警告: %d%% 以下）", percent, warning)
+	}
+	if !critical {
+		return
+	}
+
+	// 自動着陸中はキー操作を受け付けない
+	// 着陸コマンドの後も飛行中と報告され続けると着陸中から戻るので、着陸を指示し直す
+	if startForced {
+		dc.notify("バッテリー残量が %d%% です。自動着陸します（キー操作は無効になります）", percent)
+	}
+	if dc.IsFlying() {
+		dc.Land()
+	}
+}
+
+// StartBatterySupervisor はテレメトリーを購読してバッテリー残量を監視するループを開始する
+func (dc *DroneController) StartBatterySupervisor() {
+	dc.battery.mu.Lock()
+	defer dc.battery.mu.Unlock()
+
+	if dc.battery.running {
+		return
+	}
+	dc.battery.running = true
+	dc.battery.stop = make(chan struct{})
+	dc.battery.done = make(chan struct{})
+
+	updates := dc.telemetry.Subscribe()
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		defer dc.telemetry.Unsubscribe(updates)
+
+		for {
+			select {
+			case <-stop:
+				return
+			case s := <-updates:
+				dc.checkBattery(s)
+			}
+		}
+	}(dc.battery.stop, dc.battery.done)
+}
+
+// StopBatterySupervisor はバッテリー監視ループを停止する（複数回呼んでも安全）
+func (dc *DroneController) StopBatterySupervisor() {
+	dc.battery.mu.Lock()
+	if !dc.battery.running {
+		dc.battery.mu.Unlock()
+		return
+	}
+	dc.battery.running = false
+	close(dc.battery.stop)
+	done := dc.battery.done
+	dc.battery.mu.Unlock()
+
+	<-done
+}
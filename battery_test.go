@@ -0,0 +1,134 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gobot.io/x/gobot/platforms/dji/tello"
+)
+
+// batterySnapshot は指定した残量のテレメトリーを返します
+func batterySnapshot(percent int) TelemetrySnapshot {
+	return TelemetrySnapshot{HasFlightData: true, BatteryPercent: percent}
+}
+
+// eventMessages はイベントログのメッセージをすべて返します
+func eventMessages(events *EventLog) []string {
+	var messages []string
+	for _, entry := range events.Entries(-1) {
+		messages = append(messages, entry.Message)
+	}
+	return messages
+}
+
+// TestBatteryBlocksTakeOff 残量が離陸の下限未満なら離陸しないことを確認します
+func TestBatteryBlocksTakeOff(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := newGroundedController(fake)
+	events := NewEventLog(20)
+	droneController.SetEventLog(events)
+
+	droneController.Telemetry().updateFlightData(&tello.FlightData{OnGround: true, BatteryPercentage: 15})
+	droneController.TakeOff()
+	if got := fake.Commands(); len(got) != 0 {
+		t.Errorf("残量不足では離陸コマンドを送信すべきでない: %v", got)
+	}
+	if droneController.IsFlying() {
+		t.Error("残量不足では飛行状態になるべきでない")
+	}
+	if status := droneController.BatteryStatus(); status.TakeOffAllowed {
+		t.Errorf("離陸不可と報告すべき: %+v", status)
+	}
+	if messages := eventMessages(events); len(messages) != 1 || !strings.Contains(messages[0], "離陸できません") {
+		t.Errorf("離陸できない理由を通知すべき: %v", messages)
+	}
+
+	droneController.Telemetry().updateFlightData(&tello.FlightData{OnGround: true, BatteryPercentage: 20})
+	droneController.TakeOff()
+	if got := fake.Commands(); !reflect.DeepEqual(got, []string{"TakeOff"}) {
+		t.Errorf("下限以上なら離陸すべき: %v", got)
+	}
+}
+
+// TestBatteryWarningsAndForcedLanding 警告を1回ずつ通知し、危険な残量で自動着陸することを確認します
+func TestBatteryWarningsAndForcedLanding(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := newGroundedController(fake)
+	events := NewEventLog(50)
+	droneController.SetEventLog(events)
+	clock := time.Now()
+	droneController.now = func() time.Time { return clock }
+
+	droneController.TakeOff()
+	droneController.MoveUp()
+	fake.Reset()
+
+	for _, percent := range []int{60, 50, 49, 35, 25, 25, 19, 15} {
+		droneController.checkBattery(batterySnapshot(percent))
+	}
+	var warnings []string
+	for _, message := range eventMessages(events) {
+		if strings.Contains(message, "警告") {
+			warnings = append(warnings, message)
+		}
+	}
+	if len(warnings) != 3 || !strings.Contains(warnings[2], "20% 以下") {
+		t.Errorf("50%%・30%%・20%% で1回ずつ警告すべき: %v", warnings)
+	}
+	if status := droneController.BatteryStatus(); status.Warning != 20 || status.ForcedLanding {
+		t.Errorf("警告の状態が不正: %+v", status)
+	}
+	if got := fake.Commands(); len(got) != 0 {
+		t.Errorf("警告だけではコマンドを送信すべきでない: %v", got)
+	}
+
+	// 危険な残量では着陸し、キー操作を受け付けない
+	droneController.checkBattery(batterySnapshot(10))
+	droneController.MoveForward()
+	droneController.TakeOffOrLand()
+	if got := fake.Commands(); !reflect.DeepEqual(got, []string{"Hover", "Land"}) {
+		t.Errorf("自動着陸のコマンドが不正: %v", got)
+	}
+	if status := droneController.BatteryStatus(); !status.ForcedLanding || status.TakeOffAllowed {
+		t.Errorf("自動着陸中と報告すべき: %+v", status)
+	}
+
+	// 猶予時間を過ぎても飛行中と報告されるなら、着陸を指示し直す
+	fake.Reset()
+	droneController.checkBattery(batterySnapshot(9))
+	clock = clock.Add(flightStateGrace)
+	droneController.reconcileFlying(&tello.FlightData{Flying: true})
+	droneController.checkBattery(batterySnapshot(9))
+	if got := fake.Commands(); !reflect.DeepEqual(got, []string{"Land"}) {
+		t.Errorf("着陸の再指示が不正: %v", got)
+	}
+
+	// 十分な残量に戻れば解除される
+	droneController.checkBattery(batterySnapshot(95))
+	if status := droneController.BatteryStatus(); status.ForcedLanding || status.Warning != 0 {
+		t.Errorf("残量が戻れば自動着陸を解除すべき: %+v", status)
+	}
+}
+
+// TestBatterySupervisorLoop 監視ループがテレメトリーを受けて自動着陸することを確認します
+func TestBatterySupervisorLoop(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := newGroundedController(fake)
+	droneController.TakeOff()
+
+	droneController.StartBatterySupervisor()
+	defer droneController.StopBatterySupervisor()
+
+	fake.Publish(tello.FlightDataEvent, &tello.FlightData{Flying: true, BatteryPercentage: 5})
+	waitUntil(t, "自動着陸", func() bool {
+		commands := fake.Commands()
+		return commands[len(commands)-1] == "Land" && !droneController.IsFlying()
+	})
+
+	lines := NewDashboard(droneController, nil, nil, nil).statusLines()
+	if !strings.Contains(lines[0].text, "自動着陸") {
+		t.Errorf("ダッシュボードに自動着陸を表示すべき: %q", lines[0].text)
+	}
+}
@@ -4,10 +4,15 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"GobotProject/h264"
+	"GobotProject/simulator"
+
 	"gobot.io/x/gobot/platforms/dji/tello"
 )
 
@@ -84,6 +89,46 @@ func TestCameraViewerToggleRecording(t *testing.T) {
 	}
 }
 
+// TestCameraViewerToggleRecordingConcurrent 同時に切り替えても、押した回数どおりに録画状態が変わることを確認します
+func TestCameraViewerToggleRecordingConcurrent(t *testing.T) {
+	drone := tello.NewDriver("8890")
+	cameraViewer := NewCameraViewer(drone)
+
+	// ダッシュボードのように録画状態を読み続ける
+	stop := make(chan struct{})
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				cameraViewer.IsRecording()
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-polled
+	}()
+
+	for range 10 {
+		var wg sync.WaitGroup
+		for range 2 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				cameraViewer.ToggleRecording()
+			}()
+		}
+		wg.Wait()
+		if cameraViewer.IsRecording() {
+			t.Fatal("2回切り替えたら録画は止まっているべき")
+		}
+	}
+}
+
 // TestCameraViewerRecordingFormat 録画形式テスト
 func TestCameraViewerRecordingFormat(t *testing.T) {
 	drone := tello.NewDriver("8890")
@@ -398,9 +443,9 @@ func TestMP4RecordingScenario_ErrorRecovery(t *testing.T) {
 
 	// エラー状況のシミュレーション（無効なフレームデータなど）
 	t.Log("エラー状況のシミュレーション")
-	cameraViewer.processFrame(nil)           // nilデータ
-	cameraViewer.processFrame([]byte{})      // 空データ
-	cameraViewer.processFrame([]byte("ok"))  // 正常データ
+	cameraViewer.processFrame(nil)          // nilデータ
+	cameraViewer.processFrame([]byte{})     // 空データ
+	cameraViewer.processFrame([]byte("ok")) // 正常データ
 
 	// 回復確認
 	if !cameraViewer.IsRecording() {
@@ -432,3 +477,116 @@ func getTestRecordingFiles(t *testing.T) []string {
 
 	return files
 }
+
+// TestCameraViewerRecordingStartsOnKeyframe 録画ファイルがSPS/PPS付きのキーフレームから始まることをテストします
+func TestCameraViewerRecordingStartsOnKeyframe(t *testing.T) {
+	fake := NewFakeDrone()
+	cameraViewer := NewCameraViewer(fake)
+	events := NewEventLog(10)
+	cameraViewer.SetEventLog(events)
+	cameraViewer.isRunning = true
+
+	gop := simulator.SyntheticStream(960, 720, 30, 10)
+	// TelloのIDRにはSPS/PPSが付いていないことがある
+	idrOnly := appendAnnexB(nil, h264.SplitAnnexB(gop[0])[2])
+	feed := func(units ...[]byte) {
+		for _, unit := range units {
+			cameraViewer.processFrame(unit)
+		}
+	}
+
+	feed(gop...) // 録画前に受信したSPS/PPSを覚えておく
+	cameraViewer.StartRecording()
+	filename := cameraViewer.GetCurrentRecordingFile()
+	defer os.Remove(filename)
+	if !cameraViewer.WaitingForKeyframe() {
+		t.Error("録画開始直後はキーフレームを待つべき")
+	}
+	if commands := fake.Commands(); commands[len(commands)-1] != "StartVideo" {
+		t.Errorf("録画開始時にキーフレームを要求すべき: %v", commands)
+	}
+
+	feed(gop[1:5]...) // GOPの途中（捨てられる）
+	feed(idrOnly)
+	feed(gop[1:]...)
+	feed(idrOnly, gop[1]) // 受信側は1NAL遅れて区切るので、直前のフレームまでを完成させる
+	if cameraViewer.WaitingForKeyframe() {
+		t.Error("キーフレームを受信したら録画を始めるべき")
+	}
+	cameraViewer.StopRecording()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stbl := []string{"moov", "trak", "mdia", "minf", "stbl"}
+	if sizes := fullBoxUint32s(findBox(t, data, append(stbl, "stsz")...)); sizes[1] != 10 {
+		t.Errorf("サンプル数: 期待 10, 実際 %d", sizes[1])
+	}
+	if stss := fullBoxUint32s(findBox(t, data, append(stbl, "stss")...)); !reflect.DeepEqual(stss, []uint32{1, 1}) {
+		t.Errorf("最初のサンプルがキーフレームであるべき: %v", stss)
+	}
+	// 最初のサンプルはSPS・PPS・IDRの順
+	offset := fullBoxUint32s(findBox(t, data, append(stbl, "stco")...))[1]
+	var types []h264.NALType
+	for _, nal := range lengthPrefixedNALs(data[offset : offset+fullBoxUint32s(findBox(t, data, append(stbl, "stsz")...))[2]]) {
+		types = append(types, h264.TypeOf(nal))
+	}
+	if !reflect.DeepEqual(types, []h264.NALType{h264.NALSPS, h264.NALPPS, h264.NALIDR}) {
+		t.Errorf("最初のサンプルのNAL: %v", types)
+	}
+
+	found := false
+	for _, entry := range events.Entries(-1) {
+		found = found || strings.Contains(entry.Message, "最初のキーフレームまで")
+	}
+	if !found {
+		t.Errorf("開始までの時間が通知されていません: %v", events.Entries(-1))
+	}
+}
+
+// TestCameraViewerPreRecord 録画開始前の映像がGOPの先頭から録画されることをテストします
+func TestCameraViewerPreRecord(t *testing.T) {
+	fake := NewFakeDrone()
+	cameraViewer := NewCameraViewer(fake)
+	cameraViewer.isRunning = true
+	cameraViewer.SetPreRecord(5*time.Second, 1<<20)
+
+	// GOPの途中から受信を始める
+	packets, _ := telloVideoPackets(10, 25)
+	for _, packet := range packets[1:] {
+		cameraViewer.processFrame(packet)
+	}
+	if status := cameraViewer.PreRecordStatus(); !status.Enabled() || status.Bytes == 0 {
+		t.Fatalf("受信した映像を保持していません: %+v", status)
+	}
+
+	cameraViewer.StartRecording()
+	filename := cameraViewer.GetCurrentRecordingFile()
+	defer os.Remove(filename)
+	if cameraViewer.WaitingForKeyframe() {
+		t.Error("先行録画があればキーフレームを待たずに録画すべき")
+	}
+	for _, command := range fake.Commands() {
+		if command == "StartVideo" {
+			t.Error("先行録画があればキーフレームを要求しない")
+		}
+	}
+	if status := cameraViewer.PreRecordStatus(); status.Bytes != 0 {
+		t.Errorf("録画開始時にバッファを書き出すべき: %+v", status)
+	}
+	cameraViewer.StopRecording()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stbl := []string{"moov", "trak", "mdia", "minf", "stbl"}
+	// 2つ目のGOPの先頭から（最後の2フレームはまだ区切られていない）
+	if sizes := fullBoxUint32s(findBox(t, data, append(stbl, "stsz")...)); sizes[1] != 13 {
+		t.Errorf("サンプル数: 期待 13, 実際 %d", sizes[1])
+	}
+	if stss := fullBoxUint32s(findBox(t, data, append(stbl, "stss")...)); !reflect.DeepEqual(stss, []uint32{2, 1, 11}) {
+		t.Errorf("キーフレーム: %v", stss)
+	}
+}
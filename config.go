@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// defaultConfigFile は既定の設定ファイル名
+const defaultConfigFile = "tello_config.json"
+
+// Config は設定ファイル（JSON）の内容
+type Config struct {
+	// KeyBindings は操作名ごとのキー指定（指定した操作だけ既定値を上書きする）
+	// 既定のキーと重なる場合は、そのキーを使っている操作にも別のキーを指定する
+	// 例（AZERTY配列）: {"forward": ["Z"], "left": ["Q"], "down": ["W"], "rotate_ccw": ["A"]}
+	KeyBindings map[Action][]string `json:"key_bindings,omitempty"`
+
+	// HoldTimeoutMS はキー入力が途絶えてから移動を止めるまでの時間（ミリ秒）
+	HoldTimeoutMS int `json:"hold_timeout_ms,omitempty"`
+
+	// Speed は移動・旋回の速度レベル（10〜100、実行中に変更すると保存される）
+	Speed int `json:"speed,omitempty"`
+	// FastMode はドライバーの高速モードを使うか（実行中に変更すると保存される）
+	FastMode bool `json:"fast_mode"`
+
+	// Recording は録画ファイルの設定
+	Recording RecordingConfig `json:"recording"`
+
+	// Battery はバッテリー残量の監視の設定
+	Battery BatteryConfig `json:"battery"`
+
+	// Link はドローンとの通信途絶の監視の設定
+	Link LinkConfig `json:"link"`
+
+	// Geofence は高度と飛行時間の制限（いずれも0なら制限しない）
+	Geofence GeofenceConfig `json:"geofence"`
+
+	// Photo は写真撮影の設定
+	Photo PhotoConfig `json:"photo"`
+}
+
+// RecordingConfig は録画ファイルの設定
+type RecordingConfig struct {
+	// Format は録画形式（MOV, MP4, H264, TS）
+	Format string `json:"format"`
+
+	// Fragmented はフラグメント形式で録画するか
+	// 一定間隔でmoof/mdatを書き込むので、電池切れや強制終了でも書き込み済みの部分は再生できる
+	Fragmented bool `json:"fragmented"`
+	// FragmentSeconds はフラグメント形式で書き込む間隔（秒）
+	FragmentSeconds int `json:"fragment_seconds,omitempty"`
+
+	// PreRecordSeconds は録画開始前にさかのぼって録画する秒数（0なら先行録画しない）
+	// 録画していない間も直近の映像をGOP単位でメモリに保持する
+	PreRecordSeconds int `json:"pre_record_seconds"`
+	// PreRecordMaxMB は先行録画に使うメモリの上限（MB）
+	PreRecordMaxMB int `json:"pre_record_max_mb,omitempty"`
+}
+
+// BatteryConfig はバッテリー残量の監視の設定（いずれも残量%）
+type BatteryConfig struct {
+	// WarnPercent は警告をイベントログに出す残量（それぞれ下回ったときに1回だけ）
+	WarnPercent []int `json:"warn_percent"`
+	// MinTakeOffPercent はこれ未満では離陸させない残量
+	MinTakeOffPercent int `json:"min_takeoff_percent"`
+	// CriticalPercent は飛行中にこれ以下になったら自動着陸する残量（キー操作より優先）
+	CriticalPercent int `json:"critical_percent"`
+}
+
+// LinkConfig はドローンとの通信途絶の監視の設定
+type LinkConfig struct {
+	// TimeoutMS はドローンからの受信がこれだけ途絶えたら通信途絶とみなす時間（ミリ秒）
+	TimeoutMS int `json:"timeout_ms,omitempty"`
+	// LandAfterOutageSeconds はこれ以上途絶えてから回復したとき、飛行中なら着陸させる秒数（0なら着陸させない）
+	LandAfterOutageSeconds int `json:"land_after_outage_seconds"`
+}
+
+// GeofenceConfig は高度と飛行時間の制限
+type GeofenceConfig struct {
+	// CeilingM は天井の高さ（m）。これ以上は上昇できず、大きく超えたら降下させる
+	CeilingM float64 `json:"ceiling_m"`
+	// MinLateralHeightM は前後左右に移動できる最低高度（m）
+	MinLateralHeightM float64 `json:"min_lateral_height_m"`
+	// MaxFlightMinutes は最大飛行時間（分）。超えたら戻って着陸するよう促す
+	MaxFlightMinutes float64 `json:"max_flight_minutes"`
+}
+
+// PhotoConfig は写真撮影の設定
+type PhotoConfig struct {
+	// Relay はドライバーと機体の間で制御パケットを中継し、写真撮影を有効にするか（既定は無効）
+	// 中継は撮影の指示と写真の転送だけを扱うが、有効にすると操縦のコマンドもすべて中継を通る
+	Relay bool `json:"relay"`
+}
+
+// defaultFragmentSeconds はフラグメントの既定の間隔（秒）
+const defaultFragmentSeconds = 2
+
+// DefaultConfig は既定の設定を返す
+func DefaultConfig() *Config {
+	return &Config{
+		KeyBindings:   DefaultKeyBindingConfig(),
+		HoldTimeoutMS: int(defaultHoldTimeout / time.Millisecond),
+		Speed:         defaultSpeed,
+		Recording: RecordingConfig{
+			Format:           string(FormatMOV),
+			FragmentSeconds:  defaultFragmentSeconds,
+			PreRecordSeconds: defaultPreRecordSeconds,
+			PreRecordMaxMB:   defaultPreRecordMaxMB,
+		},
+		Battery: BatteryConfig{
+			WarnPercent:       append([]int(nil), defaultBatteryWarnings...),
+			MinTakeOffPercent: defaultBatteryMinTakeOff,
+			CriticalPercent:   defaultBatteryCritical,
+		},
+		Link: LinkConfig{
+			TimeoutMS: int(defaultLinkTimeout / time.Millisecond),
+		},
+	}
+}
+
+// LoadConfig は設定ファイルを読み込み、既定値に重ねた設定を返す
+// ファイルが存在しない場合は既定の設定を返す
+func LoadConfig(path string) (*Config, error) {
+	config := DefaultConfig()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("設定ファイルを読み込めません: %w", err)
+	}
+
+	// 既定値の上に読み込むので、書かれていない項目・操作は既定値のまま残る
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("設定ファイル %s の形式が不正です: %w", path, err)
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("設定ファイル %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// validate は設定値を検証する
+func (c *Config) validate() error {
+	if _, err := c.Bindings(); err != nil {
+		return err
+	}
+	if c.HoldTimeoutMS <= 0 {
+		return fmt.Errorf("hold_timeout_ms は正の値にしてください: %d", c.HoldTimeoutMS)
+	}
+	if c.Speed < minSpeed || c.Speed > maxSpeed {
+		return fmt.Errorf("speed は %d〜%d にしてください: %d", minSpeed, maxSpeed, c.Speed)
+	}
+	if _, err := ParseRecordingFormat(c.Recording.Format); err != nil {
+		return fmt.Errorf("recording.format: %w", err)
+	}
+	if c.Recording.FragmentSeconds <= 0 {
+		return fmt.Errorf("recording.fragment_seconds は正の値にしてください: %d", c.Recording.FragmentSeconds)
+	}
+	if c.Recording.PreRecordSeconds < 0 {
+		return fmt.Errorf("recording.pre_record_seconds は0以上にしてください: %d", c.Recording.PreRecordSeconds)
+	}
+	if c.Recording.PreRecordMaxMB <= 0 {
+		return fmt.Errorf("recording.pre_record_max_mb は正の値にしてください: %d", c.Recording.PreRecordMaxMB)
+	}
+	for _, percent := range c.Battery.WarnPercent {
+		if percent <= 0 || percent > 100 {
+			return fmt.Errorf("battery.warn_percent は1〜100にしてください: %d", percent)
+		}
+	}
+	if c.Battery.CriticalPercent < 0 || c.Battery.CriticalPercent > 100 {
+		return fmt.Errorf("battery.critical_percent は0〜100にしてください: %d", c.Battery.CriticalPercent)
+	}
+	// 自動着陸した残量のまま再び離陸できないよう、離陸の下限は自動着陸より高くする
+	if c.Battery.MinTakeOffPercent <= c.Battery.CriticalPercent || c.Battery.MinTakeOffPercent > 100 {
+		return fmt.Errorf("battery.min_takeoff_percent は critical_percent（%d）より大きく100以下にしてください: %d",
+			c.Battery.CriticalPercent, c.Battery.MinTakeOffPercent)
+	}
+	if c.Link.TimeoutMS <= 0 {
+		return fmt.Errorf("link.timeout_ms は正の値にしてください: %d", c.Link.TimeoutMS)
+	}
+	if c.Link.LandAfterOutageSeconds < 0 {
+		return fmt.Errorf("link.land_after_outage_seconds は0以上にしてください: %d", c.Link.LandAfterOutageSeconds)
+	}
+	if c.Geofence.CeilingM < 0 || c.Geofence.MinLateralHeightM < 0 || c.Geofence.MaxFlightMinutes < 0 {
+		return fmt.Errorf("geofence の値は0以上にしてください: %+v", c.Geofence)
+	}
+	if c.Geofence.CeilingM > 0 && c.Geofence.MinLateralHeightM >= c.Geofence.CeilingM {
+		return fmt.Errorf("geofence.min_lateral_height_m（%.1f）は ceiling_m（%.1f）より低くしてください",
+			c.Geofence.MinLateralHeightM, c.Geofence.CeilingM)
+	}
+	return nil
+}
+
+// Save は設定をファイルに書き込む
+func (c *Config) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("設定ファイルを保存できません: %w", err)
+	}
+	return nil
+}
+
+// Bindings は設定からキー割り当ての対応表を作成する
+func (c *Config) Bindings() (*KeyBindings, error) {
+	return NewKeyBindings(c.KeyBindings)
+}
+
+// HoldTimeout はキー入力が途絶えてから移動を止めるまでの時間を返す
+func (c *Config) HoldTimeout() time.Duration {
+	return time.Duration(c.HoldTimeoutMS) * time.Millisecond
+}
+
+// MP4Options は録画設定からMP4ライターのオプションを作成する
+func (r RecordingConfig) MP4Options() MP4Options {
+	if !r.Fragmented {
+		return MP4Options{}
+	}
+	return MP4Options{FragmentDuration: time.Duration(r.FragmentSeconds) * time.Second}
+}
+
+// PreRecordLength は録画開始前にさかのぼって録画する長さを返す
+func (r RecordingConfig) PreRecordLength() time.Duration {
+	return time.Duration(r.PreRecordSeconds) * time.Second
+}
+
+// PreRecordMaxBytes は先行録画に使うメモリの上限（バイト）を返す
+func (r RecordingConfig) PreRecordMaxBytes() int {
+	return r.PreRecordMaxMB << 20
+}
+
+// Timeout は通信途絶とみなすまでの時間を返す
+func (l LinkConfig) Timeout() time.Duration {
+	return time.Duration(l.TimeoutMS) * time.Millisecond
+}
+
+// LandAfterOutage は回復後に着陸させる通信途絶の長さを返す（0なら着陸させない）
+func (l LinkConfig) LandAfterOutage() time.Duration {
+	return time.Duration(l.LandAfterOutageSeconds) * time.Second
+}
+
+// MaxFlightTime は最大飛行時間を返す（0なら制限しない）
+func (g GeofenceConfig) MaxFlightTime() time.Duration {
+	return time.Duration(g.MaxFlightMinutes * float64(time.Minute))
+}
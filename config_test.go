@@ -0,0 +1,320 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+// writeConfigFile はテスト用の設定ファイルを一時ディレクトリに作成します
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tello_config.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestLoadConfigMissingFile 設定ファイルがない場合は既定のキー割り当てになることをテストします
+func TestLoadConfigMissingFile(t *testing.T) {
+	config, err := LoadConfig(filepath.Join(t.TempDir(), "none.json"))
+	if err != nil {
+		t.Fatalf("設定ファイルがなくてもエラーにすべきでない: %v", err)
+	}
+	bindings, err := config.Bindings()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		event termbox.Event
+		want  Action
+	}{
+		{termbox.Event{Ch: 'w'}, ActionForward},
+		{termbox.Event{Ch: 'W'}, ActionForward},
+		{termbox.Event{Key: termbox.KeySpace}, ActionUp},
+		{termbox.Event{Key: termbox.KeyEsc}, ActionTakeOffLand},
+		{termbox.Event{Ch: 'l'}, ActionToggleRecording},
+		{termbox.Event{Key: termbox.KeyCtrlC}, ActionQuit},
+	}
+	for _, c := range cases {
+		if got, ok := bindings.Lookup(c.event); !ok || got != c.want {
+			t.Errorf("%+v: 期待 %s, 実際 %s", c.event, c.want, got)
+		}
+	}
+}
+
+// TestLoadConfigAzerty AZERTY配列向けの設定で既定値が上書きされることをテストします
+func TestLoadConfigAzerty(t *testing.T) {
+	path := writeConfigFile(t, `{
+		"key_bindings": {
+			"forward": ["z"],
+			"left": ["q"],
+			"down": ["w"],
+			"rotate_ccw": ["a"],
+			"quit": ["Ctrl+Q"]
+		}
+	}`)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+	bindings, _ := config.Bindings()
+
+	if got, _ := bindings.Lookup(termbox.Event{Ch: 'z'}); got != ActionForward {
+		t.Errorf("Zは前進になるべき: %s", got)
+	}
+	if got, _ := bindings.Lookup(termbox.Event{Ch: 'q'}); got != ActionLeft {
+		t.Errorf("Qは左移動になるべき: %s", got)
+	}
+	if got, _ := bindings.Lookup(termbox.Event{Key: termbox.KeyCtrlQ}); got != ActionQuit {
+		t.Errorf("Ctrl+Qは終了になるべき: %s", got)
+	}
+	if got, _ := bindings.Lookup(termbox.Event{Ch: 'a'}); got != ActionRotateCCW {
+		t.Errorf("Aは左旋回になるべき: %s", got)
+	}
+	if got := bindings.Keys(ActionQuit); !reflect.DeepEqual(got, []string{"Ctrl+Q", "Ctrl+C"}) {
+		t.Errorf("終了キーにはCtrl+Cが常に含まれるべき: %v", got)
+	}
+}
+
+// TestLoadConfigConflict 同じキーが複数の操作に割り当てられた設定はエラーになることをテストします
+func TestLoadConfigConflict(t *testing.T) {
+	// 前進をZにしたが、既定の降下(Z)を変更していない
+	path := writeConfigFile(t, `{"key_bindings": {"forward": ["Z"]}}`)
+
+	_, err := LoadConfig(path)
+	if err == nil {
+		t.Fatal("キーの重複はエラーにすべき")
+	}
+	if !strings.Contains(err.Error(), "Z（down と forward）") {
+		t.Errorf("重複したキーと操作がエラーに含まれるべき: %v", err)
+	}
+}
+
+// TestNewKeyBindingsInvalid 不正なキー割り当てがエラーになることをテストします
+func TestNewKeyBindingsInvalid(t *testing.T) {
+	cases := map[string]map[Action][]string{
+		"未知の操作":       {"barrel_roll": {"B"}},
+		"未知のキー":       {ActionForward: {"Hyper+W"}},
+		"Ctrl+Cの再割当て": {ActionForward: {"Ctrl+C"}},
+	}
+	for name, config := range cases {
+		if _, err := NewKeyBindings(config); err == nil {
+			t.Errorf("%s: エラーにすべき", name)
+		}
+	}
+}
+
+// TestKeyBindingsHelp キー凡例が現在の割り当てから作成されることをテストします
+func TestKeyBindingsHelp(t *testing.T) {
+	bindings, err := NewKeyBindings(map[Action][]string{
+		ActionForward:     {"Up", "k"},
+		ActionTakeOffLand: {"Enter"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []HelpEntry{
+		{Keys: "Up/K", Description: "前進"},
+		{Keys: "Enter", Description: "離陸/着陸"},
+		{Keys: "Ctrl+C", Description: "終了"},
+	}
+	if got := bindings.Help(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("キー凡例が不正\n期待: %v\n実際: %v", expected, got)
+	}
+}
+
+// TestKeyboardCustomBindings 設定したキー割り当てでコマンドが送信されることをテストします
+func TestKeyboardCustomBindings(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := NewDroneControllerWithDrone(fake)
+	keyboardHandler := NewKeyboardHandler(droneController, nil)
+	connectFakeDrone(t, fake, droneController)
+
+	bindings, err := NewKeyBindings(map[Action][]string{
+		ActionTakeOffLand: {"Enter"},
+		ActionForward:     {"Up"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyboardHandler.SetKeyBindings(bindings)
+
+	keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEnter})
+	keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Ch: 'w'}) // 割り当てなし
+	keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Key: termbox.KeyArrowUp})
+
+	expected := []string{"TakeOff", "Forward(20)"}
+	if got := fake.Commands(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("コマンド列が不正\n期待: %v\n実際: %v", expected, got)
+	}
+}
+
+// TestLoadConfigHoldTimeout キーを離してから止まるまでの時間を設定できることをテストします
+func TestLoadConfigHoldTimeout(t *testing.T) {
+	config, err := LoadConfig(writeConfigFile(t, `{"hold_timeout_ms": 800}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := config.HoldTimeout(); got != 800*time.Millisecond {
+		t.Errorf("期待 800ms, 実際 %v", got)
+	}
+	if got, _ := config.Bindings(); got == nil {
+		t.Error("キー割り当ては既定値のまま使えるべき")
+	}
+
+	if _, err := LoadConfig(writeConfigFile(t, `{"hold_timeout_ms": -1}`)); err == nil {
+		t.Error("負の時間はエラーにすべき")
+	}
+}
+
+// TestConfigSaveRoundTrip 保存した速度レベルとモードが次回読み込まれることをテストします
+func TestConfigSaveRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tello_config.json")
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Speed = 60
+	config.FastMode = true
+	if err := config.Save(path); err != nil {
+		t.Fatalf("保存に失敗: %v", err)
+	}
+
+	loaded, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("保存した設定を読み込めません: %v", err)
+	}
+	if loaded.Speed != 60 || !loaded.FastMode {
+		t.Errorf("保存した値が読み込まれていない: speed=%d fast_mode=%v", loaded.Speed, loaded.FastMode)
+	}
+	if !reflect.DeepEqual(loaded.KeyBindings, config.KeyBindings) {
+		t.Error("キー割り当ても保存されるべき")
+	}
+
+	if _, err := LoadConfig(writeConfigFile(t, `{"speed": 150}`)); err == nil {
+		t.Error("範囲外の速度レベルはエラーにすべき")
+	}
+}
+
+// TestLoadConfigRecording 録画形式とフラグメント形式の録画を設定できることをテストします
+func TestLoadConfigRecording(t *testing.T) {
+	config, err := LoadConfig(writeConfigFile(t, `{"recording": {"fragmented": true}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Recording.MP4Options().FragmentDuration; got != 2*time.Second {
+		t.Errorf("間隔を省略したら既定の2秒: %v", got)
+	}
+
+	if config.Recording.Format != "MOV" {
+		t.Errorf("既定の録画形式は MOV: %s", config.Recording.Format)
+	}
+	if got := DefaultConfig().Recording.MP4Options(); got.FragmentDuration != 0 {
+		t.Errorf("既定では通常形式で録画すべき: %v", got)
+	}
+	if _, err := LoadConfig(writeConfigFile(t, `{"recording": {"fragmented": true, "fragment_seconds": 0}}`)); err == nil {
+		t.Error("間隔が0秒ならエラーにすべき")
+	}
+	if _, err := LoadConfig(writeConfigFile(t, `{"recording": {"format": "avi"}}`)); err == nil {
+		t.Error("未知の録画形式はエラーにすべき")
+	}
+
+	if config.Recording.PreRecordLength() != 5*time.Second || config.Recording.PreRecordMaxBytes() != 32<<20 {
+		t.Errorf("先行録画の既定値: %v, %d", config.Recording.PreRecordLength(), config.Recording.PreRecordMaxBytes())
+	}
+	config, err = LoadConfig(writeConfigFile(t, `{"recording": {"pre_record_seconds": 0}}`))
+	if err != nil || config.Recording.PreRecordLength() != 0 {
+		t.Errorf("0秒なら先行録画しない: %v", err)
+	}
+	if _, err := LoadConfig(writeConfigFile(t, `{"recording": {"pre_record_max_mb": -1}}`)); err == nil {
+		t.Error("メモリの上限が負ならエラーにすべき")
+	}
+}
+
+// TestLoadConfigBattery バッテリー監視の残量を設定・検証できることをテストします
+func TestLoadConfigBattery(t *testing.T) {
+	config, err := LoadConfig(writeConfigFile(t, `{"battery": {"warn_percent": [40], "min_takeoff_percent": 30}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config.Battery.WarnPercent, []int{40}) || config.Battery.MinTakeOffPercent != 30 || config.Battery.CriticalPercent != defaultBatteryCritical {
+		t.Errorf("バッテリー監視の設定が不正: %+v", config.Battery)
+	}
+
+	for _, body := range []string{
+		`{"battery": {"warn_percent": [0]}}`,
+		`{"battery": {"critical_percent": 101}}`,
+		`{"battery": {"min_takeoff_percent": 10, "critical_percent": 10}}`,
+	} {
+		if _, err := LoadConfig(writeConfigFile(t, body)); err == nil {
+			t.Errorf("不正な設定はエラーにすべき: %s", body)
+		}
+	}
+}
+
+// TestLoadConfigLink 通信途絶の監視を設定できることをテストします
+func TestLoadConfigLink(t *testing.T) {
+	config := DefaultConfig()
+	if config.Link.Timeout() != defaultLinkTimeout || config.Link.LandAfterOutage() != 0 {
+		t.Errorf("通信途絶の監視の既定値: %v, %v", config.Link.Timeout(), config.Link.LandAfterOutage())
+	}
+
+	config, err := LoadConfig(writeConfigFile(t, `{"link": {"timeout_ms": 800, "land_after_outage_seconds": 5}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Link.Timeout() != 800*time.Millisecond || config.Link.LandAfterOutage() != 5*time.Second {
+		t.Errorf("通信途絶の監視の設定が不正: %+v", config.Link)
+	}
+	if _, err := LoadConfig(writeConfigFile(t, `{"link": {"land_after_outage_seconds": -1}}`)); err == nil {
+		t.Error("負の秒数はエラーにすべき")
+	}
+}
+
+// TestLoadConfigGeofence 高度と飛行時間の制限を設定・検証できることをテストします
+func TestLoadConfigGeofence(t *testing.T) {
+	if DefaultConfig().Geofence != (GeofenceConfig{}) {
+		t.Errorf("既定では制限しない: %+v", DefaultConfig().Geofence)
+	}
+
+	config, err := LoadConfig(writeConfigFile(t, `{"geofence": {"ceiling_m": 3, "min_lateral_height_m": 0.5, "max_flight_minutes": 7.5}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Geofence.CeilingM != 3 || config.Geofence.MaxFlightTime() != 450*time.Second {
+		t.Errorf("制限の設定が不正: %+v", config.Geofence)
+	}
+
+	for _, body := range []string{
+		`{"geofence": {"ceiling_m": -1}}`,
+		`{"geofence": {"ceiling_m": 1, "min_lateral_height_m": 1}}`,
+	} {
+		if _, err := LoadConfig(writeConfigFile(t, body)); err == nil {
+			t.Errorf("不正な設定はエラーにすべき: %s", body)
+		}
+	}
+}
+
+// TestLoadConfigPhoto 写真撮影の中継は既定で無効、設定で有効にできることをテストします
+func TestLoadConfigPhoto(t *testing.T) {
+	if DefaultConfig().Photo.Relay {
+		t.Error("写真撮影の中継は既定で無効にすべき")
+	}
+	config, err := LoadConfig(writeConfigFile(t, `{"photo": {"relay": true}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.Photo.Relay {
+		t.Errorf("写真撮影の中継の設定が不正: %+v", config.Photo)
+	}
+}
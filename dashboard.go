@@ -0,0 +1,406 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"GobotProject/h264"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+)
+
+// HelpEntry はキー凡例の1項目
+type HelpEntry struct {
+	Keys        string
+	Description string
+}
+
+// dashboardLine は画面の1行（文字列と色）
+type dashboardLine struct {
+	text string
+	fg   termbox.Attribute
+}
+
+// Dashboard はtermboxで全画面のテレメトリー表示を行うクラス
+type Dashboard struct {
+	droneController *DroneController
+	cameraViewer    *CameraViewer
+	events          *EventLog
+	help            func() []HelpEntry
+	interval        time.Duration
+
+	mu      sync.Mutex
+	running bool
+	stop    chan struct{}
+	done    chan struct{}
+	redraw  chan struct{} // 再描画の依頼（描画は再描画のゴルーチンだけが行う）
+}
+
+// NewDashboard は新しいダッシュボードを作成
+func NewDashboard(droneController *DroneController, cameraViewer *CameraViewer, events *EventLog, help func() []HelpEntry) *Dashboard {
+	return &Dashboard{
+		droneController: droneController,
+		cameraViewer:    cameraViewer,
+		events:          events,
+		help:            help,
+		interval:        200 * time.Millisecond,
+		redraw:          make(chan struct{}, 1),
+	}
+}
+
+// Start は定期的な再描画を開始する（termbox初期化後に呼ぶ）
+func (d *Dashboard) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.running {
+		return
+	}
+	d.running = true
+	d.stop = make(chan struct{})
+	d.done = make(chan struct{})
+
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		d.Render()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				d.Render()
+			case <-d.redraw:
+				d.Render()
+			}
+		}
+	}(d.stop, d.done)
+}
+
+// Stop は再描画を停止する（複数回呼んでも安全）
+func (d *Dashboard) Stop() {
+	d.mu.Lock()
+	if !d.running {
+		d.mu.Unlock()
+		return
+	}
+	d.running = false
+	close(d.stop)
+	done := d.done
+	d.mu.Unlock()
+
+	<-done
+}
+
+// Redraw は次の周期を待たずに再描画するよう依頼する（画面サイズの変更時など）
+// termboxの描画が重ならないよう、描画は再描画のゴルーチンに任せる。依頼済みなら何もしない
+func (d *Dashboard) Redraw() {
+	select {
+	case d.redraw <- struct{}{}:
+	default:
+	}
+}
+
+// Render は現在の状態で画面全体を描画する
+func (d *Dashboard) Render() {
+	width, height := termbox.Size()
+	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+
+	for y, line := range d.lines(width, height) {
+		drawText(0, y, width, line.text, line.fg)
+	}
+	termbox.Flush()
+}
+
+// lines は画面に表示する行を組み立てる
+func (d *Dashboard) lines(width, height int) []dashboardLine {
+	rule := dashboardLine{text: strings.Repeat("─", max(width, 1)), fg: termbox.ColorBlue}
+
+	var lines []dashboardLine
+	lines = append(lines, d.headerLine())
+	lines = append(lines, rule)
+	lines = append(lines, d.statusLines()...)
+	lines = append(lines, rule)
+	if video := d.videoLines(); len(video) > 0 {
+		lines = append(lines, video...)
+		lines = append(lines, rule)
+	}
+	lines = append(lines, d.helpLines(width)...)
+	lines = append(lines, rule)
+	lines = append(lines, dashboardLine{text: " イベントログ", fg: termbox.ColorCyan | termbox.AttrBold})
+
+	// 残りの行数でイベントログを表示
+	if d.events != nil {
+		if remaining := height - len(lines); remaining > 0 {
+			for _, entry := range d.events.Entries(remaining) {
+				lines = append(lines, dashboardLine{
+					text: fmt.Sprintf("  %s %s", entry.Time.Format("15:04:05"), entry.Message),
+					fg:   termbox.ColorDefault,
+				})
+			}
+		}
+	}
+
+	return lines
+}
+
+// headerLine はタイトルと接続状態の行
+func (d *Dashboard) headerLine() dashboardLine {
+	title := " Tello ドローンコントローラー"
+	if d.droneController == nil {
+		return dashboardLine{text: title, fg: termbox.ColorWhite | termbox.AttrBold}
+	}
+	if link := d.droneController.LinkStatus(); link.Lost {
+		return dashboardLine{
+			text: fmt.Sprintf("%s   [通信途絶 %.1f秒  再接続 %d回]", title, link.Outage.Seconds(), link.Attempts),
+			fg:   termbox.ColorRed | termbox.AttrBold,
+		}
+	}
+	if d.droneController.IsLinkReady() {
+		return dashboardLine{text: title + "   [接続済み]", fg: termbox.ColorGreen | termbox.AttrBold}
+	}
+	return dashboardLine{text: title + "   [接続待ち]", fg: termbox.ColorYellow | termbox.AttrBold}
+}
+
+// statusLines はテレメトリー・飛行状態・録画の行
+func (d *Dashboard) statusLines() []dashboardLine {
+	var lines []dashboardLine
+
+	if d.droneController != nil {
+		s := d.droneController.Telemetry().Snapshot()
+
+		battery := d.droneController.BatteryStatus()
+		batteryColor := termbox.ColorGreen
+		batteryState := ""
+		switch {
+		case battery.ForcedLanding:
+			batteryColor = termbox.ColorRed | termbox.AttrBold
+			batteryState = "   自動着陸"
+		case !battery.TakeOffAllowed:
+			batteryColor = termbox.ColorRed | termbox.AttrBold
+			batteryState = "   離陸不可"
+		case s.BatteryLower:
+			batteryColor = termbox.ColorRed | termbox.AttrBold
+		case s.BatteryLow || battery.Warning > 0:
+			batteryColor = termbox.ColorYellow
+		}
+		lines = append(lines, dashboardLine{
+			text: fmt.Sprintf(" バッテリー %3d%% %s   高度 %.1f m%s", s.BatteryPercent, batteryBar(s.BatteryPercent, 10), s.Height, batteryState),
+			fg:   batteryColor,
+		})
+		lines = append(lines, dashboardLine{
+			text: fmt.Sprintf(" 速度  水平 %.1f m/s  垂直 %.1f m/s   Wi-Fi %d%%", s.GroundSpeed(), s.VerticalSpeed, s.WifiStrength),
+			fg:   termbox.ColorDefault,
+		})
+
+		state := d.droneController.FlightState()
+		stateColor := termbox.ColorDefault
+		switch state {
+		case StateEmergency, StateLinkLost:
+			stateColor = termbox.ColorRed | termbox.AttrBold
+		case StateTakingOff, StateLanding:
+			stateColor = termbox.ColorYellow
+		}
+		wind := "正常"
+		if s.WindState {
+			wind = "強風"
+		}
+		lines = append(lines, dashboardLine{
+			text: fmt.Sprintf(" 飛行状態 %s   飛行時間 %s   風 %s", state, formatElapsed(s.FlyTime), wind),
+			fg:   stateColor,
+		})
+
+		if fence := d.droneController.GeofenceStatus(); fence.Enabled() {
+			lines = append(lines, geofenceLine(fence))
+		}
+
+		mode := "低速"
+		if d.droneController.IsFastMode() {
+			mode = "高速"
+		}
+		speed := d.droneController.Speed()
+		lines = append(lines, dashboardLine{
+			text: fmt.Sprintf(" 速度レベル %3d %s   %sモード", speed, speedBar(speed), mode),
+			fg:   termbox.ColorDefault,
+		})
+	}
+
+	if d.cameraViewer != nil {
+		if d.cameraViewer.WaitingForKeyframe() {
+			lines = append(lines, dashboardLine{
+				text: fmt.Sprintf(" 録画 ● キーフレーム待ち %s  %s", formatElapsed(d.cameraViewer.RecordingElapsed()), d.cameraViewer.GetCurrentRecordingFile()),
+				fg:   termbox.ColorYellow | termbox.AttrBold,
+			})
+		} else if d.cameraViewer.IsRecording() {
+			lines = append(lines, dashboardLine{
+				text: fmt.Sprintf(" 録画 ● REC %s  %s", formatElapsed(d.cameraViewer.RecordingElapsed()), d.cameraViewer.GetCurrentRecordingFile()),
+				fg:   termbox.ColorRed | termbox.AttrBold,
+			})
+		} else {
+			text := fmt.Sprintf(" 録画 停止中（形式: %s）", d.cameraViewer.GetRecordingFormat())
+			if pre := d.cameraViewer.PreRecordStatus(); pre.Enabled() {
+				text += fmt.Sprintf("  先行録画 %.1f/%.0f秒 %.1f/%.0fMB",
+					pre.Length.Seconds(), pre.MaxLength.Seconds(), float64(pre.Bytes)/(1<<20), float64(pre.MaxBytes)/(1<<20))
+			}
+			lines = append(lines, dashboardLine{text: text, fg: termbox.ColorDefault})
+		}
+
+		if photo := d.cameraViewer.PhotoStatus(); photo.Pending {
+			lines = append(lines, dashboardLine{
+				text: fmt.Sprintf(" 写真 ● 受信中 %3.0f%%", photo.Progress*100),
+				fg:   termbox.ColorYellow | termbox.AttrBold,
+			})
+		} else if photo.LastFile != "" {
+			lines = append(lines, dashboardLine{text: " 写真 最後に保存: " + photo.LastFile, fg: termbox.ColorDefault})
+		}
+	}
+
+	return lines
+}
+
+// geofenceLine は高度・飛行時間の制限の行
+// 飛行時間を超えたら赤、天井や最低高度で操作を制限しているときは黄色にする
+func geofenceLine(fence GeofenceStatus) dashboardLine {
+	var limits []string
+	if fence.Ceiling > 0 {
+		limits = append(limits, fmt.Sprintf("天井 %.1f m", fence.Ceiling))
+	}
+	if fence.MinLateral > 0 {
+		limits = append(limits, fmt.Sprintf("水平移動 %.1f m 以上", fence.MinLateral))
+	}
+	if fence.MaxFlightTime > 0 {
+		limits = append(limits, "飛行時間 "+formatElapsed(fence.MaxFlightTime)+" まで")
+	}
+	line := dashboardLine{text: " 制限 " + strings.Join(limits, "  "), fg: termbox.ColorDefault}
+
+	switch {
+	case fence.FlightTimeExceeded:
+		line.text += "   飛行時間超過 - 戻って着陸してください"
+		line.fg = termbox.ColorRed | termbox.AttrBold
+	case fence.AtCeiling:
+		line.text += "   天井に到達"
+		line.fg = termbox.ColorYellow
+	case fence.BelowLateral:
+		line.text += "   水平移動不可"
+		line.fg = termbox.ColorYellow
+	}
+	return line
+}
+
+// videoLines は映像ストリームの受信状態の行
+// フレームが途切れている、欠落後にキーフレームが来ていないなど、映像が乱れていれば色を変える
+func (d *Dashboard) videoLines() []dashboardLine {
+	if d.cameraViewer == nil {
+		return nil
+	}
+	stats := d.cameraViewer.StreamStats()
+
+	title := " 映像"
+	if info := d.cameraViewer.VideoInfo(); info != nil {
+		title += "  " + info.String()
+	}
+	lines := []dashboardLine{{text: title, fg: termbox.ColorCyan | termbox.AttrBold}}
+	if stats.Frames == 0 {
+		return append(lines, dashboardLine{text: "  受信待ち", fg: termbox.ColorDefault})
+	}
+
+	color := termbox.ColorGreen
+	state := "正常"
+	switch {
+	case stats.SinceFrame >= streamGapNotify:
+		color, state = termbox.ColorRed|termbox.AttrBold, fmt.Sprintf("途切れています（%.1f秒）", stats.SinceFrame.Seconds())
+	case stats.Damaged:
+		color, state = termbox.ColorYellow, "欠落あり（次のキーフレームまで乱れます）"
+	case stats.SinceKeyframe >= streamKeyframeTimeout:
+		color, state = termbox.ColorYellow, "キーフレームが来ていません"
+	}
+	lines = append(lines, dashboardLine{
+		text: fmt.Sprintf("  %.1f フレーム/秒  %.2f Mbps  ジッター %d ms   %s",
+			stats.FrameRate, stats.Bitrate/1e6, stats.Jitter.Milliseconds(), state),
+		fg: color,
+	})
+	lines = append(lines, dashboardLine{
+		text: fmt.Sprintf("  キーフレーム %.1f秒前   欠落 %d 箇所（約 %d フレーム）   破損NAL %d",
+			stats.SinceKeyframe.Seconds(), stats.Gaps.Count, stats.Gaps.Dropped, stats.CorruptNALs),
+		fg: termbox.ColorDefault,
+	})
+	lines = append(lines, dashboardLine{text: "  NAL " + formatNALCounts(stats.NALCounts), fg: termbox.ColorDefault})
+	return lines
+}
+
+// formatNALCounts はNALタイプごとの受信数をタイプ番号の順に並べる
+func formatNALCounts(counts map[h264.NALType]int) string {
+	types := make([]h264.NALType, 0, len(counts))
+	for t := range counts {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	parts := make([]string, len(types))
+	for i, t := range types {
+		parts[i] = fmt.Sprintf("%v %d", t, counts[t])
+	}
+	return strings.Join(parts, "  ")
+}
+
+// helpLines はキー凡例を画面幅に合わせて折り返した行
+func (d *Dashboard) helpLines(width int) []dashboardLine {
+	lines := []dashboardLine{{text: " キー操作", fg: termbox.ColorCyan | termbox.AttrBold}}
+	if d.help == nil {
+		return lines
+	}
+
+	current := " "
+	for _, entry := range d.help() {
+		item := fmt.Sprintf(" %s:%s ", entry.Keys, entry.Description)
+		if runewidth.StringWidth(current)+runewidth.StringWidth(item) > width && current != " " {
+			lines = append(lines, dashboardLine{text: current, fg: termbox.ColorDefault})
+			current = " "
+		}
+		current += item
+	}
+	return append(lines, dashboardLine{text: current, fg: termbox.ColorDefault})
+}
+
+// batteryBar はバッテリー残量のバーを返す
+func batteryBar(percent, width int) string {
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	filled := percent * width / 100
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", width-filled) + "]"
+}
+
+// speedBar は速度レベルのバーを返す
+func speedBar(speed int) string {
+	steps := (maxSpeed-minSpeed)/speedStep + 1
+	filled := (speed-minSpeed)/speedStep + 1
+	return "[" + strings.Repeat("|", filled) + strings.Repeat(" ", steps-filled) + "]"
+}
+
+// formatElapsed は経過時間を mm:ss 形式にする
+func formatElapsed(d time.Duration) string {
+	total := int(d / time.Second)
+	return fmt.Sprintf("%02d:%02d", total/60, total%60)
+}
+
+// drawText は全角文字の幅を考慮して1行を描画する（画面幅で切り詰める）
+func drawText(x, y, width int, text string, fg termbox.Attribute) {
+	for _, r := range text {
+		w := runewidth.RuneWidth(r)
+		if x+w > width {
+			return
+		}
+		termbox.SetCell(x, y, r, fg, termbox.ColorDefault)
+		x += w
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gobot.io/x/gobot/platforms/dji/tello"
+)
+
+// dashboardText はダッシュボードの行を1つの文字列にします
+func dashboardText(lines []dashboardLine) string {
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(line.text)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// TestDashboardShowsTelemetry テレメトリーと録画状態が表示されることをテストします
+func TestDashboardShowsTelemetry(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := NewDroneControllerWithDrone(fake)
+	droneController.Telemetry().updateFlightData(&tello.FlightData{
+		BatteryPercentage: 64,
+		Height:            12,
+		FlyTime:           95,
+	})
+	droneController.Telemetry().updateWifi(&tello.WifiData{Strength: 77})
+
+	events := NewEventLog(10)
+	events.Add("離陸")
+	dashboard := NewDashboard(droneController, nil, events, func() []HelpEntry { return DefaultKeyBindings().Help() })
+
+	text := dashboardText(dashboard.lines(80, 40))
+	for _, want := range []string{"バッテリー  64%", "高度 1.2 m", "Wi-Fi 77%", "飛行時間 00:09", "速度レベル  20", "低速モード", "[接続待ち]", "Esc:離陸/着陸", "離陸"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("%q が表示されていません\n%s", want, text)
+		}
+	}
+}
+
+// TestDashboardEventLogFitsScreen イベントログが画面の高さに収まることをテストします
+func TestDashboardEventLogFitsScreen(t *testing.T) {
+	events := NewEventLog(100)
+	for i := 0; i < 100; i++ {
+		events.Add("イベント %d", i)
+	}
+	dashboard := NewDashboard(nil, nil, events, nil)
+
+	lines := dashboard.lines(80, 20)
+	if len(lines) != 20 {
+		t.Errorf("行数: 期待 20, 実際 %d", len(lines))
+	}
+	if last := lines[len(lines)-1].text; !strings.Contains(last, "イベント 99") {
+		t.Errorf("最新のイベントが最終行に表示されるべき: %q", last)
+	}
+}
+
+// TestFormatElapsed 経過時間の表示形式をテストします
+func TestFormatElapsed(t *testing.T) {
+	if got := formatElapsed(125 * time.Second); got != "02:05" {
+		t.Errorf("期待 02:05, 実際 %s", got)
+	}
+	if got := batteryBar(50, 10); got != "[#####.....]" {
+		t.Errorf("バッテリーバーが不正: %s", got)
+	}
+}
+
+// TestDashboardRedraw 再描画の依頼はブロックせず、描画前の依頼は1回にまとめられることをテストします
+func TestDashboardRedraw(t *testing.T) {
+	dashboard := NewDashboard(nil, nil, nil, nil)
+	dashboard.Redraw()
+	dashboard.Redraw()
+
+	if pending := len(dashboard.redraw); pending != 1 {
+		t.Errorf("再描画の依頼: 期待 1, 実際 %d", pending)
+	}
+}
+
+// TestDashboardShowsVideoInfo 受信したSPSの解像度とフレームレートが表示されることをテストします
+func TestDashboardShowsVideoInfo(t *testing.T) {
+	cameraViewer := NewCameraViewer(NewFakeDrone())
+	events := NewEventLog(10)
+	cameraViewer.SetEventLog(events)
+	cameraViewer.isRunning = true
+	cameraViewer.SetPreRecord(5*time.Second, 32<<20)
+	packets, _ := telloVideoPackets(10, 3)
+	for _, packet := range packets {
+		cameraViewer.processFrame(packet)
+	}
+
+	dashboard := NewDashboard(NewDroneControllerWithDrone(NewFakeDrone()), cameraViewer, events, nil)
+	text := dashboardText(dashboard.lines(80, 40))
+	for _, want := range []string{"960x720 Constrained Baseline@4.0 30fps", "映像: 960x720", "録画 停止中（形式: MOV）", "先行録画 0.0/5秒", "/32MB", "フレーム/秒", "NAL IDRスライス 1  SPS 1"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("%q が表示されていません\n%s", want, text)
+		}
+	}
+}
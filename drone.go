@@ -0,0 +1,38 @@
+package main
+
+import (
+	"gobot.io/x/gobot"
+	"gobot.io/x/gobot/platforms/dji/tello"
+)
+
+// Drone はDroneController・CameraViewer・mainが依存するドローン操作のインターフェース
+// 実機用の *tello.Driver と、テスト用の FakeDrone がこれを満たす
+type Drone interface {
+	gobot.Device
+
+	// 飛行制御
+	TakeOff() error
+	Land() error
+	Forward(val int) error
+	Backward(val int) error
+	Left(val int) error
+	Right(val int) error
+	Up(val int) error
+	Down(val int) error
+	Clockwise(val int) error
+	CounterClockwise(val int) error
+	Hover()
+	SetFastMode() error
+	SetSlowMode() error
+
+	// ビデオ制御
+	StartVideo() error
+	SetVideoEncoderRate(rate tello.VideoBitRate) error
+	SetExposure(level int) error
+
+	// イベント購読（tello.VideoFrameEvent など）
+	On(name string, f func(s interface{})) error
+}
+
+// 実機ドライバーがDroneを満たすことをコンパイル時に確認
+var _ Drone = (*tello.Driver)(nil)
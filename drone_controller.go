@@ -1,101 +1,249 @@
 package main
 
 import (
-	"fmt"
+	"sync"
+	"time"
+
 	"gobot.io/x/gobot/platforms/dji/tello"
 )
 
+// defaultDroneAddress はTelloの制御コマンドの送信先
+const defaultDroneAddress = "192.168.10.1:8889"
+
 // DroneController はTelloドローンを制御するクラス
 type DroneController struct {
-	drone      *tello.Driver
-	isFlying   bool
+	notifier
+	drone      Drone
 	isRecording bool
+	address    string
+	telemetry  *Telemetry
+
+	// 飛行状態（state・lastFlightCommand・fastMode・emergencySentはmuで保護）
+	mu                sync.Mutex
+	state             FlightState
+	lastFlightCommand time.Time
+	now               func() time.Time
+	fastMode          bool
+	emergencySent     time.Time // 非常停止を送り、モーターの停止を確認していなければその時刻
+
+	// 飛行状態の遷移の購読者
+	flightSubs flightSubscribers
+
+	// 速度レベルやモードが変わったときのコールバック
+	onSettingsChanged func(speed int, fastMode bool)
+
+	// 接続確認（ConnectedEventと最初のFlightDataEventで閉じる）
+	connected      chan struct{}
+	flightData     chan struct{}
+	connectedOnce  sync.Once
+	flightDataOnce sync.Once
+
+	// キー入力から推定したスティックの状態
+	sticks stickState
+
+	// バッテリー残量の監視
+	battery batterySupervisor
+
+	// ドローンとの通信途絶の監視
+	link linkWatchdog
+
+	// 高度・飛行時間の制限
+	fence geofence
 }
 
-// NewDroneController は新しいドローンコントローラーを作成
+// NewDroneController は実機のTelloドライバーを使う新しいドローンコントローラーを作成
 func NewDroneController() *DroneController {
-	drone := tello.NewDriver("8888")
-	return &DroneController{
+	dc := NewDroneControllerWithDrone(tello.NewDriver("8888"))
+	dc.SetAddress(defaultDroneAddress)
+	return dc
+}
+
+// NewDroneControllerWithDrone は任意のDrone実装を使うドローンコントローラーを作成
+func NewDroneControllerWithDrone(drone Drone) *DroneController {
+	dc := &DroneController{
 		drone:      drone,
-		isFlying:   false,
 		isRecording: false,
+		telemetry:  NewTelemetry(),
+		now:        time.Now,
+		connected:  make(chan struct{}),
+		flightData: make(chan struct{}),
+	}
+	dc.sticks.timeout = defaultHoldTimeout
+	dc.sticks.speed = defaultSpeed
+	dc.SetBatteryThresholds(defaultBatteryWarnings, defaultBatteryMinTakeOff, defaultBatteryCritical)
+	dc.link.timeout = defaultLinkTimeout
+	dc.telemetry.Attach(drone)
+	dc.watchLink()
+	return dc
+}
+
+// watchLink は接続確認・通信途絶の監視・飛行状態の遷移に使うドローンのイベントを購読する
+// ドライバー開始直後の応答を取りこぼさないよう、作成時に登録しておく
+func (dc *DroneController) watchLink() {
+	dc.drone.On(tello.ConnectedEvent, func(interface{}) {
+		dc.packetReceived()
+		dc.apply(EventConnected)
+		dc.connectedOnce.Do(func() { close(dc.connected) })
+	})
+	dc.drone.On(tello.TakeoffEvent, func(interface{}) {
+		dc.apply(EventTakeOffStarted)
+	})
+	dc.drone.On(tello.LandingEvent, func(interface{}) {
+		dc.apply(EventLandingStarted)
+	})
+	dc.drone.On(tello.FlightDataEvent, func(data interface{}) {
+		dc.packetReceived()
+		if fd, ok := data.(*tello.FlightData); ok && fd != nil {
+			dc.reconcileFlying(fd)
+		}
+		dc.flightDataOnce.Do(func() { close(dc.flightData) })
+	})
+	dc.drone.On(tello.WifiDataEvent, func(interface{}) {
+		dc.packetReceived()
+	})
+}
+
+// reconcileFlying はドローンが報告した飛行フラグを飛行中・地上の報告として飛行状態に渡す
+// 非常停止の確認を待っている間は、確認に使うだけで飛行状態には渡さない
+func (dc *DroneController) reconcileFlying(fd *tello.FlightData) {
+	if dc.checkEmergency(fd) {
+		return
+	}
+	if fd.Flying {
+		dc.apply(EventAirborne)
+	} else {
+		dc.apply(EventGrounded)
+	}
+}
+
+// Telemetry はドローンのテレメトリーを返す
+func (dc *DroneController) Telemetry() *Telemetry {
+	return dc.telemetry
+}
+
+// SetAddress はドローンの制御アドレス（経路確認に使用）を設定
+func (dc *DroneController) SetAddress(address string) {
+	dc.address = address
+}
+
+// Address はドローンの制御アドレスを返す（未設定なら空文字）
+func (dc *DroneController) Address() string {
+	return dc.address
+}
+
+// Connected はドローンから接続応答を受け取ると閉じるチャネルを返す
+func (dc *DroneController) Connected() <-chan struct{} {
+	return dc.connected
+}
+
+// FlightDataReceived は最初のフライトデータを受け取ると閉じるチャネルを返す
+func (dc *DroneController) FlightDataReceived() <-chan struct{} {
+	return dc.flightData
+}
+
+// IsLinkReady は接続応答とフライトデータの両方を受信済みかどうかを返す
+func (dc *DroneController) IsLinkReady() bool {
+	select {
+	case <-dc.connected:
+	default:
+		return false
+	}
+	select {
+	case <-dc.flightData:
+		return true
+	default:
+		return false
 	}
 }
 
 // GetDriver はドローンドライバーを返す
-func (dc *DroneController) GetDriver() *tello.Driver {
+func (dc *DroneController) GetDriver() Drone {
 	return dc.drone
 }
 
-// TakeOffOrLand は離陸または着陸を制御
+// TakeOffOrLand は飛行状態に応じて離陸または着陸を制御
 func (dc *DroneController) TakeOffOrLand() {
-	if dc.isFlying {
+	if dc.IsFlying() {
 		dc.Land()
 	} else {
 		dc.TakeOff()
 	}
 }
 
-// TakeOff はドローンを離陸させる
+// TakeOff はドローンを離陸させる（離陸中となり、ドローンが飛行中と報告したらホバリングになる）
+// バッテリー残量が離陸の下限未満、自動着陸の後、または地上にいないときは離陸させない
 func (dc *DroneController) TakeOff() {
-	fmt.Println("ドローンが離陸します...")
+	if reason := dc.takeOffBlocked(); reason != "" {
+		dc.notify("%s", reason)
+		return
+	}
+	if err := dc.apply(EventTakeOff); err != nil {
+		dc.notify("離陸できません: %v", err)
+		return
+	}
+	dc.notify("ドローンが離陸します...")
+	dc.resetSticks()
 	dc.drone.TakeOff()
-	dc.isFlying = true
 }
 
-// Land はドローンを着陸させる
+// Land はドローンを着陸させる（着陸中となり、ドローンが地上と報告したら地上になる）
 func (dc *DroneController) Land() {
-	fmt.Println("ドローンが着陸します...")
+	if err := dc.apply(EventLand); err != nil {
+		dc.notify("着陸できません: %v", err)
+		return
+	}
+	dc.notify("ドローンが着陸します...")
+	dc.resetSticks()
+	dc.drone.Land()
+}
+
+// forceLand は飛行状態によらず着陸コマンドを送る（終了時・通信の回復後・非常停止の代わりなど安全のための着陸）
+// 記録している飛行状態が未接続や非常停止でも機体は飛んでいるかもしれないので、遷移表で拒否されても送る
+func (dc *DroneController) forceLand() {
+	dc.apply(EventLand)
+	dc.notify("ドローンが着陸します...")
+	dc.resetSticks()
 	dc.drone.Land()
-	dc.isFlying = false
 }
 
-// MoveForward はドローンを前進させる
+// MoveForward はドローンを前進させる（キーを離すと自動で止まる）
 func (dc *DroneController) MoveForward() {
-	if dc.isFlying {
-		fmt.Println("前進")
-		dc.drone.Forward(20)
-	}
+	dc.move(axisPitch, 1, "前進")
 }
 
 // MoveBackward はドローンを後退させる
 func (dc *DroneController) MoveBackward() {
-	if dc.isFlying {
-		fmt.Println("後退")
-		dc.drone.Backward(20)
-	}
+	dc.move(axisPitch, -1, "後退")
 }
 
 // MoveLeft はドローンを左に移動させる
 func (dc *DroneController) MoveLeft() {
-	if dc.isFlying {
-		fmt.Println("左移動")
-		dc.drone.Left(20)
-	}
+	dc.move(axisRoll, -1, "左移動")
 }
 
 // MoveRight はドローンを右に移動させる
 func (dc *DroneController) MoveRight() {
-	if dc.isFlying {
-		fmt.Println("右移動")
-		dc.drone.Right(20)
-	}
+	dc.move(axisRoll, 1, "右移動")
 }
 
 // MoveUp はドローンを上昇させる
 func (dc *DroneController) MoveUp() {
-	if dc.isFlying {
-		fmt.Println("上昇")
-		dc.drone.Up(20)
-	}
+	dc.move(axisThrottle, 1, "上昇")
 }
 
 // MoveDown はドローンを降下させる
 func (dc *DroneController) MoveDown() {
-	if dc.isFlying {
-		fmt.Println("降下")
-		dc.drone.Down(20)
-	}
+	dc.move(axisThrottle, -1, "降下")
+}
+
+// RotateClockwise はドローンを右（時計回り）に旋回させる
+func (dc *DroneController) RotateClockwise() {
+	dc.move(axisYaw, 1, "右旋回")
+}
+
+// RotateCounterClockwise はドローンを左（反時計回り）に旋回させる
+func (dc *DroneController) RotateCounterClockwise() {
+	dc.move(axisYaw, -1, "左旋回")
 }
 
 // ToggleRecording は録画のオン/オフを切り替える
@@ -109,21 +257,21 @@ func (dc *DroneController) ToggleRecording() {
 
 // StartRecording は録画を開始（ビデオストリーム）
 func (dc *DroneController) StartRecording() {
-	fmt.Println("録画開始")
+	dc.notify("録画開始")
 	dc.drone.StartVideo()
 	dc.isRecording = true
 }
 
 // StopRecording は録画を停止
 func (dc *DroneController) StopRecording() {
-	fmt.Println("録画停止")
+	dc.notify("録画停止")
 	// ビデオストリームは手動で停止しない（カメラビューワー側で制御）
 	dc.isRecording = false
 }
 
-// IsFlying はドローンが飛行中かどうかを返す
+// IsFlying はドローンが飛行中（離陸中・ホバリング・移動中）かどうかを返す
 func (dc *DroneController) IsFlying() bool {
-	return dc.isFlying
+	return dc.FlightState().Airborne()
 }
 
 // IsRecording はドローンが録画中かどうかを返す
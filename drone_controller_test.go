@@ -0,0 +1,283 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nsf/termbox-go"
+	"gobot.io/x/gobot/platforms/dji/tello"
+)
+
+// connectFakeDrone はフェイクドローンから接続応答とフライトデータを送り、接続確認の完了を待ちます
+func connectFakeDrone(t *testing.T, fake *FakeDrone, droneController *DroneController) {
+	t.Helper()
+	fake.Publish(tello.ConnectedEvent, nil)
+	fake.Publish(tello.FlightDataEvent, &tello.FlightData{OnGround: true, BatteryPercentage: 100})
+
+	deadline := time.Now().Add(time.Second)
+	for !droneController.IsLinkReady() {
+		if time.Now().After(deadline) {
+			t.Fatal("接続確認が完了しませんでした")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// newGroundedController は接続応答を受けて地上で待機しているドローンコントローラーを作成します
+func newGroundedController(drone Drone) *DroneController {
+	droneController := NewDroneControllerWithDrone(drone)
+	droneController.apply(EventConnected)
+	return droneController
+}
+
+// TestDroneControllerCommandSequence フェイクドローンで実際に送信されたコマンド列を検証します
+func TestDroneControllerCommandSequence(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := newGroundedController(fake)
+
+	droneController.TakeOff()
+	droneController.MoveForward()
+	droneController.MoveBackward()
+	droneController.MoveLeft()
+	droneController.MoveRight()
+	droneController.MoveUp()
+	droneController.MoveDown()
+	droneController.RotateClockwise()
+	droneController.RotateCounterClockwise()
+	droneController.Land()
+
+	expected := []string{
+		"TakeOff",
+		"Forward(20)",
+		"Backward(20)",
+		"Left(20)",
+		"Right(20)",
+		"Up(20)",
+		"Down(20)",
+		"Clockwise(20)",
+		"CounterClockwise(20)",
+		"Hover", // 着陸前に全軸を停止
+		"Land",
+	}
+	if got := fake.Commands(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("コマンド列が不正\n期待: %v\n実際: %v", expected, got)
+	}
+}
+
+// TestDroneControllerMoveIgnoredOnGround 地上では移動コマンドが送信されないことを確認します
+func TestDroneControllerMoveIgnoredOnGround(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := newGroundedController(fake)
+
+	droneController.MoveForward()
+	droneController.MoveUp()
+	droneController.RotateClockwise()
+
+	if got := fake.Commands(); len(got) != 0 {
+		t.Errorf("地上では移動コマンドを送信すべきでない: %v", got)
+	}
+}
+
+// TestShutdownLandsInAnyState 終了時は飛行状態によらず着陸コマンドを送ることを確認します
+func TestShutdownLandsInAnyState(t *testing.T) {
+	for _, state := range []FlightState{StateDisconnected, StateLanding, StateEmergency} {
+		fake := NewFakeDrone()
+		droneController := NewDroneControllerWithDrone(fake)
+		droneController.state = state
+		keyboardHandler := NewKeyboardHandler(droneController, nil)
+		keyboardHandler.SetShutdownCallback(func() {})
+
+		// 通常の着陸は遷移表で拒否されるが、終了時の着陸は送る
+		droneController.Land()
+		if got := fake.Commands(); len(got) != 0 {
+			t.Errorf("%s: 通常の着陸は拒否すべき: %v", state, got)
+		}
+		keyboardHandler.gracefulShutdown()
+		if got := fake.Commands(); !reflect.DeepEqual(got, []string{"Land"}) {
+			t.Errorf("%s: 終了時は着陸コマンドを送るべき: %v", state, got)
+		}
+		if got := droneController.FlightState(); got != state {
+			t.Errorf("%s: 拒否される状態では飛行状態を変えるべきでない: %s", state, got)
+		}
+	}
+}
+
+// TestKeyboardCommandSequence キー入力から送信されるコマンド列を検証します
+func TestKeyboardCommandSequence(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := NewDroneControllerWithDrone(fake)
+	keyboardHandler := NewKeyboardHandler(droneController, nil)
+	connectFakeDrone(t, fake, droneController)
+
+	// Esc → W → Q → E → Esc
+	keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEsc})
+	keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Ch: 'w'})
+	keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Ch: 'q'})
+	keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Ch: 'E'})
+	keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEsc})
+
+	expected := []string{"TakeOff", "Forward(20)", "CounterClockwise(20)", "Clockwise(20)", "Hover", "Land"}
+	if got := fake.Commands(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("コマンド列が不正\n期待: %v\n実際: %v", expected, got)
+	}
+}
+
+// TestKeyboardFlightKeysDisabledBeforeLink 接続確認前は飛行操作キーが無視されることを確認します
+func TestKeyboardFlightKeysDisabledBeforeLink(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := NewDroneControllerWithDrone(fake)
+	keyboardHandler := NewKeyboardHandler(droneController, nil)
+
+	keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEsc})
+	keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Ch: 'w'})
+
+	if got := fake.Commands(); len(got) != 0 {
+		t.Errorf("接続確認前にコマンドを送信すべきでない: %v", got)
+	}
+	if droneController.IsFlying() {
+		t.Error("接続確認前に飛行状態になるべきでない")
+	}
+}
+
+// TestDroneControllerReconcilesFlying ドローンの報告で飛行状態が照合されることを確認します
+func TestDroneControllerReconcilesFlying(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := newGroundedController(fake)
+	clock := time.Now()
+	droneController.now = func() time.Time { return clock }
+
+	droneController.TakeOff()
+
+	// 離陸直後の「地上」報告は猶予時間内なので無視される
+	droneController.reconcileFlying(&tello.FlightData{OnGround: true})
+	if !droneController.IsFlying() {
+		t.Error("猶予時間内はコマンドによる飛行状態を維持するべき")
+	}
+
+	// 猶予時間経過後はドローンの報告に従う
+	clock = clock.Add(flightStateGrace)
+	droneController.reconcileFlying(&tello.FlightData{OnGround: true})
+	if droneController.IsFlying() {
+		t.Error("ドローンが地上を報告したら飛行状態は解除されるべき")
+	}
+
+	droneController.reconcileFlying(&tello.FlightData{Flying: true})
+	if !droneController.IsFlying() {
+		t.Error("ドローンが飛行中を報告したら飛行状態になるべき")
+	}
+}
+
+// TestDroneControllerHoldToMove 押し続けている間は再送せず、入力が途絶えると停止することを確認します
+func TestDroneControllerHoldToMove(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := newGroundedController(fake)
+	clock := time.Now()
+	droneController.now = func() time.Time { return clock }
+	droneController.TakeOff()
+	fake.Reset()
+
+	// キーリピートによる繰り返し入力は押し続けとみなす
+	for i := 0; i < 3; i++ {
+		droneController.MoveForward()
+		clock = clock.Add(100 * time.Millisecond)
+	}
+	droneController.MoveUp()
+
+	// 前進の最後の入力から猶予時間内なので止めない
+	clock = clock.Add(defaultHoldTimeout - 200*time.Millisecond)
+	droneController.tick(clock)
+	droneController.MoveUp()
+
+	// 前進だけ止まり、上昇は続く
+	clock = clock.Add(200 * time.Millisecond)
+	droneController.tick(clock)
+
+	// 上昇も止まったらホバリング
+	clock = clock.Add(defaultHoldTimeout)
+	droneController.tick(clock)
+	droneController.tick(clock)
+
+	expected := []string{"Forward(20)", "Up(20)", "Forward(0)", "Hover"}
+	if got := fake.Commands(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("コマンド列が不正\n期待: %v\n実際: %v", expected, got)
+	}
+}
+
+// TestDroneControllerStickDecayLoop 自動停止ループでキーを離した後にホバリングすることを確認します
+func TestDroneControllerStickDecayLoop(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := newGroundedController(fake)
+	droneController.SetHoldTimeout(20 * time.Millisecond)
+	droneController.TakeOff()
+
+	droneController.StartStickDecay()
+	defer droneController.StopStickDecay()
+
+	droneController.RotateClockwise()
+	waitUntil(t, "ホバリング", func() bool {
+		commands := fake.Commands()
+		return commands[len(commands)-1] == "Hover"
+	})
+}
+
+// TestDroneControllerSpeedLevels 速度レベルの変更と範囲の制限を確認します
+func TestDroneControllerSpeedLevels(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := newGroundedController(fake)
+	var saved []int
+	droneController.SetSettingsChangedCallback(func(speed int, fastMode bool) {
+		saved = append(saved, speed)
+	})
+	droneController.TakeOff()
+	fake.Reset()
+
+	// 前進中に速度を上げると、動いている軸だけ新しい速度で送り直す
+	droneController.MoveForward()
+	droneController.IncreaseSpeed()
+	droneController.MoveForward() // 押し続け
+	droneController.MoveDown()
+
+	expected := []string{"Forward(20)", "Forward(30)", "Down(30)"}
+	if got := fake.Commands(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("コマンド列が不正\n期待: %v\n実際: %v", expected, got)
+	}
+
+	// 範囲外は丸められ、変化がなければ通知しない
+	droneController.SetSpeed(500)
+	droneController.IncreaseSpeed()
+	if got := droneController.Speed(); got != maxSpeed {
+		t.Errorf("上限: 期待 %d, 実際 %d", maxSpeed, got)
+	}
+	droneController.SetSpeed(0)
+	droneController.DecreaseSpeed()
+	if got := droneController.Speed(); got != minSpeed {
+		t.Errorf("下限: 期待 %d, 実際 %d", minSpeed, got)
+	}
+	if !reflect.DeepEqual(saved, []int{30, 100, 10}) {
+		t.Errorf("設定変更の通知が不正: %v", saved)
+	}
+}
+
+// TestKeyboardSpeedAndModeKeys 速度とモードのキーを確認します
+func TestKeyboardSpeedAndModeKeys(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := NewDroneControllerWithDrone(fake)
+	keyboardHandler := NewKeyboardHandler(droneController, nil)
+
+	// 速度とモードは接続前でも変更できる
+	keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Ch: '+'})
+	keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Ch: '='})
+	keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Ch: '-'})
+	keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Ch: 'f'})
+
+	if got := droneController.Speed(); got != 30 {
+		t.Errorf("速度レベル: 期待 30, 実際 %d", got)
+	}
+	if !droneController.IsFastMode() {
+		t.Error("高速モードになるべき")
+	}
+	if got := fake.Commands(); !reflect.DeepEqual(got, []string{"SetFastMode"}) {
+		t.Errorf("コマンド列が不正: %v", got)
+	}
+}
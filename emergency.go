@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gobot.io/x/gobot/platforms/dji/tello"
+)
+
+// emergencyCommand はモーターを即時停止させるTelloのテキストコマンド
+const emergencyCommand = "emergency"
+
+// emergencyConfirmWindow は非常停止のキーを2回押すまでの制限時間
+const emergencyConfirmWindow = 500 * time.Millisecond
+
+// emergencyConfirmTimeout は非常停止を送ってから、フライトデータでモーターの停止を確認できるまで待つ時間
+const emergencyConfirmTimeout = 1500 * time.Millisecond
+
+// ErrEmergencyUnsupported はドライバーが非常停止のコマンドを送れない
+var ErrEmergencyUnsupported = errors.New("このドローンのドライバーは非常停止に対応していません")
+
+// EmergencyStopper は非常停止（モーターの即時停止）に対応したドローン
+// これを満たさないドライバーでも、CommandSender なら emergency コマンドを送る
+type EmergencyStopper interface {
+	Emergency() error
+}
+
+// CommandSender は文字列のコマンドをそのまま送信できるドローン（tello.Driver が満たす）
+type CommandSender interface {
+	SendCommand(cmd string) error
+}
+
+// 実機ドライバーが文字列のコマンドを送れることをコンパイル時に確認
+var _ CommandSender = (*tello.Driver)(nil)
+
+// Emergency はモーターを即時停止させる（ドローンは落下する）
+// 絡まった・人にぶつかりそうなときの最後の手段で、着陸と違って待たずに止まる
+// 非常停止のコマンドを送れなければ、代わりに着陸させる
+//
+// gobotのバイナリプロトコルには非常停止のメッセージがなく、テキストコマンドに実機が従うかは送信の成否ではわからない
+// そのため即時停止は保証できないことを表示し、フライトデータでモーターの停止を確認してから状態を変える（checkEmergency）
+// 制限時間内に確認できなければ、フライトデータが届かなくても着陸させる（expireEmergency）
+func (dc *DroneController) Emergency() error {
+	var err error
+	switch drone := dc.drone.(type) {
+	case EmergencyStopper:
+		err = drone.Emergency()
+	case CommandSender:
+		err = drone.SendCommand(emergencyCommand)
+	default:
+		err = ErrEmergencyUnsupported
+	}
+	if err != nil {
+		dc.notify("!!! 非常停止に失敗: %v。代わりに着陸します !!!", err)
+		dc.forceLand()
+		return err
+	}
+
+	dc.mu.Lock()
+	dc.emergencySent = dc.now()
+	dc.mu.Unlock()
+	// 停止後に古いスティックの値を送り続けないよう全軸を止める
+	dc.resetSticks()
+
+	dc.notify("!!! 非常停止を送信しました（即時停止は保証されません）。モーターの停止を確認しています !!!")
+	return nil
+}
+
+// checkEmergency は送った非常停止をフライトデータで確認し、確認を待っている間は true を返す
+// 飛行中でなくなったという報告で初めて非常停止の状態にする
+func (dc *DroneController) checkEmergency(fd *tello.FlightData) bool {
+	dc.mu.Lock()
+	if dc.emergencySent.IsZero() {
+		dc.mu.Unlock()
+		return false
+	}
+	if fd.Flying {
+		dc.mu.Unlock()
+		dc.expireEmergency(dc.now())
+		return true
+	}
+	dc.emergencySent = time.Time{}
+	dc.mu.Unlock()
+
+	// 非常停止はどの飛行状態からでも受け付ける
+	dc.apply(EventEmergency)
+	dc.notify("!!! 非常停止: モーターの停止を確認しました !!!")
+	return true
+}
+
+// expireEmergency は非常停止を送ってから制限時間が過ぎてもモーターの停止を確認できなければ、
+// 非常停止は効かなかったとみなして着陸させる（フライトデータが届かない場合に備え、監視ループからも呼ぶ）
+func (dc *DroneController) expireEmergency(now time.Time) {
+	dc.mu.Lock()
+	sent := dc.emergencySent
+	elapsed := now.Sub(sent)
+	if sent.IsZero() || elapsed < emergencyConfirmTimeout {
+		dc.mu.Unlock()
+		return
+	}
+	dc.emergencySent = time.Time{}
+	dc.mu.Unlock()
+
+	dc.notify("!!! 非常停止を確認できません（%.1f秒経ってもモーターの停止が報告されません）。代わりに着陸します !!!", elapsed.Seconds())
+	dc.forceLand()
+}
+
+// EmergencyStopped は最後の離陸以降に非常停止したかどうかを返す
+func (dc *DroneController) EmergencyStopped() bool {
+	return dc.FlightState() == StateEmergency
+}
+
+// confirmEmergency は非常停止のキーが制限時間内に2回押されたら非常停止する
+// 1回目は確認のメッセージを出すだけなので、誤って1回押してもモーターは止まらない
+func (kh *KeyboardHandler) confirmEmergency() {
+	now := kh.now()
+	if kh.emergencyArmed.IsZero() || now.Sub(kh.emergencyArmed) > emergencyConfirmWindow {
+		kh.emergencyArmed = now
+		kh.notify("非常停止するには %s をもう一度押してください（%.1f秒以内。即時停止は保証されず、止まらなければ着陸します）",
+			strings.Join(kh.bindings.Keys(ActionEmergency), "/"), emergencyConfirmWindow.Seconds())
+		return
+	}
+	kh.emergencyArmed = time.Time{}
+	kh.droneController.Emergency()
+}
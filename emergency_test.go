@@ -0,0 +1,167 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nsf/termbox-go"
+	"gobot.io/x/gobot/platforms/dji/tello"
+)
+
+// TestKeyboardEmergencyNeedsTwoPresses 非常停止のキーは制限時間内に2回押したときだけ送信されることを確認します
+func TestKeyboardEmergencyNeedsTwoPresses(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := newGroundedController(fake)
+	keyboardHandler := NewKeyboardHandler(droneController, nil)
+	connectFakeDrone(t, fake, droneController)
+	clock := time.Now()
+	keyboardHandler.now = func() time.Time { return clock }
+	droneController.TakeOff()
+	fake.Reset()
+
+	press := func(ch rune, after time.Duration) {
+		clock = clock.Add(after)
+		keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Ch: ch})
+	}
+
+	// 1回だけ、間隔が空いた2回、間に別のキーを挟んだ2回では止めない
+	press('x', 0)
+	press('x', emergencyConfirmWindow+time.Millisecond)
+	press('e', 100*time.Millisecond)
+	press('x', 100*time.Millisecond)
+	if got := fake.Commands(); !reflect.DeepEqual(got, []string{"Clockwise(20)"}) {
+		t.Fatalf("誤操作で非常停止すべきでない: %v", got)
+	}
+	if !droneController.IsFlying() {
+		t.Fatal("誤操作で飛行状態を変えるべきでない")
+	}
+
+	press('x', 300*time.Millisecond)
+	expected := []string{"Clockwise(20)", `SendCommand("emergency")`, "Hover"}
+	if got := fake.Commands(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("コマンド列が不正\n期待: %v\n実際: %v", expected, got)
+	}
+	// 送っただけではモーターが止まったかわからない
+	if droneController.EmergencyStopped() {
+		t.Error("フライトデータで確認するまで非常停止とみなすべきでない")
+	}
+
+	// 3回目は新しい確認の1回目として扱う
+	press('x', 100*time.Millisecond)
+	if got := fake.Commands(); len(got) != len(expected) {
+		t.Errorf("続けて押しても再送すべきでない: %v", got)
+	}
+
+	// ドローンが飛行中でなくなったと報告したら非常停止の状態にする
+	droneController.reconcileFlying(&tello.FlightData{Flying: true})
+	if droneController.EmergencyStopped() {
+		t.Error("飛行中の報告では非常停止とみなすべきでない")
+	}
+	droneController.reconcileFlying(&tello.FlightData{})
+	if droneController.IsFlying() || !droneController.EmergencyStopped() {
+		t.Error("モーターの停止を確認したら非常停止の状態にすべき")
+	}
+
+	messages := eventMessages(keyboardHandler.Events())
+	if last := messages[len(messages)-1]; !strings.Contains(last, "非常停止: モーターの停止を確認しました") {
+		t.Errorf("非常停止をイベントログに表示すべき: %v", messages)
+	}
+	if line := NewDashboard(droneController, nil, nil, nil).statusLines()[2]; !strings.Contains(line.text, "非常停止") {
+		t.Errorf("ダッシュボードに非常停止を表示すべき: %q", line.text)
+	}
+
+	droneController.TakeOff()
+	if droneController.EmergencyStopped() {
+		t.Error("離陸したら非常停止の表示を解除すべき")
+	}
+}
+
+// TestDroneControllerEmergencyFallsBackToLand 非常停止を送れないドライバーでは着陸することを確認します
+func TestDroneControllerEmergencyFallsBackToLand(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := newGroundedController(struct{ Drone }{fake})
+	droneController.TakeOff()
+	fake.Reset()
+
+	if err := droneController.Emergency(); err != ErrEmergencyUnsupported {
+		t.Errorf("期待 ErrEmergencyUnsupported, 実際 %v", err)
+	}
+	if got := fake.Commands(); !reflect.DeepEqual(got, []string{"Land"}) {
+		t.Errorf("代わりに着陸すべき: %v", got)
+	}
+}
+
+// TestDroneControllerEmergencyNotConfirmed 非常停止を送っても飛び続けている場合は着陸させることを確認します
+func TestDroneControllerEmergencyNotConfirmed(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := newGroundedController(fake)
+	events := NewEventLog(20)
+	droneController.SetEventLog(events)
+	clock := time.Now()
+	droneController.now = func() time.Time { return clock }
+	droneController.TakeOff()
+	clock = clock.Add(flightStateGrace)
+	droneController.reconcileFlying(&tello.FlightData{Flying: true})
+	fake.Reset()
+
+	if err := droneController.Emergency(); err != nil {
+		t.Fatal(err)
+	}
+	clock = clock.Add(emergencyConfirmTimeout - time.Millisecond)
+	droneController.reconcileFlying(&tello.FlightData{Flying: true})
+	if got := fake.Commands(); !reflect.DeepEqual(got, []string{`SendCommand("emergency")`}) {
+		t.Errorf("確認を待つ間は何も送るべきでない: %v", got)
+	}
+
+	clock = clock.Add(time.Millisecond)
+	droneController.reconcileFlying(&tello.FlightData{Flying: true})
+	if got := fake.Commands(); !reflect.DeepEqual(got, []string{`SendCommand("emergency")`, "Land"}) {
+		t.Errorf("飛び続けていれば着陸すべき: %v", got)
+	}
+	if droneController.EmergencyStopped() || droneController.FlightState() != StateLanding {
+		t.Errorf("非常停止の状態にすべきでない: %s", droneController.FlightState())
+	}
+	if messages := eventMessages(events); !strings.Contains(strings.Join(messages, "\n"), "非常停止を確認できません") {
+		t.Errorf("確認できなかったことを通知すべき: %v", messages)
+	}
+}
+
+// TestDroneControllerEmergencyNoFlightData フライトデータが届かなくても、制限時間が過ぎたら監視ループが着陸させることを確認します
+func TestDroneControllerEmergencyNoFlightData(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := newGroundedController(fake)
+	events := NewEventLog(20)
+	droneController.SetEventLog(events)
+	clock := time.Now()
+	droneController.now = func() time.Time { return clock }
+	droneController.TakeOff()
+	fake.Reset()
+
+	if err := droneController.Emergency(); err != nil {
+		t.Fatal(err)
+	}
+	if messages := eventMessages(events); !strings.Contains(messages[len(messages)-1], "即時停止は保証されません") {
+		t.Errorf("即時停止を保証できないことを表示すべき: %v", messages)
+	}
+	droneController.expireEmergency(clock.Add(emergencyConfirmTimeout - time.Millisecond))
+	if got := fake.Commands(); !reflect.DeepEqual(got, []string{`SendCommand("emergency")`}) {
+		t.Errorf("制限時間内は何も送るべきでない: %v", got)
+	}
+
+	clock = clock.Add(emergencyConfirmTimeout)
+	droneController.StartLinkWatchdog()
+	defer droneController.StopLinkWatchdog()
+	waitUntil(t, "代わりの着陸", func() bool { return len(fake.Commands()) == 2 })
+
+	if got := fake.Commands(); !reflect.DeepEqual(got, []string{`SendCommand("emergency")`, "Land"}) {
+		t.Errorf("確認できなければ着陸すべき: %v", got)
+	}
+	if droneController.EmergencyStopped() {
+		t.Error("確認できなければ非常停止の状態にすべきでない")
+	}
+	if messages := eventMessages(events); !strings.Contains(strings.Join(messages, "\n"), "非常停止を確認できません") {
+		t.Errorf("確認できなかったことを通知すべき: %v", messages)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventEntry はイベントログの1行
+type EventEntry struct {
+	Time    time.Time
+	Message string
+}
+
+// EventLog は画面に表示するイベントを保持するリングバッファ
+// io.Writerを実装しているので log.SetOutput の出力先にもできる
+type EventLog struct {
+	mu       sync.Mutex
+	entries  []EventEntry
+	capacity int
+	now      func() time.Time
+}
+
+// NewEventLog は指定件数まで保持するイベントログを作成
+func NewEventLog(capacity int) *EventLog {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &EventLog{
+		capacity: capacity,
+		now:      time.Now,
+	}
+}
+
+// Add はイベントを追加する（古いものから捨てる）
+func (l *EventLog) Add(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, EventEntry{Time: l.now(), Message: fmt.Sprintf(format, args...)})
+	if over := len(l.entries) - l.capacity; over > 0 {
+		l.entries = append(l.entries[:0], l.entries[over:]...)
+	}
+}
+
+// Write はlogパッケージからの出力を1行ずつイベントとして追加する
+func (l *EventLog) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if line != "" {
+			l.Add("%s", line)
+		}
+	}
+	return len(p), nil
+}
+
+// Entries は最新n件のイベントを古い順に返す（nが負なら全件）
+func (l *EventLog) Entries(n int) []EventEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if n > len(l.entries) || n < 0 {
+		n = len(l.entries)
+	}
+	out := make([]EventEntry, n)
+	copy(out, l.entries[len(l.entries)-n:])
+	return out
+}
+
+// notifier はイベントログ（未設定なら標準出力）へメッセージを出す
+type notifier struct {
+	events *EventLog
+}
+
+// SetEventLog はメッセージの出力先を設定する
+func (n *notifier) SetEventLog(events *EventLog) {
+	n.events = events
+}
+
+// notify はメッセージを出力する
+func (n *notifier) notify(format string, args ...interface{}) {
+	if n.events != nil {
+		n.events.Add(format, args...)
+		return
+	}
+	fmt.Printf(format+"\n", args...)
+}
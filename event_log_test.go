@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"testing"
+)
+
+// TestEventLogCapacity 保持件数を超えると古いイベントから捨てられることをテストします
+func TestEventLogCapacity(t *testing.T) {
+	events := NewEventLog(3)
+	for i := 1; i <= 5; i++ {
+		events.Add("イベント %d", i)
+	}
+
+	entries := events.Entries(-1)
+	if len(entries) != 3 {
+		t.Fatalf("保持件数: 期待 3, 実際 %d", len(entries))
+	}
+	if entries[0].Message != "イベント 3" || entries[2].Message != "イベント 5" {
+		t.Errorf("古い順に最新3件が返るべき: %+v", entries)
+	}
+
+	if latest := events.Entries(1); latest[0].Message != "イベント 5" {
+		t.Errorf("最新1件が返るべき: %+v", latest)
+	}
+}
+
+// TestEventLogAsLogOutput logパッケージの出力先として使えることをテストします
+func TestEventLogAsLogOutput(t *testing.T) {
+	events := NewEventLog(10)
+	logger := log.New(events, "", 0)
+	logger.Println("録画開始: test.mov")
+
+	entries := events.Entries(-1)
+	if len(entries) != 1 || entries[0].Message != "録画開始: test.mov" {
+		t.Errorf("ログ出力がイベントとして記録されていない: %+v", entries)
+	}
+}
+
+// TestComponentsNotifyEventLog 各コンポーネントのメッセージがイベントログに集約されることをテストします
+func TestComponentsNotifyEventLog(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := newGroundedController(fake)
+	keyboardHandler := NewKeyboardHandler(droneController, nil)
+
+	droneController.TakeOff()
+
+	entries := keyboardHandler.Events().Entries(-1)
+	if len(entries) == 0 || entries[len(entries)-1].Message != "ドローンが離陸します..." {
+		t.Errorf("離陸メッセージがイベントログにありません: %+v", entries)
+	}
+}
+
+// TestKeyboardHandlerRedirectsLog logの出力を時刻を付けずにイベントログへ流し、停止でフラグを戻すことをテストします
+func TestKeyboardHandlerRedirectsLog(t *testing.T) {
+	flags := log.Flags()
+	defer log.SetFlags(flags)
+	log.SetFlags(log.LstdFlags)
+
+	keyboardHandler := NewKeyboardHandler(nil, nil)
+	keyboardHandler.redirectLog()
+	log.Println("録画開始: test.mov")
+	keyboardHandler.restoreLog()
+
+	entries := keyboardHandler.Events().Entries(-1)
+	if len(entries) == 0 || entries[len(entries)-1].Message != "録画開始: test.mov" {
+		t.Errorf("イベントログの時刻だけを付けるべき: %+v", entries)
+	}
+	if log.Flags() != log.LstdFlags {
+		t.Errorf("停止後はlogのフラグを戻すべき: %d", log.Flags())
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"gobot.io/x/gobot"
+	"gobot.io/x/gobot/platforms/dji/tello"
+)
+
+// FakeDrone は送信されたコマンドを記録するだけのプロセス内ドローン
+// 実機なしでコマンド列（例: "TakeOff", "Forward(20)"）を検証するために使う
+type FakeDrone struct {
+	gobot.Eventer
+	name     string
+	mu       sync.Mutex
+	commands []string
+}
+
+// NewFakeDrone は新しいフェイクドローンを作成
+func NewFakeDrone() *FakeDrone {
+	f := &FakeDrone{
+		Eventer: gobot.NewEventer(),
+		name:    "FakeTello",
+	}
+
+	// tello.Driverと同じイベント名を登録し、Publishでドローン側のイベントを模擬できるようにする
+	for _, event := range []string{
+		tello.ConnectedEvent,
+		tello.FlightDataEvent,
+		tello.TakeoffEvent,
+		tello.LandingEvent,
+		tello.LogEvent,
+		tello.WifiDataEvent,
+		tello.LightStrengthEvent,
+		tello.VideoFrameEvent,
+		PictureDataEvent,
+	} {
+		f.AddEvent(event)
+	}
+
+	return f
+}
+
+// record はコマンドを記録する
+func (f *FakeDrone) record(format string, args ...interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, fmt.Sprintf(format, args...))
+}
+
+// Commands はこれまでに記録されたコマンドのコピーを返す
+func (f *FakeDrone) Commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	commands := make([]string, len(f.commands))
+	copy(commands, f.commands)
+	return commands
+}
+
+// Reset は記録済みのコマンドを消去する
+func (f *FakeDrone) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = nil
+}
+
+// Name はデバイス名を返す
+func (f *FakeDrone) Name() string { return f.name }
+
+// SetName はデバイス名を設定する
+func (f *FakeDrone) SetName(n string) { f.name = n }
+
+// Connection は接続を返す（フェイクには接続がない）
+func (f *FakeDrone) Connection() gobot.Connection { return nil }
+
+// Start はドライバーの開始を記録する
+func (f *FakeDrone) Start() error {
+	f.record("Start")
+	return nil
+}
+
+// Halt はドライバーの停止を記録する
+func (f *FakeDrone) Halt() error {
+	f.record("Halt")
+	return nil
+}
+
+// TakeOff は離陸コマンドを記録する
+func (f *FakeDrone) TakeOff() error {
+	f.record("TakeOff")
+	return nil
+}
+
+// Land は着陸コマンドを記録する
+func (f *FakeDrone) Land() error {
+	f.record("Land")
+	return nil
+}
+
+// Forward は前進コマンドを記録する
+func (f *FakeDrone) Forward(val int) error {
+	f.record("Forward(%d)", val)
+	return nil
+}
+
+// Backward は後退コマンドを記録する
+func (f *FakeDrone) Backward(val int) error {
+	f.record("Backward(%d)", val)
+	return nil
+}
+
+// Left は左移動コマンドを記録する
+func (f *FakeDrone) Left(val int) error {
+	f.record("Left(%d)", val)
+	return nil
+}
+
+// Right は右移動コマンドを記録する
+func (f *FakeDrone) Right(val int) error {
+	f.record("Right(%d)", val)
+	return nil
+}
+
+// Up は上昇コマンドを記録する
+func (f *FakeDrone) Up(val int) error {
+	f.record("Up(%d)", val)
+	return nil
+}
+
+// Down は降下コマンドを記録する
+func (f *FakeDrone) Down(val int) error {
+	f.record("Down(%d)", val)
+	return nil
+}
+
+// Clockwise は右旋回コマンドを記録する
+func (f *FakeDrone) Clockwise(val int) error {
+	f.record("Clockwise(%d)", val)
+	return nil
+}
+
+// CounterClockwise は左旋回コマンドを記録する
+func (f *FakeDrone) CounterClockwise(val int) error {
+	f.record("CounterClockwise(%d)", val)
+	return nil
+}
+
+// Hover はホバリングコマンドを記録する
+func (f *FakeDrone) Hover() {
+	f.record("Hover")
+}
+
+// SetFastMode は高速モードへの切り替えを記録する
+func (f *FakeDrone) SetFastMode() error {
+	f.record("SetFastMode")
+	return nil
+}
+
+// SetSlowMode は低速モードへの切り替えを記録する
+func (f *FakeDrone) SetSlowMode() error {
+	f.record("SetSlowMode")
+	return nil
+}
+
+// StartVideo はビデオ開始コマンドを記録する
+func (f *FakeDrone) StartVideo() error {
+	f.record("StartVideo")
+	return nil
+}
+
+// SetVideoEncoderRate はビットレート設定を記録する
+func (f *FakeDrone) SetVideoEncoderRate(rate tello.VideoBitRate) error {
+	f.record("SetVideoEncoderRate(%d)", rate)
+	return nil
+}
+
+// SetExposure は露出設定を記録する
+func (f *FakeDrone) SetExposure(level int) error {
+	f.record("SetExposure(%d)", level)
+	return nil
+}
+
+// SendCommand は文字列のコマンド（emergency など）を記録する
+func (f *FakeDrone) SendCommand(cmd string) error {
+	f.record("SendCommand(%q)", cmd)
+	return nil
+}
+
+// Reconnect は接続要求の送り直しを記録する
+func (f *FakeDrone) Reconnect() error {
+	f.record("Reconnect")
+	return nil
+}
+
+// TakePicture は写真撮影コマンドを記録する（写真の転送はPublishで模擬する）
+func (f *FakeDrone) TakePicture() error {
+	f.record("TakePicture")
+	return nil
+}
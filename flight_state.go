@@ -0,0 +1,285 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FlightState はドローンの飛行状態
+type FlightState int
+
+// 飛行状態
+const (
+	StateDisconnected FlightState = iota // 接続応答を受信していない
+	StateGrounded                        // 地上で待機している
+	StateTakingOff                       // 離陸コマンドを送り、ドローンが飛行中と報告するのを待っている
+	StateHovering                        // 飛行中で、すべての軸が止まっている
+	StateMoving                          // 飛行中で、いずれかの軸が動いている
+	StateLanding                         // 着陸コマンドを送り、ドローンが地上と報告するのを待っている
+	StateEmergency                       // 非常停止した（地上の報告か次の離陸まで）
+	StateLinkLost                        // 通信が途絶え、ドローンの状態がわからない
+)
+
+// flightStateNames は飛行状態の表示名
+var flightStateNames = map[FlightState]string{
+	StateDisconnected: "未接続",
+	StateGrounded:     "地上",
+	StateTakingOff:    "離陸中",
+	StateHovering:     "ホバリング",
+	StateMoving:       "移動中",
+	StateLanding:      "着陸中",
+	StateEmergency:    "非常停止",
+	StateLinkLost:     "通信途絶",
+}
+
+// String は飛行状態の表示名を返す
+func (s FlightState) String() string {
+	if name, ok := flightStateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("FlightState(%d)", int(s))
+}
+
+// Airborne は機体が飛行していて操作できる状態かどうかを返す（着陸中は含まない）
+func (s FlightState) Airborne() bool {
+	return s == StateTakingOff || s == StateHovering || s == StateMoving
+}
+
+// FlightEvent は飛行状態を変えるきっかけ（自分のコマンドとドローンからの通知）
+type FlightEvent int
+
+// 飛行状態を変えるきっかけ
+const (
+	// 自分のコマンド（遷移表にない状態では拒否する）
+	EventTakeOff   FlightEvent = iota // 離陸コマンド
+	EventLand                         // 着陸コマンド
+	EventMove                         // 移動・旋回の入力
+	EventEmergency                    // 非常停止
+
+	// ドローンからの通知とスティックの状態（遷移表にない状態では無視する）
+	EventConnected      // 接続応答（ConnectedEvent）
+	EventTakeOffStarted // ドローンが離陸を通知（TakeoffEvent）
+	EventLandingStarted // ドローンが着陸を通知（LandingEvent）
+	EventAirborne       // フライトデータが飛行中を報告
+	EventGrounded       // フライトデータが地上を報告
+	EventHover          // すべての軸が止まった
+	EventLinkLost       // ドローンからの受信が途絶えた
+)
+
+// flightEventNames はきっかけの表示名
+var flightEventNames = map[FlightEvent]string{
+	EventTakeOff:        "離陸",
+	EventLand:           "着陸",
+	EventMove:           "移動",
+	EventEmergency:      "非常停止",
+	EventConnected:      "接続応答",
+	EventTakeOffStarted: "離陸の通知",
+	EventLandingStarted: "着陸の通知",
+	EventAirborne:       "飛行中の報告",
+	EventGrounded:       "地上の報告",
+	EventHover:          "全軸停止",
+	EventLinkLost:       "通信途絶",
+}
+
+// String はきっかけの表示名を返す
+func (e FlightEvent) String() string {
+	if name, ok := flightEventNames[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("FlightEvent(%d)", int(e))
+}
+
+// isCommand は自分のコマンドかどうかを返す
+func (e FlightEvent) isCommand() bool {
+	return e <= EventEmergency
+}
+
+// flightStateGrace は離着陸コマンド直後、ドローンの報告で飛行状態を上書きしない猶予時間
+// モーターの始動や接地までの間、フライトデータは古い状態を報告し続けるため
+const flightStateGrace = 3 * time.Second
+
+// ErrIllegalTransition は現在の飛行状態では受け付けないコマンド
+var ErrIllegalTransition = errors.New("現在の飛行状態では実行できません")
+
+// flightKey は遷移表の検索キー
+type flightKey struct {
+	from  FlightState
+	event FlightEvent
+}
+
+// flightRule は遷移表の1項目
+type flightRule struct {
+	to FlightState
+	// afterGrace は離着陸コマンドから猶予時間が過ぎるまで適用しない
+	// モーターの始動や接地までの間、フライトデータは古い状態を報告し続けるため
+	afterGrace bool
+}
+
+// flightTransitions は飛行状態の遷移表
+// 遷移元と同じ遷移先の項目は、状態を変えずにコマンドを受け付けることを表す
+var flightTransitions = map[flightKey]flightRule{
+	// 接続
+	{StateDisconnected, EventConnected}: {to: StateGrounded},
+	{StateDisconnected, EventGrounded}:  {to: StateGrounded},
+	{StateDisconnected, EventAirborne}:  {to: StateHovering},
+
+	// 離陸
+	{StateGrounded, EventTakeOff}:         {to: StateTakingOff},
+	{StateEmergency, EventTakeOff}:        {to: StateTakingOff},
+	{StateGrounded, EventTakeOffStarted}:  {to: StateTakingOff},
+	{StateGrounded, EventAirborne}:        {to: StateHovering, afterGrace: true},
+	{StateTakingOff, EventAirborne}:       {to: StateHovering},
+	{StateTakingOff, EventGrounded}:       {to: StateGrounded, afterGrace: true},
+	{StateTakingOff, EventMove}:           {to: StateTakingOff},
+	{StateTakingOff, EventHover}:          {to: StateTakingOff},
+	{StateTakingOff, EventTakeOffStarted}: {to: StateTakingOff},
+
+	// 飛行中
+	{StateHovering, EventMove}:     {to: StateMoving},
+	{StateMoving, EventMove}:       {to: StateMoving},
+	{StateMoving, EventHover}:      {to: StateHovering},
+	{StateHovering, EventGrounded}: {to: StateGrounded, afterGrace: true},
+	{StateMoving, EventGrounded}:   {to: StateGrounded, afterGrace: true},
+
+	// 着陸
+	{StateTakingOff, EventLand}:          {to: StateLanding},
+	{StateHovering, EventLand}:           {to: StateLanding},
+	{StateMoving, EventLand}:             {to: StateLanding},
+	{StateHovering, EventLandingStarted}: {to: StateLanding},
+	{StateMoving, EventLandingStarted}:   {to: StateLanding},
+	{StateLanding, EventGrounded}:        {to: StateGrounded},
+	{StateLanding, EventAirborne}:        {to: StateHovering, afterGrace: true},
+	{StateLanding, EventLandingStarted}:  {to: StateLanding},
+
+	// 非常停止はどの状態からでも受け付ける（飛行していなくても送る）
+	{StateDisconnected, EventEmergency}: {to: StateEmergency},
+	{StateGrounded, EventEmergency}:     {to: StateEmergency},
+	{StateTakingOff, EventEmergency}:    {to: StateEmergency},
+	{StateHovering, EventEmergency}:     {to: StateEmergency},
+	{StateMoving, EventEmergency}:       {to: StateEmergency},
+	{StateLanding, EventEmergency}:      {to: StateEmergency},
+	{StateEmergency, EventEmergency}:    {to: StateEmergency},
+	// 非常停止が届かずに飛び続けている場合は、ドローンの報告に従う
+	{StateEmergency, EventAirborne}: {to: StateHovering, afterGrace: true},
+	// 停止した機体が地上にあると報告したら、表示を残すため猶予時間が過ぎてから地上に戻す
+	{StateEmergency, EventGrounded}: {to: StateGrounded, afterGrace: true},
+
+	// 通信途絶（接続応答では戻さず、回復後のフライトデータで飛行中か地上かを決める）
+	{StateGrounded, EventLinkLost}:  {to: StateLinkLost},
+	{StateTakingOff, EventLinkLost}: {to: StateLinkLost},
+	{StateHovering, EventLinkLost}:  {to: StateLinkLost},
+	{StateMoving, EventLinkLost}:    {to: StateLinkLost},
+	{StateLanding, EventLinkLost}:   {to: StateLinkLost},
+	{StateEmergency, EventLinkLost}: {to: StateLinkLost},
+	{StateLinkLost, EventAirborne}:  {to: StateHovering},
+	{StateLinkLost, EventGrounded}:  {to: StateGrounded},
+	{StateLinkLost, EventLand}:      {to: StateLanding},
+	{StateLinkLost, EventEmergency}: {to: StateEmergency},
+}
+
+// FlightTransition は飛行状態の遷移
+type FlightTransition struct {
+	From  FlightState
+	To    FlightState
+	Event FlightEvent
+	At    time.Time
+}
+
+// flightSubscriberBuffer は購読者ごとに溜めておく遷移の数
+const flightSubscriberBuffer = 32
+
+// flightSubscribers は飛行状態の遷移の購読者
+type flightSubscribers struct {
+	mu       sync.Mutex
+	channels map[<-chan FlightTransition]chan FlightTransition
+}
+
+// FlightState は現在の飛行状態を返す
+func (dc *DroneController) FlightState() FlightState {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return dc.state
+}
+
+// canApply はコマンドを現在の飛行状態で受け付けるかどうかを返す
+func (dc *DroneController) canApply(event FlightEvent) bool {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	_, ok := flightTransitions[flightKey{dc.state, event}]
+	return ok
+}
+
+// apply は遷移表に従って飛行状態を変え、変わったら購読者へ通知する
+// 遷移表にないコマンドはErrIllegalTransitionを返し、ドローンからの通知は無視する
+func (dc *DroneController) apply(event FlightEvent) error {
+	dc.mu.Lock()
+	from := dc.state
+	rule, ok := flightTransitions[flightKey{from, event}]
+	if !ok {
+		dc.mu.Unlock()
+		if event.isCommand() {
+			return fmt.Errorf("%w（状態: %s、操作: %s）", ErrIllegalTransition, from, event)
+		}
+		return nil
+	}
+
+	now := dc.now()
+	if rule.afterGrace && now.Sub(dc.lastFlightCommand) < flightStateGrace {
+		dc.mu.Unlock()
+		return nil
+	}
+	if event == EventTakeOff || event == EventLand || event == EventEmergency {
+		dc.lastFlightCommand = now
+	}
+	dc.state = rule.to
+	if rule.to == from {
+		dc.mu.Unlock()
+		return nil
+	}
+
+	// 遷移の順序を保つため、状態を変えたまま購読者へ通知する
+	dc.flightSubs.mu.Lock()
+	dc.mu.Unlock()
+	defer dc.flightSubs.mu.Unlock()
+
+	transition := FlightTransition{From: from, To: rule.to, Event: event, At: now}
+	for _, sub := range dc.flightSubs.channels {
+		// 受信が追いつかない購読者は古い遷移から捨てる
+		select {
+		case sub <- transition:
+		default:
+			select {
+			case <-sub:
+			default:
+			}
+			sub <- transition
+		}
+	}
+	return nil
+}
+
+// SubscribeFlightState は飛行状態が変わるたびに遷移を受け取るチャネルを返す
+func (dc *DroneController) SubscribeFlightState() <-chan FlightTransition {
+	dc.flightSubs.mu.Lock()
+	defer dc.flightSubs.mu.Unlock()
+
+	if dc.flightSubs.channels == nil {
+		dc.flightSubs.channels = make(map[<-chan FlightTransition]chan FlightTransition)
+	}
+	ch := make(chan FlightTransition, flightSubscriberBuffer)
+	dc.flightSubs.channels[ch] = ch
+	return ch
+}
+
+// UnsubscribeFlightState は購読を解除し、チャネルを閉じる
+func (dc *DroneController) UnsubscribeFlightState(ch <-chan FlightTransition) {
+	dc.flightSubs.mu.Lock()
+	defer dc.flightSubs.mu.Unlock()
+
+	if sub, ok := dc.flightSubs.channels[ch]; ok {
+		delete(dc.flightSubs.channels, ch)
+		close(sub)
+	}
+}
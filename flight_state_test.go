@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"gobot.io/x/gobot/platforms/dji/tello"
+)
+
+// allFlightStates と allFlightEvents は遷移表の網羅に使う一覧です
+var (
+	allFlightStates = []FlightState{
+		StateDisconnected, StateGrounded, StateTakingOff, StateHovering, StateMoving, StateLanding, StateEmergency, StateLinkLost,
+	}
+	allFlightEvents = []FlightEvent{
+		EventTakeOff, EventLand, EventMove, EventEmergency,
+		EventConnected, EventTakeOffStarted, EventLandingStarted, EventAirborne, EventGrounded, EventHover, EventLinkLost,
+	}
+)
+
+// receivedTransitions は購読チャネルに届いている遷移をすべて取り出します
+func receivedTransitions(ch <-chan FlightTransition) []FlightTransition {
+	var transitions []FlightTransition
+	for {
+		select {
+		case transition := <-ch:
+			transitions = append(transitions, transition)
+		default:
+			return transitions
+		}
+	}
+}
+
+// TestFlightStateTransitionTable 遷移表のすべての項目で遷移し、変化を購読者へ通知することを確認します
+func TestFlightStateTransitionTable(t *testing.T) {
+	for key, rule := range flightTransitions {
+		droneController := NewDroneControllerWithDrone(NewFakeDrone())
+		clock := time.Now()
+		droneController.now = func() time.Time { return clock }
+		droneController.state = key.from
+		droneController.lastFlightCommand = clock
+		updates := droneController.SubscribeFlightState()
+
+		name := key.from.String() + "+" + key.event.String()
+		if rule.afterGrace {
+			// 離着陸コマンドの直後は、ドローンの報告で状態を変えない
+			if err := droneController.apply(key.event); err != nil {
+				t.Errorf("%s: 猶予時間内の報告でエラー: %v", name, err)
+			}
+			if got := droneController.FlightState(); got != key.from {
+				t.Errorf("%s: 猶予時間内は %s のままであるべき: %s", name, key.from, got)
+			}
+			clock = clock.Add(flightStateGrace)
+		}
+
+		if err := droneController.apply(key.event); err != nil {
+			t.Errorf("%s: 遷移表にある遷移が拒否された: %v", name, err)
+		}
+		if got := droneController.FlightState(); got != rule.to {
+			t.Errorf("%s: 期待 %s, 実際 %s", name, rule.to, got)
+		}
+
+		var expected []FlightTransition
+		if rule.to != key.from {
+			expected = []FlightTransition{{From: key.from, To: rule.to, Event: key.event, At: clock}}
+		}
+		if got := receivedTransitions(updates); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: 通知が不正\n期待: %+v\n実際: %+v", name, expected, got)
+		}
+	}
+}
+
+// TestFlightStateRejectsIllegalTransitions 遷移表にないコマンドは拒否し、ドローンからの通知は無視することを確認します
+func TestFlightStateRejectsIllegalTransitions(t *testing.T) {
+	for _, from := range allFlightStates {
+		for _, event := range allFlightEvents {
+			if _, ok := flightTransitions[flightKey{from, event}]; ok {
+				continue
+			}
+			droneController := NewDroneControllerWithDrone(NewFakeDrone())
+			droneController.state = from
+			updates := droneController.SubscribeFlightState()
+
+			err := droneController.apply(event)
+			if event.isCommand() && !errors.Is(err, ErrIllegalTransition) {
+				t.Errorf("%s+%s: 拒否すべき: %v", from, event, err)
+			}
+			if !event.isCommand() && err != nil {
+				t.Errorf("%s+%s: ドローンからの通知は無視すべき: %v", from, event, err)
+			}
+			if got := droneController.FlightState(); got != from {
+				t.Errorf("%s+%s: 状態を変えるべきでない: %s", from, event, got)
+			}
+			if got := receivedTransitions(updates); len(got) != 0 {
+				t.Errorf("%s+%s: 通知すべきでない: %+v", from, event, got)
+			}
+		}
+	}
+}
+
+// TestFlightStateFollowsCommandsAndDrone コマンドとドローンのイベントで飛行状態が進むことを確認します
+func TestFlightStateFollowsCommandsAndDrone(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := NewDroneControllerWithDrone(fake)
+	events := NewEventLog(20)
+	droneController.SetEventLog(events)
+	clock := time.Now()
+	droneController.now = func() time.Time { return clock }
+	updates := droneController.SubscribeFlightState()
+	defer droneController.UnsubscribeFlightState(updates)
+
+	// 接続応答の前は離陸させない
+	droneController.TakeOff()
+	if got := fake.Commands(); len(got) != 0 {
+		t.Errorf("未接続では離陸コマンドを送信すべきでない: %v", got)
+	}
+
+	droneController.apply(EventConnected)
+	droneController.Land()
+	if got := fake.Commands(); len(got) != 0 {
+		t.Errorf("地上では着陸コマンドを送信すべきでない: %v", got)
+	}
+
+	// 離陸コマンドを送っただけでは離陸中で、ドローンが飛行中と報告したらホバリング
+	droneController.TakeOffOrLand()
+	if got := droneController.FlightState(); got != StateTakingOff {
+		t.Errorf("離陸コマンドの後は離陸中であるべき: %s", got)
+	}
+	droneController.reconcileFlying(&tello.FlightData{Flying: true})
+	droneController.MoveForward()
+	droneController.tick(clock.Add(defaultHoldTimeout))
+
+	// 着陸コマンドの後は着陸中で、ドローンが地上と報告したら地上
+	droneController.TakeOffOrLand()
+	droneController.MoveForward()
+	droneController.reconcileFlying(&tello.FlightData{OnGround: true})
+
+	expected := []string{"TakeOff", "Forward(20)", "Hover", "Land"}
+	if got := fake.Commands(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("コマンド列が不正\n期待: %v\n実際: %v", expected, got)
+	}
+
+	var path []FlightState
+	for _, transition := range receivedTransitions(updates) {
+		path = append(path, transition.To)
+	}
+	expectedPath := []FlightState{StateGrounded, StateTakingOff, StateHovering, StateMoving, StateHovering, StateLanding, StateGrounded}
+	if !reflect.DeepEqual(path, expectedPath) {
+		t.Errorf("遷移が不正\n期待: %v\n実際: %v", expectedPath, path)
+	}
+	if messages := eventMessages(events); len(messages) == 0 || messages[0] != "離陸できません: 現在の飛行状態では実行できません（状態: 未接続、操作: 離陸）" {
+		t.Errorf("拒否した理由を通知すべき: %v", messages)
+	}
+}
+
+// TestFlightStateDriverEvents ドライバーの離着陸イベントで飛行状態が変わることを確認します
+func TestFlightStateDriverEvents(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := newGroundedController(fake)
+
+	fake.Publish(tello.TakeoffEvent, nil)
+	waitUntil(t, "離陸の通知", func() bool { return droneController.FlightState() == StateTakingOff })
+	droneController.reconcileFlying(&tello.FlightData{Flying: true})
+
+	fake.Publish(tello.LandingEvent, nil)
+	waitUntil(t, "着陸の通知", func() bool { return droneController.FlightState() == StateLanding })
+}
+
+// TestFlightStateLinkLostAndEmergencyStop 通信途絶と非常停止の後、ドローンの報告で飛行状態が戻ることを確認します
+func TestFlightStateLinkLostAndEmergencyStop(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := newGroundedController(fake)
+	clock := time.Now()
+	droneController.now = func() time.Time { return clock }
+	droneController.SetLinkPolicy(time.Second, 0)
+
+	// 通信途絶中は離陸できず、回復後に地上と報告されたら地上に戻る（接続応答では戻さない）
+	droneController.packetReceived()
+	droneController.checkLink(clock.Add(2 * time.Second))
+	if got := droneController.FlightState(); got != StateLinkLost {
+		t.Fatalf("通信途絶で通信途絶の状態になるべき: %s", got)
+	}
+	if err := droneController.apply(EventTakeOff); !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("通信途絶中の離陸は拒否すべき: %v", err)
+	}
+	droneController.apply(EventConnected)
+	if got := droneController.FlightState(); got != StateLinkLost {
+		t.Errorf("接続応答では通信途絶のままであるべき: %s", got)
+	}
+	droneController.packetReceived()
+	droneController.reconcileFlying(&tello.FlightData{OnGround: true})
+	if got := droneController.FlightState(); got != StateGrounded {
+		t.Fatalf("回復後に地上と報告されたら地上に戻るべき: %s", got)
+	}
+
+	// 非常停止の後、地上と報告されたら猶予時間が過ぎてから地上に戻る
+	droneController.apply(EventEmergency)
+	droneController.reconcileFlying(&tello.FlightData{OnGround: true})
+	if got := droneController.FlightState(); got != StateEmergency {
+		t.Errorf("猶予時間内は非常停止のままであるべき: %s", got)
+	}
+	clock = clock.Add(flightStateGrace)
+	droneController.reconcileFlying(&tello.FlightData{OnGround: true})
+	if got := droneController.FlightState(); got != StateGrounded {
+		t.Errorf("非常停止の後に地上と報告されたら地上に戻るべき: %s", got)
+	}
+}
+
+// TestFlightStateUnsubscribe 購読を解除するとチャネルが閉じ、以降の遷移は届かないことを確認します
+func TestFlightStateUnsubscribe(t *testing.T) {
+	droneController := NewDroneControllerWithDrone(NewFakeDrone())
+	updates := droneController.SubscribeFlightState()
+	droneController.UnsubscribeFlightState(updates)
+	droneController.UnsubscribeFlightState(updates)
+
+	droneController.apply(EventConnected)
+	if _, ok := <-updates; ok {
+		t.Error("購読を解除したチャネルは閉じるべき")
+	}
+}
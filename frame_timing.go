@@ -0,0 +1,53 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// gapThreshold はフレーム間隔がこの倍率を超えたら欠落とみなす
+const gapThreshold = 1.5
+
+// GapStats はフレームの受信間隔から推定したフレームの欠落
+type GapStats struct {
+	Count   int           // 間隔が空いた箇所の数
+	Dropped int           // 欠落したと推定されるフレーム数
+	Longest time.Duration // 最も長かった間隔
+}
+
+// frameTiming はフレームの受信時刻から各フレームの長さを求め、欠落を数える
+// 受信時刻は単調時計で比べるので、システム時刻が変わっても影響を受けない
+// Wi-Fiでまとめて届いたフレームは最短でも規定の長さの半分とし、その分は後のフレームで取り戻す
+type frameTiming struct {
+	first    time.Time // 最初のフレームの受信時刻
+	position uint64    // 最後のフレームの開始位置（firstからのvideoTimescale単位）
+	gaps     GapStats
+}
+
+// stamp はフレームの受信時刻を記録し、直前のフレームの長さ（videoTimescale単位）を返す
+// 最初のフレームや受信時刻が分からない場合は、nominal（SPSのフレームレートから求めた長さ）を返す
+func (t *frameTiming) stamp(at time.Time, nominal uint32) uint32 {
+	if at.IsZero() || t.first.IsZero() {
+		t.first = at
+		return nominal
+	}
+
+	target := uint64(math.Round(at.Sub(t.first).Seconds() * videoTimescale))
+	delta := nominal / 2
+	if target > t.position+uint64(delta) {
+		delta = uint32(target - t.position)
+	}
+	t.position += uint64(delta)
+
+	if float64(delta) > float64(nominal)*gapThreshold {
+		t.gaps.Count++
+		t.gaps.Dropped += int(math.Round(float64(delta)/float64(nominal))) - 1
+		t.gaps.Longest = max(t.gaps.Longest, ticksToDuration(uint64(delta)))
+	}
+	return delta
+}
+
+// ticksToDuration はvideoTimescale単位の長さを時間に変換する
+func ticksToDuration(ticks uint64) time.Duration {
+	return time.Duration(ticks) * time.Second / videoTimescale
+}
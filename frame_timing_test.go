@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestFrameTiming 受信時刻からフレームの長さと欠落を求めることをテストします
+func TestFrameTiming(t *testing.T) {
+	const nominal = videoTimescale / 30
+	var timing frameTiming
+	start := time.Unix(1000, 0)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	if got := timing.stamp(time.Time{}, nominal); got != nominal {
+		t.Errorf("受信時刻がなければ規定の長さ: %d", got)
+	}
+	timing.stamp(at(0), nominal)
+	if got := timing.stamp(at(40), nominal); got != 3600 {
+		t.Errorf("40ms後のフレーム: 期待 3600, 実際 %d", got)
+	}
+
+	// 200ms空いたら欠落として数える
+	if got := timing.stamp(at(240), nominal); got != 18000 {
+		t.Errorf("欠落後のフレーム: 期待 18000, 実際 %d", got)
+	}
+	if gaps := timing.gaps; gaps.Count != 1 || gaps.Dropped != 5 || gaps.Longest != 200*time.Millisecond {
+		t.Errorf("欠落: %+v", gaps)
+	}
+
+	// まとめて届いたフレームは半分の長さにし、次のフレームで取り戻す
+	if got := timing.stamp(at(240), nominal); got != nominal/2 {
+		t.Errorf("同時に届いたフレーム: 期待 %d, 実際 %d", nominal/2, got)
+	}
+	if got := timing.stamp(at(306), nominal); got != 66*90-nominal/2 {
+		t.Errorf("次のフレーム: 期待 %d, 実際 %d", 66*90-nominal/2, got)
+	}
+	if timing.position != 306*90 {
+		t.Errorf("受信時刻とずれています: %d", timing.position)
+	}
+	if timing.gaps.Count != 1 {
+		t.Errorf("まとめて届いたフレームを欠落として数えています: %+v", timing.gaps)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 高度制限の動作
+const (
+	geofenceSlowZone       = 0.5             // 天井までこの高さ（m）を切ったら上昇を最低速度に抑える
+	geofenceOvershoot      = 0.3             // 天井をこの高さ（m）以上超えたら降下させる
+	geofenceDescentSpeed   = defaultSpeed    // 天井を超えたときに降下する速度レベル
+	geofenceNotifyInterval = 1 * time.Second // キーリピートで同じ拒否メッセージを繰り返さない間隔
+)
+
+// GeofenceStatus は高度・飛行時間の制限の状態
+type GeofenceStatus struct {
+	Ceiling       float64       // 天井（m、0なら制限しない）
+	MinLateral    float64       // 水平移動できる最低高度（m、0なら制限しない）
+	MaxFlightTime time.Duration // 最大飛行時間（0なら制限しない）
+
+	AtCeiling          bool // 飛行中に天井に達していて上昇できない
+	BelowLateral       bool // 飛行中に最低高度より低く水平移動できない
+	FlightTimeExceeded bool // 最大飛行時間を超えた（戻って着陸するよう促している）
+}
+
+// Enabled はいずれかの制限が有効かどうかを返す
+func (s GeofenceStatus) Enabled() bool {
+	return s.Ceiling > 0 || s.MinLateral > 0 || s.MaxFlightTime > 0
+}
+
+// geofence は高度と飛行時間の制限
+type geofence struct {
+	mu            sync.Mutex
+	ceiling       float64
+	minLateral    float64
+	maxFlightTime time.Duration
+
+	exceeded     bool      // 飛行時間の超過を通知済み
+	descending   bool      // 天井を超えたため降下させている
+	lastRejected time.Time // 最後に操作を拒否して通知した時刻
+	lastReason   string    // 最後に通知した拒否の理由
+
+	// 監視ループ
+	running bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// SetGeofence は天井・水平移動できる最低高度（m）と最大飛行時間を設定する（0なら制限しない）
+func (dc *DroneController) SetGeofence(ceiling, minLateral float64, maxFlightTime time.Duration) {
+	dc.fence.mu.Lock()
+	defer dc.fence.mu.Unlock()
+
+	dc.fence.ceiling = ceiling
+	dc.fence.minLateral = minLateral
+	dc.fence.maxFlightTime = maxFlightTime
+}
+
+// GeofenceStatus は高度・飛行時間の制限の状態を返す
+func (dc *DroneController) GeofenceStatus() GeofenceStatus {
+	s := dc.telemetry.Snapshot()
+	flying := dc.IsFlying()
+
+	dc.fence.mu.Lock()
+	defer dc.fence.mu.Unlock()
+
+	status := GeofenceStatus{
+		Ceiling:            dc.fence.ceiling,
+		MinLateral:         dc.fence.minLateral,
+		MaxFlightTime:      dc.fence.maxFlightTime,
+		FlightTimeExceeded: dc.fence.exceeded,
+	}
+	if s.HasFlightData && flying {
+		status.AtCeiling = dc.fence.ceiling > 0 && s.Height >= dc.fence.ceiling
+		status.BelowLateral = dc.fence.minLateral > 0 && s.Height < dc.fence.minLateral
+	}
+	return status
+}
+
+// limitMove は高度の制限に従って移動の速度を決める
+// 制限に反する移動は理由を返し（速度は0）、天井の近くでは上昇の速度を抑える
+func (dc *DroneController) limitMove(axis stickAxis, direction, speed int) (int, string) {
+	s := dc.telemetry.Snapshot()
+	if !s.HasFlightData {
+		return speed, ""
+	}
+
+	dc.fence.mu.Lock()
+	defer dc.fence.mu.Unlock()
+
+	switch {
+	case axis == axisThrottle && direction > 0 && dc.fence.ceiling > 0:
+		if s.Height >= dc.fence.ceiling {
+			return 0, fmt.Sprintf("天井（%.1f m）に達しているため上昇できません（高度 %.1f m）", dc.fence.ceiling, s.Height)
+		}
+		if dc.fence.ceiling-s.Height < geofenceSlowZone {
+			return min(speed, minSpeed), ""
+		}
+	case (axis == axisPitch || axis == axisRoll) && dc.fence.minLateral > 0:
+		if s.Height < dc.fence.minLateral {
+			return 0, fmt.Sprintf("高度 %.1f m では水平移動できません（%.1f m 以上で移動できます）", s.Height, dc.fence.minLateral)
+		}
+	}
+	return speed, ""
+}
+
+// rejectMove は制限に反する操作を通知する（キーリピートで繰り返し通知しない）
+func (dc *DroneController) rejectMove(reason string) {
+	now := dc.now()
+
+	dc.fence.mu.Lock()
+	quiet := reason == dc.fence.lastReason && now.Sub(dc.fence.lastRejected) < geofenceNotifyInterval
+	if !quiet {
+		dc.fence.lastRejected = now
+		dc.fence.lastReason = reason
+	}
+	dc.fence.mu.Unlock()
+
+	if !quiet {
+		dc.notify("%s", reason)
+	}
+}
+
+// checkGeofence はテレメトリーの高度と飛行時間を調べ、制限を超えた操作を止める
+// 上昇中に天井に達したら上昇を止め、天井を大きく超えたら降下させる
+// 最大飛行時間を超えたら、戻って着陸するよう一度だけ通知する
+func (dc *DroneController) checkGeofence(s TelemetrySnapshot) {
+	if !s.HasFlightData {
+		return
+	}
+	flying := dc.IsFlying()
+
+	dc.fence.mu.Lock()
+	ceiling, minLateral := dc.fence.ceiling, dc.fence.minLateral
+	atCeiling := flying && ceiling > 0 && s.Height >= ceiling
+	overshoot := atCeiling && s.Height >= ceiling+geofenceOvershoot
+	startDescent := overshoot && !dc.fence.descending
+	dc.fence.descending = overshoot
+	belowLateral := flying && minLateral > 0 && s.Height < minLateral
+	exceeded := flying && dc.fence.maxFlightTime > 0 && s.FlyTime >= dc.fence.maxFlightTime
+	startExceeded := exceeded && !dc.fence.exceeded
+	if !flying {
+		// 着陸したら次の飛行のために通知をやり直す
+		dc.fence.exceeded = false
+	} else if exceeded {
+		dc.fence.exceeded = true
+	}
+	maxFlightTime := dc.fence.maxFlightTime
+	dc.fence.mu.Unlock()
+
+	var stopped []string
+	dc.sticks.mu.Lock()
+	if atCeiling && dc.sticks.value[axisThrottle] > 0 {
+		dc.sticks.value[axisThrottle] = 0
+		dc.sendAxis(axisThrottle, 0)
+		stopped = append(stopped, fmt.Sprintf("天井（%.1f m）に達したため上昇を止めました", ceiling))
+	}
+	if overshoot {
+		// 自動停止ループが入力の途絶えた軸を止めるので、超えている間は降下を続ける
+		dc.sticks.value[axisThrottle] = -geofenceDescentSpeed
+		dc.sticks.lastInput[axisThrottle] = dc.now()
+		if startDescent {
+			dc.sendAxis(axisThrottle, -geofenceDescentSpeed)
+		}
+	}
+	lateral := false
+	for _, axis := range []stickAxis{axisPitch, axisRoll} {
+		if belowLateral && dc.sticks.value[axis] != 0 {
+			dc.sticks.value[axis] = 0
+			dc.sendAxis(axis, 0)
+			lateral = true
+		}
+	}
+	if lateral {
+		stopped = append(stopped, fmt.Sprintf("高度が %.1f m を下回ったため水平移動を止めました", minLateral))
+	}
+	idle := dc.sticks.value == [numAxes]int{}
+	dc.sticks.mu.Unlock()
+
+	if len(stopped) > 0 && idle {
+		dc.apply(EventHover)
+	}
+
+	for _, message := range stopped {
+		dc.notify("%s", message)
+	}
+	if startDescent {
+		dc.notify("天井（%.1f m）を超えています（高度 %.1f m）。降下します", ceiling, s.Height)
+	}
+	if startExceeded {
+		dc.notify("飛行時間が上限の %s を超えました。戻って着陸してください", formatElapsed(maxFlightTime))
+	}
+}
+
+// StartGeofence はテレメトリーを購読して高度・飛行時間の制限を監視するループを開始する
+func (dc *DroneController) StartGeofence() {
+	dc.fence.mu.Lock()
+	defer dc.fence.mu.Unlock()
+
+	if dc.fence.running {
+		return
+	}
+	dc.fence.running = true
+	dc.fence.stop = make(chan struct{})
+	dc.fence.done = make(chan struct{})
+
+	updates := dc.telemetry.Subscribe()
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		defer dc.telemetry.Unsubscribe(updates)
+
+		for {
+			select {
+			case <-stop:
+				return
+			case s := <-updates:
+				dc.checkGeofence(s)
+			}
+		}
+	}(dc.fence.stop, dc.fence.done)
+}
+
+// StopGeofence は高度・飛行時間の制限の監視ループを停止する（複数回呼んでも安全）
+func (dc *DroneController) StopGeofence() {
+	dc.fence.mu.Lock()
+	if !dc.fence.running {
+		dc.fence.mu.Unlock()
+		return
+	}
+	dc.fence.running = false
+	close(dc.fence.stop)
+	done := dc.fence.done
+	dc.fence.mu.Unlock()
+
+	<-done
+}
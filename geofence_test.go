@@ -0,0 +1,118 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gobot.io/x/gobot/platforms/dji/tello"
+)
+
+// flyAt はテレメトリーの高度（dm）と飛行時間（100ms単位）を設定します
+func flyAt(droneController *DroneController, heightDM int16, flyTime int16) TelemetrySnapshot {
+	droneController.Telemetry().updateFlightData(&tello.FlightData{Flying: true, BatteryPercentage: 90, Height: heightDM, FlyTime: flyTime})
+	return droneController.Telemetry().Snapshot()
+}
+
+// TestGeofenceRejectsAndClampsMoves 天井と最低高度に反する移動を拒否し、天井の近くでは上昇を遅くすることを確認します
+func TestGeofenceRejectsAndClampsMoves(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := newGroundedController(fake)
+	events := NewEventLog(20)
+	droneController.SetEventLog(events)
+	droneController.SetGeofence(3.0, 0.5, 0)
+	droneController.TakeOff()
+	fake.Reset()
+
+	// 最低高度より低いと水平移動できないが、旋回はできる
+	flyAt(droneController, 3, 0)
+	droneController.MoveForward()
+	droneController.MoveLeft() // キーリピートでは通知を繰り返さない
+	droneController.RotateClockwise()
+
+	// 天井の近くでは最低速度で上昇し、天井に達したら上昇できない
+	flyAt(droneController, 27, 0)
+	droneController.MoveUp()
+	flyAt(droneController, 30, 0)
+	droneController.resetSticks()
+	droneController.MoveUp()
+	droneController.MoveDown()
+
+	expected := []string{"Clockwise(20)", "Up(10)", "Hover", "Down(20)"}
+	if got := fake.Commands(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("コマンド列が不正\n期待: %v\n実際: %v", expected, got)
+	}
+
+	var rejected []string
+	for _, message := range eventMessages(events) {
+		if strings.Contains(message, "できません") {
+			rejected = append(rejected, message)
+		}
+	}
+	if len(rejected) != 2 || !strings.Contains(rejected[0], "水平移動できません") || !strings.Contains(rejected[1], "上昇できません") {
+		t.Errorf("拒否の通知が不正: %v", rejected)
+	}
+	if status := droneController.GeofenceStatus(); !status.AtCeiling || status.BelowLateral {
+		t.Errorf("制限の状態が不正: %+v", status)
+	}
+}
+
+// TestGeofenceTelemetryEnforcement 上昇中に天井に達したら止め、大きく超えたら降下することを確認します
+func TestGeofenceTelemetryEnforcement(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := newGroundedController(fake)
+	droneController.SetGeofence(3.0, 0.5, 0)
+	droneController.TakeOff()
+
+	flyAt(droneController, 10, 0)
+	droneController.MoveUp()
+	droneController.MoveForward()
+	fake.Reset()
+
+	droneController.checkGeofence(flyAt(droneController, 30, 0))
+	droneController.checkGeofence(flyAt(droneController, 34, 0))
+	droneController.checkGeofence(flyAt(droneController, 35, 0)) // 降下中は送り直さない
+	droneController.checkGeofence(flyAt(droneController, 4, 0))
+
+	expected := []string{"Up(0)", "Down(20)", "Forward(0)"}
+	if got := fake.Commands(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("コマンド列が不正\n期待: %v\n実際: %v", expected, got)
+	}
+}
+
+// TestGeofenceFlightTime 最大飛行時間を超えたら一度だけ着陸を促し、ダッシュボードに表示することを確認します
+func TestGeofenceFlightTime(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := newGroundedController(fake)
+	events := NewEventLog(20)
+	droneController.SetEventLog(events)
+	droneController.SetGeofence(0, 0, time.Minute)
+	droneController.TakeOff()
+
+	for _, flyTime := range []int16{590, 600, 610} {
+		droneController.checkGeofence(flyAt(droneController, 10, flyTime))
+	}
+	var prompts []string
+	for _, message := range eventMessages(events) {
+		if strings.Contains(message, "着陸してください") {
+			prompts = append(prompts, message)
+		}
+	}
+	if len(prompts) != 1 {
+		t.Errorf("着陸を一度だけ促すべき: %v", prompts)
+	}
+	if line := geofenceLine(droneController.GeofenceStatus()); !strings.Contains(line.text, "飛行時間 01:00 まで") || !strings.Contains(line.text, "飛行時間超過") {
+		t.Errorf("ダッシュボードの表示が不正: %q", line.text)
+	}
+
+	// 着陸したら解除される（自動では着陸しない）
+	if got := fake.Commands(); !reflect.DeepEqual(got, []string{"TakeOff"}) {
+		t.Errorf("飛行時間の超過ではコマンドを送信すべきでない: %v", got)
+	}
+	droneController.Land()
+	droneController.checkGeofence(droneController.Telemetry().Snapshot())
+	if droneController.GeofenceStatus().FlightTimeExceeded {
+		t.Error("着陸したら飛行時間の超過を解除すべき")
+	}
+}
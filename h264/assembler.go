@@ -0,0 +1,111 @@
+package h264
+
+import "time"
+
+// AccessUnit は1フレーム分のNALユニット（スタートコードなし）
+type AccessUnit struct {
+	NALs     [][]byte
+	Keyframe bool      // IDRスライスを含む
+	Time     time.Time // 受信した時刻（単調時計を含む、不明ならゼロ値）
+}
+
+// Assembler はTelloのビデオパケット（Annex-Bバイト列の断片）から
+// NALユニットを取り出し、フレーム単位（アクセスユニット）にまとめる
+// パケットの区切りとNALの区切りは一致しないため、未完了のNALは次の入力まで保持する
+type Assembler struct {
+	buf      []byte // 最後のスタートコード以降の未処理データ
+	scanned  int    // bufのうちスタートコードを探し終えた位置
+	started  bool   // bufの先頭がスタートコードか
+	current  AccessUnit
+	hasSlice bool
+}
+
+// Write は受信データを追加し、完成したアクセスユニットを返す
+func (a *Assembler) Write(data []byte) []AccessUnit {
+	a.buf = append(a.buf, data...)
+
+	var units []AccessUnit
+	for {
+		pos := FindStartCode(a.buf, a.scanned)
+		if pos < 0 {
+			break
+		}
+		if a.started {
+			units = a.addNAL(a.buf[3:pos], units)
+		}
+		// 次のNALの先頭（スタートコード）を基準にする
+		a.buf = append(a.buf[:0], a.buf[pos:]...)
+		a.scanned = 3
+		a.started = true
+	}
+
+	if !a.started {
+		// 最初のスタートコードまでのデータ（途中から受信したNALなど）は捨てる
+		if len(a.buf) > 2 {
+			a.buf = append(a.buf[:0], a.buf[len(a.buf)-2:]...)
+		}
+		a.scanned = 0
+	} else {
+		// スタートコードがデータの境界をまたぐ場合に備えて2バイト戻す
+		a.scanned = max(3, len(a.buf)-2)
+	}
+	return units
+}
+
+// Flush は保持しているデータを最後のNALとして処理し、残りのアクセスユニットを返す
+func (a *Assembler) Flush() []AccessUnit {
+	var units []AccessUnit
+	if a.started {
+		units = a.addNAL(a.buf[3:], units)
+	}
+	a.buf = nil
+	a.scanned = 0
+	a.started = false
+
+	if a.hasSlice {
+		units = append(units, a.current)
+	}
+	a.current = AccessUnit{}
+	a.hasSlice = false
+	return units
+}
+
+// addNAL はNALユニットを現在のアクセスユニットに追加する
+// 新しいフレームの始まりを検出したら、それまでのアクセスユニットを完成させる
+func (a *Assembler) addNAL(nal []byte, units []AccessUnit) []AccessUnit {
+	// 4バイトのスタートコードの先頭の0は前のNALの末尾に含まれる
+	for len(nal) > 0 && nal[len(nal)-1] == 0 {
+		nal = nal[:len(nal)-1]
+	}
+	if len(nal) == 0 {
+		return units
+	}
+
+	if a.hasSlice && StartsAccessUnit(nal) {
+		units = append(units, a.current)
+		a.current = AccessUnit{}
+		a.hasSlice = false
+	}
+
+	a.current.NALs = append(a.current.NALs, append([]byte(nil), nal...))
+	switch TypeOf(nal) {
+	case NALIDR:
+		a.current.Keyframe = true
+		a.hasSlice = true
+	case NALSlice:
+		a.hasSlice = true
+	}
+	return units
+}
+
+// StartsAccessUnit はスライスの後に来たNALが新しいフレームの始まりかどうかを返す
+func StartsAccessUnit(nal []byte) bool {
+	switch t := TypeOf(nal); {
+	case t == NALAUD, t == NALSPS, t == NALPPS, t == NALSEI:
+		return true
+	case t.IsSlice():
+		// first_mb_in_slice が0（ue(v)の先頭ビットが1）なら新しいピクチャ
+		return len(nal) > 1 && nal[1]&0x80 != 0
+	}
+	return false
+}
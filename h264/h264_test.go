@@ -0,0 +1,218 @@
+package h264
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestSplitAnnexB 3バイト・4バイトのスタートコードで区切られたNALを取り出せることをテストします
+func TestSplitAnnexB(t *testing.T) {
+	data := []byte{
+		0x12, 0x34, // スタートコードより前のデータは捨てる
+		0, 0, 0, 1, 0x67, 0x42,
+		0, 0, 1, 0x68, 0xce,
+		0, 0, 0, 1, 0x65, 0x88, 0x00, 0x00, 0x03, 0x01,
+	}
+	nals := SplitAnnexB(data)
+	if len(nals) != 3 {
+		t.Fatalf("NAL数: 期待 3, 実際 %d", len(nals))
+	}
+	types := []NALType{NALSPS, NALPPS, NALIDR}
+	for i, nal := range nals {
+		if TypeOf(nal) != types[i] {
+			t.Errorf("NAL %d の種類: 期待 %v, 実際 %v", i, types[i], TypeOf(nal))
+		}
+	}
+	if !bytes.Equal(nals[2], []byte{0x65, 0x88, 0x00, 0x00, 0x03, 0x01}) {
+		t.Errorf("最後のNALが不正: % x", nals[2])
+	}
+	if !NALIDR.IsSlice() || NALSPS.IsSlice() {
+		t.Error("IsSliceの判定が不正")
+	}
+}
+
+// TestAssembler NALやスタートコードがパケット境界をまたいでもフレーム単位にまとまることをテストします
+func TestAssembler(t *testing.T) {
+	stream := []byte{
+		0, 0, 0, 1, 0x09, 0xf0, // AUD
+		0, 0, 0, 1, 0x67, 0x42, 0xc0, 0x28, // SPS
+		0, 0, 1, 0x68, 0xce, // PPS
+		0, 0, 1, 0x65, 0x88, 0x01, // IDR（first_mb_in_slice=0）
+		0, 0, 1, 0x65, 0x20, 0x02, // 同じピクチャの2番目のスライス
+		0, 0, 0, 1, 0x41, 0x9a, 0x03, // 次のピクチャ
+		0, 0, 1, 0x41, 0x9a, 0x04, // 次のピクチャ
+	}
+
+	// 1バイトずつ渡しても結果は同じになる
+	var assembler Assembler
+	var units []AccessUnit
+	for i := range stream {
+		units = append(units, assembler.Write(stream[i:i+1])...)
+	}
+	units = append(units, assembler.Flush()...)
+
+	if len(units) != 3 {
+		t.Fatalf("アクセスユニット数: 期待 3, 実際 %d", len(units))
+	}
+	if len(units[0].NALs) != 5 || !units[0].Keyframe {
+		t.Errorf("最初のアクセスユニットはAUD・SPS・PPS・2スライスのキーフレーム: %x", units[0].NALs)
+	}
+	if !bytes.Equal(units[1].NALs[0], []byte{0x41, 0x9a, 0x03}) || units[1].Keyframe {
+		t.Errorf("2番目のアクセスユニットが不正: %x", units[1].NALs)
+	}
+	if !bytes.Equal(units[2].NALs[0], []byte{0x41, 0x9a, 0x04}) {
+		t.Errorf("最後のアクセスユニットはFlushで返るべき: %x", units[2].NALs)
+	}
+}
+
+// spsWriter はテスト用のSPSを組み立てます
+type spsWriter struct {
+	buf   []byte
+	nbits int
+}
+
+func (w *spsWriter) bits(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.nbits%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 == 1 {
+			w.buf[len(w.buf)-1] |= 0x80 >> (w.nbits % 8)
+		}
+		w.nbits++
+	}
+}
+
+func (w *spsWriter) ue(v uint64) {
+	v++
+	n := 0
+	for x := v; x > 1; x >>= 1 {
+		n++
+	}
+	w.bits(0, n)
+	w.bits(v, n+1)
+}
+
+// nal はrbsp_trailing_bitsを付け、エミュレーション防止バイトを入れたNALを返します
+func (w *spsWriter) nal() []byte {
+	w.bits(1, 1)
+	for w.nbits%8 != 0 {
+		w.bits(0, 1)
+	}
+	out := []byte{0x67}
+	zeros := 0
+	for _, b := range w.buf {
+		if zeros >= 2 && b <= 3 {
+			out = append(out, 3)
+			zeros = 0
+		}
+		out = append(out, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
+
+// TestParseSPSHighProfileCropped High Profile・クロッピング・VUIタイミング付きのSPSを解析できることをテストします
+func TestParseSPSHighProfileCropped(t *testing.T) {
+	w := &spsWriter{}
+	w.bits(100, 8) // profile_idc (High)
+	w.bits(0, 8)
+	w.bits(40, 8) // level_idc 4.0
+	w.ue(0)       // seq_parameter_set_id
+	w.ue(1)       // chroma_format_idc (4:2:0)
+	w.ue(0)       // bit_depth_luma_minus8
+	w.ue(0)       // bit_depth_chroma_minus8
+	w.bits(0, 1)  // qpprime_y_zero_transform_bypass_flag
+	w.bits(1, 1)  // seq_scaling_matrix_present_flag
+	w.bits(1, 1)  // scaling_list_present_flag[0]
+	for i := 0; i < 16; i++ {
+		w.ue(0) // delta_scale = 0（se(0)）
+	}
+	w.bits(0, 7) // 残りのscaling_list_present_flag
+	w.ue(0)      // log2_max_frame_num_minus4
+	w.ue(0)      // pic_order_cnt_type
+	w.ue(2)      // log2_max_pic_order_cnt_lsb_minus4
+	w.ue(4)      // max_num_ref_frames
+	w.bits(0, 1) // gaps_in_frame_num_value_allowed_flag
+	w.ue(119)    // pic_width_in_mbs_minus1 (1920)
+	w.ue(67)     // pic_height_in_map_units_minus1 (1088)
+	w.bits(1, 1) // frame_mbs_only_flag
+	w.bits(1, 1) // direct_8x8_inference_flag
+	w.bits(1, 1) // frame_cropping_flag
+	w.ue(0)      // left
+	w.ue(0)      // right
+	w.ue(0)      // top
+	w.ue(4)      // bottom（2ピクセル単位で8ピクセル）
+	w.bits(1, 1) // vui_parameters_present_flag
+	w.bits(1, 1) // aspect_ratio_info_present_flag
+	w.bits(255, 8)
+	w.bits(1, 16)
+	w.bits(1, 16)
+	w.bits(0, 1) // overscan_info_present_flag
+	w.bits(1, 1) // video_signal_type_present_flag
+	w.bits(5, 3)
+	w.bits(0, 1)
+	w.bits(1, 1) // colour_description_present_flag
+	w.bits(0x010101, 24)
+	w.bits(0, 1) // chroma_loc_info_present_flag
+	w.bits(1, 1) // timing_info_present_flag
+	w.bits(1001, 32)
+	w.bits(60000, 32)
+	w.bits(1, 1) // fixed_frame_rate_flag
+
+	sps, err := ParseSPS(w.nal())
+	if err != nil {
+		t.Fatalf("SPSを解析できません: %v", err)
+	}
+	if sps.Width != 1920 || sps.Height != 1080 {
+		t.Errorf("解像度: 期待 1920x1080, 実際 %dx%d", sps.Width, sps.Height)
+	}
+	if sps.ProfileName() != "High" || sps.Level() != "4.0" {
+		t.Errorf("プロファイル/レベルが不正: %s@%s", sps.ProfileName(), sps.Level())
+	}
+	if fps := sps.FrameRate(); fps < 29.96 || fps > 29.98 || !sps.FixedFrameRate {
+		t.Errorf("フレームレート: 期待 29.97, 実際 %v", fps)
+	}
+	if got := sps.String(); got != "1920x1080 High@4.0 29.97fps" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+// TestParseSPSErrors 途中で切れたSPSやSPS以外のNALがエラーになることをテストします
+func TestParseSPSErrors(t *testing.T) {
+	w := &spsWriter{}
+	w.bits(66, 8)
+	w.bits(0xc0, 8)
+	w.bits(30, 8)
+	w.ue(0)
+	w.ue(0)
+	w.ue(2)
+	w.ue(1)
+	w.bits(0, 1)
+	w.ue(59)
+	w.ue(44)
+	w.bits(1, 1) // frame_mbs_only_flag
+	w.bits(1, 1)
+	w.bits(0, 1)
+	w.bits(0, 1) // VUIなし
+	nal := w.nal()
+
+	sps, err := ParseSPS(nal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sps.Width != 960 || sps.Height != 720 || sps.FrameRate() != 0 || sps.ProfileName() != "Constrained Baseline" {
+		t.Errorf("SPSの内容が不正: %v", sps)
+	}
+
+	if _, err := ParseSPS(nal[:6]); err != ErrTruncated {
+		t.Errorf("途中で切れたSPSは ErrTruncated: %v", err)
+	}
+	if _, err := ParseSPS([]byte{0x65, 0x88}); err == nil {
+		t.Error("SPS以外のNALはエラーにすべき")
+	}
+}
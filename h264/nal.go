@@ -0,0 +1,92 @@
+// Package h264 はTelloの映像（H.264 Annex-Bストリーム）を解析する
+// NALユニットの分割・種類の判定、フレーム単位へのまとめ、SPSの解析を行う
+package h264
+
+import "fmt"
+
+// NALType はNALユニットの種類
+type NALType byte
+
+// NALユニットタイプ
+const (
+	NALSlice NALType = 1 // 非IDRスライス
+	NALIDR   NALType = 5 // IDRスライス（キーフレーム）
+	NALSEI   NALType = 6
+	NALSPS   NALType = 7
+	NALPPS   NALType = 8
+	NALAUD   NALType = 9 // アクセスユニットデリミタ
+)
+
+// TypeOf はNALユニットの種類を返す（空なら0）
+func TypeOf(nal []byte) NALType {
+	if len(nal) == 0 {
+		return 0
+	}
+	return NALType(nal[0] & 0x1f)
+}
+
+// IsSlice はスライス（映像データ）かどうかを返す
+func (t NALType) IsSlice() bool {
+	return t == NALSlice || t == NALIDR
+}
+
+// String はNALユニットタイプの名前を返す
+func (t NALType) String() string {
+	switch t {
+	case NALSlice:
+		return "非IDRスライス"
+	case NALIDR:
+		return "IDRスライス"
+	case NALSEI:
+		return "SEI"
+	case NALSPS:
+		return "SPS"
+	case NALPPS:
+		return "PPS"
+	case NALAUD:
+		return "AUD"
+	}
+	return fmt.Sprintf("NAL(%d)", byte(t))
+}
+
+// FindStartCode はfrom以降で最初のスタートコード(00 00 01)の位置を返す（なければ-1）
+func FindStartCode(data []byte, from int) int {
+	for i := from; i+2 < len(data); i++ {
+		if data[i+2] > 1 {
+			i += 2
+			continue
+		}
+		if data[i] == 0 && data[i+1] == 0 && data[i+2] == 1 {
+			return i
+		}
+	}
+	return -1
+}
+
+// SplitAnnexB はAnnex-Bバイト列をNALユニット（スタートコードなし）に分割する
+// 返すスライスは元のデータを参照する
+func SplitAnnexB(data []byte) [][]byte {
+	var nals [][]byte
+	start := -1
+	for pos := FindStartCode(data, 0); pos >= 0; pos = FindStartCode(data, pos+3) {
+		if start >= 0 {
+			nals = appendTrimmed(nals, data[start:pos])
+		}
+		start = pos + 3
+	}
+	if start >= 0 {
+		nals = appendTrimmed(nals, data[start:])
+	}
+	return nals
+}
+
+// appendTrimmed は末尾の0（4バイトのスタートコードの先頭）を除いたNALを追加する
+func appendTrimmed(nals [][]byte, nal []byte) [][]byte {
+	for len(nal) > 0 && nal[len(nal)-1] == 0 {
+		nal = nal[:len(nal)-1]
+	}
+	if len(nal) == 0 {
+		return nals
+	}
+	return append(nals, nal)
+}
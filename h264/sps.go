@@ -0,0 +1,297 @@
+package h264
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTruncated はNALユニットが途中で終わっている
+var ErrTruncated = errors.New("h264: NALユニットが途中で終わっています")
+
+// SPS はシーケンスパラメータセットから読み取った映像の情報
+type SPS struct {
+	ProfileIDC      uint8
+	ConstraintFlags uint8 // constraint_set0〜5_flag
+	LevelIDC        uint8
+	ID              uint
+	ChromaFormatIDC uint
+	FrameMBsOnly    bool
+
+	// Width, Height はクロッピング後の表示サイズ（ピクセル）
+	Width  int
+	Height int
+
+	// VUIのタイミング情報（TimingInfoPresentがfalseなら0）
+	TimingInfoPresent bool
+	NumUnitsInTick    uint32
+	TimeScale         uint32
+	FixedFrameRate    bool
+}
+
+// highProfiles はchroma_format_idcなどの追加フィールドを持つプロファイル
+var highProfiles = map[uint8]bool{
+	100: true, 110: true, 122: true, 244: true, 44: true,
+	83: true, 86: true, 118: true, 128: true, 138: true, 139: true, 134: true, 135: true,
+}
+
+// ParseSPS はSPSのNALユニット（ヘッダー付き、スタートコードなし）を解析する
+// VUIはタイミング情報までを読み、HRDパラメータ以降は読まない
+func ParseSPS(nal []byte) (*SPS, error) {
+	if TypeOf(nal) != NALSPS {
+		return nil, fmt.Errorf("h264: SPSではありません: %v", TypeOf(nal))
+	}
+	r := newBitReader(nal[1:])
+	sps := &SPS{
+		ProfileIDC:      uint8(r.bits(8)),
+		ConstraintFlags: uint8(r.bits(8)),
+		LevelIDC:        uint8(r.bits(8)),
+		ID:              r.ue(),
+		ChromaFormatIDC: 1,
+	}
+
+	separateColourPlane := false
+	if highProfiles[sps.ProfileIDC] {
+		sps.ChromaFormatIDC = r.ue()
+		if sps.ChromaFormatIDC == 3 {
+			separateColourPlane = r.flag()
+		}
+		r.ue()        // bit_depth_luma_minus8
+		r.ue()        // bit_depth_chroma_minus8
+		r.flag()      // qpprime_y_zero_transform_bypass_flag
+		if r.flag() { // seq_scaling_matrix_present_flag
+			lists := 8
+			if sps.ChromaFormatIDC == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if !r.flag() {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				r.skipScalingList(size)
+			}
+		}
+	}
+
+	r.ue()          // log2_max_frame_num_minus4
+	switch r.ue() { // pic_order_cnt_type
+	case 0:
+		r.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.flag() // delta_pic_order_always_zero_flag
+		r.se()   // offset_for_non_ref_pic
+		r.se()   // offset_for_top_to_bottom_field
+		for n := r.ue(); n > 0 && r.err == nil; n-- {
+			r.se() // offset_for_ref_frame
+		}
+	}
+	r.ue()   // max_num_ref_frames
+	r.flag() // gaps_in_frame_num_value_allowed_flag
+
+	widthMBs := int(r.ue()) + 1
+	heightMapUnits := int(r.ue()) + 1
+	sps.FrameMBsOnly = r.flag()
+	if !sps.FrameMBsOnly {
+		r.flag() // mb_adaptive_frame_field_flag
+	}
+	r.flag() // direct_8x8_inference_flag
+
+	frameHeightFactor := 1
+	if !sps.FrameMBsOnly {
+		frameHeightFactor = 2
+	}
+	sps.Width = widthMBs * 16
+	sps.Height = heightMapUnits * 16 * frameHeightFactor
+
+	if r.flag() { // frame_cropping_flag
+		left, right, top, bottom := int(r.ue()), int(r.ue()), int(r.ue()), int(r.ue())
+		cropX, cropY := 1, frameHeightFactor
+		if sps.ChromaFormatIDC != 0 && !separateColourPlane {
+			subWidth, subHeight := 2, 2
+			switch sps.ChromaFormatIDC {
+			case 2:
+				subHeight = 1
+			case 3:
+				subWidth, subHeight = 1, 1
+			}
+			cropX, cropY = subWidth, subHeight*frameHeightFactor
+		}
+		sps.Width -= cropX * (left + right)
+		sps.Height -= cropY * (top + bottom)
+	}
+
+	if r.flag() { // vui_parameters_present_flag
+		r.readTiming(sps)
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	if sps.Width <= 0 || sps.Height <= 0 {
+		return nil, fmt.Errorf("h264: SPSの解像度が不正です: %dx%d", sps.Width, sps.Height)
+	}
+	return sps, nil
+}
+
+// readTiming はVUIのタイミング情報までを読み取る
+func (r *bitReader) readTiming(sps *SPS) {
+	if r.flag() { // aspect_ratio_info_present_flag
+		if r.bits(8) == 255 { // Extended_SAR
+			r.bits(16)
+			r.bits(16)
+		}
+	}
+	if r.flag() { // overscan_info_present_flag
+		r.flag()
+	}
+	if r.flag() { // video_signal_type_present_flag
+		r.bits(4) // video_format, video_full_range_flag
+		if r.flag() {
+			r.bits(24) // colour_primaries, transfer_characteristics, matrix_coefficients
+		}
+	}
+	if r.flag() { // chroma_loc_info_present_flag
+		r.ue()
+		r.ue()
+	}
+	if r.flag() { // timing_info_present_flag
+		sps.NumUnitsInTick = uint32(r.bits(32))
+		sps.TimeScale = uint32(r.bits(32))
+		sps.FixedFrameRate = r.flag()
+		sps.TimingInfoPresent = r.err == nil && sps.NumUnitsInTick > 0 && sps.TimeScale > 0
+	}
+}
+
+// FrameRate はVUIのタイミング情報から求めたフレームレートを返す（情報がなければ0）
+// time_scaleはフィールド単位なので、1フレームは2ティック
+func (s *SPS) FrameRate() float64 {
+	if !s.TimingInfoPresent {
+		return 0
+	}
+	return float64(s.TimeScale) / float64(2*s.NumUnitsInTick)
+}
+
+// ProfileName はプロファイル名を返す
+func (s *SPS) ProfileName() string {
+	switch s.ProfileIDC {
+	case 66:
+		if s.ConstraintFlags&0x40 != 0 {
+			return "Constrained Baseline"
+		}
+		return "Baseline"
+	case 77:
+		return "Main"
+	case 88:
+		return "Extended"
+	case 100:
+		return "High"
+	case 110:
+		return "High 10"
+	case 122:
+		return "High 4:2:2"
+	case 244:
+		return "High 4:4:4"
+	}
+	return fmt.Sprintf("Profile %d", s.ProfileIDC)
+}
+
+// Level はレベルを "4.0" の形式で返す
+func (s *SPS) Level() string {
+	if s.LevelIDC == 11 && s.ConstraintFlags&0x10 != 0 && s.ProfileIDC != 100 {
+		return "1b"
+	}
+	return fmt.Sprintf("%d.%d", s.LevelIDC/10, s.LevelIDC%10)
+}
+
+// String は解像度・プロファイル・レベル・フレームレートをまとめた文字列を返す
+func (s *SPS) String() string {
+	text := fmt.Sprintf("%dx%d %s@%s", s.Width, s.Height, s.ProfileName(), s.Level())
+	if fps := s.FrameRate(); fps > 0 {
+		text += fmt.Sprintf(" %.4gfps", fps)
+	}
+	return text
+}
+
+// bitReader はエミュレーション防止バイトを除いたRBSPをビット単位で読む
+// 途中でデータが尽きたらerrを設定し、以降は0を返す
+type bitReader struct {
+	data []byte
+	pos  int // 読み取ったビット数
+	err  error
+}
+
+// newBitReader はエミュレーション防止バイト(00 00 03の03)を取り除いて読み取りを始める
+func newBitReader(ebsp []byte) *bitReader {
+	rbsp := make([]byte, 0, len(ebsp))
+	zeros := 0
+	for _, b := range ebsp {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+		rbsp = append(rbsp, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return &bitReader{data: rbsp}
+}
+
+// bits はnビット（最大32）を読む
+func (r *bitReader) bits(n int) uint64 {
+	var v uint64
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.data)*8 {
+			r.err = ErrTruncated
+			return 0
+		}
+		v = v<<1 | uint64(r.data[r.pos/8]>>(7-r.pos%8)&1)
+		r.pos++
+	}
+	return v
+}
+
+// flag は1ビットを読む
+func (r *bitReader) flag() bool {
+	return r.bits(1) == 1
+}
+
+// ue は符号なし指数ゴロム符号 ue(v) を読む
+func (r *bitReader) ue() uint {
+	zeros := 0
+	for r.bits(1) == 0 {
+		if r.err != nil || zeros >= 31 {
+			r.err = ErrTruncated
+			return 0
+		}
+		zeros++
+	}
+	return uint(1<<zeros - 1 + r.bits(zeros))
+}
+
+// se は符号付き指数ゴロム符号 se(v) を読む
+func (r *bitReader) se() int {
+	v := int(r.ue())
+	if v%2 == 1 {
+		return (v + 1) / 2
+	}
+	return -v / 2
+}
+
+// skipScalingList はscaling_listを読み飛ばす
+func (r *bitReader) skipScalingList(size int) {
+	last, next := 8, 8
+	for i := 0; i < size && r.err == nil; i++ {
+		if next != 0 {
+			next = (last + r.se() + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+}
@@ -1,30 +1,72 @@
 package main
 
 import (
-	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/nsf/termbox-go"
 )
 
 // KeyboardHandler はキーボード入力を処理するクラス
 type KeyboardHandler struct {
+	notifier
 	droneController *DroneController
 	cameraViewer    *CameraViewer
 	isRunning       bool
 	shutdownCallback func() // 終了時のコールバック関数
+	events          *EventLog
+	dashboard       *Dashboard
+	bindings        *KeyBindings
+
+	// 非常停止の確認（1回目に押した時刻）
+	emergencyArmed time.Time
+	now            func() time.Time
+
+	// logの出力をイベントログへ切り替える前のフラグ（Stopで戻す。logMuで保護）
+	logMu         sync.Mutex
+	logFlags      int
+	logRedirected bool
 }
 
 // NewKeyboardHandler は新しいキーボードハンドラーを作成
+// 各コンポーネントのメッセージは画面のイベントログへ集約される
 func NewKeyboardHandler(droneController *DroneController, cameraViewer *CameraViewer) *KeyboardHandler {
-	return &KeyboardHandler{
+	events := NewEventLog(200)
+	kh := &KeyboardHandler{
 		droneController: droneController,
 		cameraViewer:    cameraViewer,
 		isRunning:       false,
 		shutdownCallback: func() { os.Exit(1) }, // デフォルトの終了処理
+		events:          events,
+		bindings:        DefaultKeyBindings(),
+		now:             time.Now,
+	}
+	// キー凡例は現在のキー割り当てから作成する
+	kh.dashboard = NewDashboard(droneController, cameraViewer, events, func() []HelpEntry { return kh.bindings.Help() })
+
+	kh.SetEventLog(events)
+	if droneController != nil {
+		droneController.SetEventLog(events)
+	}
+	if cameraViewer != nil {
+		cameraViewer.SetEventLog(events)
+	}
+	return kh
+}
+
+// Events は画面に表示しているイベントログを返す
+func (kh *KeyboardHandler) Events() *EventLog {
+	return kh.events
+}
+
+// SetKeyBindings はキー割り当てを設定
+func (kh *KeyboardHandler) SetKeyBindings(bindings *KeyBindings) {
+	if bindings != nil {
+		kh.bindings = bindings
 	}
 }
 
@@ -47,13 +89,10 @@ func (kh *KeyboardHandler) Start() error {
 	// シグナルハンドリングを設定
 	kh.setupSignalHandling()
 
-	fmt.Println("キーボードコントロール開始:")
-	fmt.Println("W/A/S/D: 前進/左/後退/右")
-	fmt.Println("Space: 上昇")
-	fmt.Println("Z: 降下")
-	fmt.Println("Escape: 離陸/着陸")
-	fmt.Println("L: 録画 開始/停止")
-	fmt.Println("Q: 終了")
+	// logの出力も画面のイベントログへ流し、termboxの画面を崩さないようにする
+	kh.redirectLog()
+	kh.notify("キーボードコントロール開始")
+	kh.dashboard.Start()
 
 	go kh.handleKeyboard()
 	return nil
@@ -74,7 +113,34 @@ func (kh *KeyboardHandler) setupSignalHandling() {
 // Stop はキーボードハンドラーを停止
 func (kh *KeyboardHandler) Stop() {
 	kh.isRunning = false
+	kh.dashboard.Stop()
 	termbox.Close()
+	kh.restoreLog()
+}
+
+// redirectLog はlogの出力をイベントログへ切り替える
+// イベントログが時刻を付けるので、時刻が二重にならないようlogのフラグは外す
+func (kh *KeyboardHandler) redirectLog() {
+	kh.logMu.Lock()
+	defer kh.logMu.Unlock()
+	if kh.logRedirected {
+		return
+	}
+	kh.logFlags = log.Flags()
+	kh.logRedirected = true
+	log.SetFlags(0)
+	log.SetOutput(kh.events)
+}
+
+// restoreLog はlogの出力先を標準エラーに、フラグを切り替える前に戻す
+func (kh *KeyboardHandler) restoreLog() {
+	kh.logMu.Lock()
+	defer kh.logMu.Unlock()
+	log.SetOutput(os.Stderr)
+	if kh.logRedirected {
+		log.SetFlags(kh.logFlags)
+		kh.logRedirected = false
+	}
 }
 
 // handleKeyboard はキーボード入力を処理
@@ -83,65 +149,127 @@ func (kh *KeyboardHandler) handleKeyboard() {
 		switch ev := termbox.PollEvent(); ev.Type {
 		case termbox.EventKey:
 			kh.processKey(ev)
+		case termbox.EventResize:
+			kh.dashboard.Redraw()
 		case termbox.EventError:
 			// エラーをログに出力し、グレースフルシャットダウン
 			log.Printf("Termboxイベントエラー: %v", ev.Err)
-			fmt.Println("\nキーボードイベントエラーが発生しました。プログラムを終了します...")
+			kh.notify("キーボードイベントエラーが発生しました。プログラムを終了します...")
 			kh.gracefulShutdown()
 			return
 		}
 	}
 }
 
+// flightControlsEnabled は飛行操作キーを受け付けるかどうかを返す
+// 接続応答とフライトデータを受信するまでは、実在しないドローンへの離陸を防ぐため無効
+func (kh *KeyboardHandler) flightControlsEnabled() bool {
+	if kh.droneController == nil {
+		return false
+	}
+	if !kh.droneController.IsLinkReady() {
+		kh.notify("ドローンとの接続が確認できていないため、飛行操作は無効です")
+		return false
+	}
+	// 通信途絶中のコマンドはドローンに届かず、回復したときに古い操作が反映されてしまう
+	if kh.droneController.IsLinkLost() {
+		kh.notify("ドローンとの通信が途絶えているため、飛行操作は無効です")
+		return false
+	}
+	return true
+}
+
 // processKey はキー入力を処理
 func (kh *KeyboardHandler) processKey(ev termbox.Event) {
-	switch ev.Key {
-	case termbox.KeyEsc:
-		// Escapeキー: 離陸/着陸
-		kh.droneController.TakeOffOrLand()
-
-	case termbox.KeySpace:
-		// スペースキー: 上昇
-		kh.droneController.MoveUp()
-
-	case termbox.KeyCtrlC:
-		// Ctrl+C: 終了
-		fmt.Println("\nプログラムを終了します...")
-		kh.gracefulShutdown()
+	action, ok := kh.bindings.Lookup(ev)
+	if !ok {
+		return
+	}
+	// 非常停止のキーの間に別の操作をしたら確認を取り消す
+	if action != ActionEmergency {
+		kh.emergencyArmed = time.Time{}
 	}
 
-	// 通常のキー入力
-	switch ev.Ch {
-	case 'w', 'W':
-		// W: 前進
-		kh.droneController.MoveForward()
+	switch action {
+	case ActionTakeOffLand:
+		if kh.flightControlsEnabled() {
+			kh.droneController.TakeOffOrLand()
+		}
 
-	case 's', 'S':
-		// S: 後退
-		kh.droneController.MoveBackward()
+	case ActionForward:
+		if kh.flightControlsEnabled() {
+			kh.droneController.MoveForward()
+		}
 
-	case 'a', 'A':
-		// A: 左移動
-		kh.droneController.MoveLeft()
+	case ActionBackward:
+		if kh.flightControlsEnabled() {
+			kh.droneController.MoveBackward()
+		}
+
+	case ActionLeft:
+		if kh.flightControlsEnabled() {
+			kh.droneController.MoveLeft()
+		}
+
+	case ActionRight:
+		if kh.flightControlsEnabled() {
+			kh.droneController.MoveRight()
+		}
+
+	case ActionUp:
+		if kh.flightControlsEnabled() {
+			kh.droneController.MoveUp()
+		}
+
+	case ActionDown:
+		if kh.flightControlsEnabled() {
+			kh.droneController.MoveDown()
+		}
+
+	case ActionRotateCW:
+		if kh.flightControlsEnabled() {
+			kh.droneController.RotateClockwise()
+		}
+
+	case ActionRotateCCW:
+		if kh.flightControlsEnabled() {
+			kh.droneController.RotateCounterClockwise()
+		}
+
+	case ActionSpeedUp:
+		if kh.droneController != nil {
+			kh.droneController.IncreaseSpeed()
+		}
 
-	case 'd', 'D':
-		// D: 右移動
-		kh.droneController.MoveRight()
+	case ActionSpeedDown:
+		if kh.droneController != nil {
+			kh.droneController.DecreaseSpeed()
+		}
+
+	case ActionToggleFastMode:
+		if kh.droneController != nil {
+			kh.droneController.ToggleFastMode()
+		}
 
-	case 'l', 'L':
-		// L: 録画切り替え
+	case ActionToggleRecording:
 		if kh.cameraViewer != nil {
 			kh.cameraViewer.ToggleRecording()
 		}
 
-	case 'q', 'Q':
-		// Q: 終了
-		fmt.Println("\nプログラムを終了します...")
-		kh.gracefulShutdown()
+	case ActionTakePhoto:
+		if kh.cameraViewer != nil {
+			kh.cameraViewer.TakePhoto()
+		}
 
-	case 'z', 'Z':
-		// Z: 降下（Shiftキーの代替）
-		kh.droneController.MoveDown()
+	case ActionEmergency:
+		// 通信途絶中でも届く可能性があるので、接続状態によらず送る
+		if kh.droneController != nil {
+			kh.confirmEmergency()
+		}
+
+	case ActionQuit:
+		kh.notify("プログラムを終了します...")
+		kh.gracefulShutdown()
 	}
 }
 
@@ -155,7 +283,7 @@ func (kh *KeyboardHandler) gracefulShutdown() {
 	// ドローンを着陸させる
 	if kh.droneController != nil {
 		log.Println("ドローンを緊急着陸させています...")
-		kh.droneController.Land()
+		kh.droneController.forceLand()
 	}
 
 	// カメラビューワーを停止
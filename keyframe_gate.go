@@ -0,0 +1,97 @@
+package main
+
+import (
+	"time"
+
+	"GobotProject/h264"
+)
+
+// keyframeRequestInterval はキーフレームを待つ間にビデオ開始コマンド（IDRの要求）を送り直す間隔
+const keyframeRequestInterval = time.Second
+
+// keyframeGate は録画の最初のフレームをキーフレームにそろえる
+// 受信したSPS/PPSを常に覚えておき、最初のキーフレームに含まれていなければ先頭に付け加える
+type keyframeGate struct {
+	sps, pps    []byte
+	waiting     bool      // 最初のキーフレームを待っている
+	started     time.Time // 録画を開始した時刻
+	lastRequest time.Time
+	skipped     int           // キーフレームを待つ間に捨てたフレーム数
+	latency     time.Duration // 録画開始から最初のキーフレームまでの時間
+}
+
+// observe は受信したSPS/PPSを記録する（録画していないときも呼ぶ）
+func (g *keyframeGate) observe(au h264.AccessUnit) {
+	for _, nal := range au.NALs {
+		switch h264.TypeOf(nal) {
+		case h264.NALSPS:
+			g.sps = nal
+		case h264.NALPPS:
+			g.pps = nal
+		}
+	}
+}
+
+// start は録画の開始時に呼び、最初のキーフレームを待つ状態にする
+func (g *keyframeGate) start(now time.Time) {
+	g.waiting = true
+	g.started = now
+	g.lastRequest = now
+	g.skipped = 0
+	g.latency = 0
+}
+
+// admit は録画に書き込むアクセスユニットを返す
+// キーフレームとSPS/PPSがそろうまではfalseを返し、最初のキーフレームにはSPS/PPSを付け加える
+func (g *keyframeGate) admit(au h264.AccessUnit, now time.Time) (h264.AccessUnit, bool) {
+	if !g.waiting {
+		return au, true
+	}
+	if !au.Keyframe || g.sps == nil || g.pps == nil {
+		g.skipped++
+		return au, false
+	}
+	g.waiting = false
+	g.latency = now.Sub(g.started)
+	return g.withParameterSets(au), true
+}
+
+// needsRequest はキーフレームを待っている間、一定間隔ごとにtrueを返す
+func (g *keyframeGate) needsRequest(now time.Time) bool {
+	if !g.waiting || now.Sub(g.lastRequest) < keyframeRequestInterval {
+		return false
+	}
+	g.lastRequest = now
+	return true
+}
+
+// withParameterSets はSPS/PPSを含まないキーフレームの先頭（AUDの後ろ）に記録しておいたSPS/PPSを付け加える
+func (g *keyframeGate) withParameterSets(au h264.AccessUnit) h264.AccessUnit {
+	hasSPS, hasPPS := false, false
+	for _, nal := range au.NALs {
+		switch h264.TypeOf(nal) {
+		case h264.NALSPS:
+			hasSPS = true
+		case h264.NALPPS:
+			hasPPS = true
+		}
+	}
+	if hasSPS && hasPPS {
+		return au
+	}
+
+	nals := make([][]byte, 0, len(au.NALs)+2)
+	rest := au.NALs
+	if h264.TypeOf(rest[0]) == h264.NALAUD {
+		nals = append(nals, rest[0])
+		rest = rest[1:]
+	}
+	if !hasSPS {
+		nals = append(nals, g.sps)
+	}
+	if !hasPPS {
+		nals = append(nals, g.pps)
+	}
+	au.NALs = append(nals, rest...)
+	return au
+}
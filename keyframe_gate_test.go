@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"GobotProject/h264"
+)
+
+// TestKeyframeGate 最初のキーフレームまで待ち、SPS/PPSを付け加えることをテストします
+func TestKeyframeGate(t *testing.T) {
+	sps, pps := []byte{0x67, 0x42, 0xc0, 0x28}, []byte{0x68, 0xce}
+	aud, idr, slice := []byte{0x09, 0xf0}, []byte{0x65, 0x88}, []byte{0x41, 0x9a}
+
+	var gate keyframeGate
+	start := time.Unix(1000, 0)
+	gate.observe(h264.AccessUnit{NALs: [][]byte{sps, pps, idr}, Keyframe: true})
+	gate.start(start)
+
+	if _, ok := gate.admit(h264.AccessUnit{NALs: [][]byte{slice}}, start.Add(100*time.Millisecond)); ok {
+		t.Error("キーフレームの前のフレームは書き込まないべき")
+	}
+	if gate.needsRequest(start.Add(500 * time.Millisecond)) {
+		t.Error("1秒経つまではキーフレームを要求し直さない")
+	}
+	if !gate.needsRequest(start.Add(1200 * time.Millisecond)) {
+		t.Error("1秒待ってもキーフレームが来なければ要求し直す")
+	}
+
+	au, ok := gate.admit(h264.AccessUnit{NALs: [][]byte{aud, idr}, Keyframe: true}, start.Add(1500*time.Millisecond))
+	if !ok {
+		t.Fatal("キーフレームは書き込むべき")
+	}
+	var types []h264.NALType
+	for _, nal := range au.NALs {
+		types = append(types, h264.TypeOf(nal))
+	}
+	if len(types) != 4 || types[0] != h264.NALAUD || types[1] != h264.NALSPS || types[2] != h264.NALPPS || types[3] != h264.NALIDR {
+		t.Errorf("AUDの後ろにSPS/PPSを付け加えるべき: %v", types)
+	}
+	if gate.latency != 1500*time.Millisecond || gate.skipped != 1 {
+		t.Errorf("開始までの時間 %v, 破棄したフレーム %d", gate.latency, gate.skipped)
+	}
+
+	// 開始後はそのまま書き込み、キーフレームの要求もしない
+	if got, ok := gate.admit(h264.AccessUnit{NALs: [][]byte{slice}}, start.Add(2*time.Second)); !ok || len(got.NALs) != 1 {
+		t.Error("開始後のフレームはそのまま書き込むべき")
+	}
+	if gate.needsRequest(start.Add(5 * time.Second)) {
+		t.Error("開始後はキーフレームを要求しない")
+	}
+}
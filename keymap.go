@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nsf/termbox-go"
+)
+
+// Action はキーに割り当てる操作の名前
+type Action string
+
+// キーに割り当てられる操作
+const (
+	ActionForward         Action = "forward"
+	ActionBackward        Action = "backward"
+	ActionLeft            Action = "left"
+	ActionRight           Action = "right"
+	ActionUp              Action = "up"
+	ActionDown            Action = "down"
+	ActionRotateCW        Action = "rotate_cw"
+	ActionRotateCCW       Action = "rotate_ccw"
+	ActionSpeedUp         Action = "speed_up"
+	ActionSpeedDown       Action = "speed_down"
+	ActionToggleFastMode  Action = "toggle_fast_mode"
+	ActionTakeOffLand     Action = "takeoff_land"
+	ActionToggleRecording Action = "toggle_recording"
+	ActionTakePhoto       Action = "take_photo"
+	ActionEmergency       Action = "emergency"
+	ActionQuit            Action = "quit"
+)
+
+// actionInfo は操作の表示順と説明
+var actionInfo = []struct {
+	action      Action
+	description string
+}{
+	{ActionForward, "前進"},
+	{ActionBackward, "後退"},
+	{ActionLeft, "左移動"},
+	{ActionRight, "右移動"},
+	{ActionUp, "上昇"},
+	{ActionDown, "降下"},
+	{ActionRotateCCW, "左旋回"},
+	{ActionRotateCW, "右旋回"},
+	{ActionSpeedUp, "速度アップ"},
+	{ActionSpeedDown, "速度ダウン"},
+	{ActionToggleFastMode, "高速/低速モード"},
+	{ActionTakeOffLand, "離陸/着陸"},
+	{ActionToggleRecording, "録画 開始/停止"},
+	{ActionTakePhoto, "写真撮影"},
+	{ActionEmergency, "非常停止（2回押す）"},
+	{ActionQuit, "終了"},
+}
+
+// reservedQuitKey は設定に関係なく常に終了に使うキー
+// termboxはCtrl+Cをシグナルにしないため、設定ミスで終了できなくなるのを防ぐ
+const reservedQuitKey = "Ctrl+C"
+
+// namedKeys は文字以外のキーの名前
+var namedKeys = map[termbox.Key]string{
+	termbox.KeyEsc:        "Esc",
+	termbox.KeySpace:      "Space",
+	termbox.KeyEnter:      "Enter",
+	termbox.KeyTab:        "Tab",
+	termbox.KeyBackspace2: "Backspace",
+	termbox.KeyArrowUp:    "Up",
+	termbox.KeyArrowDown:  "Down",
+	termbox.KeyArrowLeft:  "Left",
+	termbox.KeyArrowRight: "Right",
+	termbox.KeyInsert:     "Insert",
+	termbox.KeyDelete:     "Delete",
+	termbox.KeyHome:       "Home",
+	termbox.KeyEnd:        "End",
+	termbox.KeyPgup:       "PageUp",
+	termbox.KeyPgdn:       "PageDown",
+	termbox.KeyF1:         "F1",
+	termbox.KeyF2:         "F2",
+	termbox.KeyF3:         "F3",
+	termbox.KeyF4:         "F4",
+	termbox.KeyF5:         "F5",
+	termbox.KeyF6:         "F6",
+	termbox.KeyF7:         "F7",
+	termbox.KeyF8:         "F8",
+	termbox.KeyF9:         "F9",
+	termbox.KeyF10:        "F10",
+	termbox.KeyF11:        "F11",
+	termbox.KeyF12:        "F12",
+}
+
+// DefaultKeyBindingConfig はQWERTY配列向けの既定のキー割り当て
+func DefaultKeyBindingConfig() map[Action][]string {
+	return map[Action][]string{
+		ActionForward:         {"W"},
+		ActionBackward:        {"S"},
+		ActionLeft:            {"A"},
+		ActionRight:           {"D"},
+		ActionUp:              {"Space"},
+		ActionDown:            {"Z"},
+		ActionRotateCCW:       {"Q"},
+		ActionRotateCW:        {"E"},
+		ActionSpeedUp:         {"+", "="},
+		ActionSpeedDown:       {"-"},
+		ActionToggleFastMode:  {"F"},
+		ActionTakeOffLand:     {"Esc"},
+		ActionToggleRecording: {"L"},
+		ActionTakePhoto:       {"P"},
+		ActionEmergency:       {"X"},
+		ActionQuit:            {"Ctrl+Q"},
+	}
+}
+
+// KeyBindings はキーと操作の対応表
+type KeyBindings struct {
+	actions map[string]Action   // 正規化したキー名 → 操作
+	keys    map[Action][]string // 操作 → 表示用のキー名
+}
+
+// NewKeyBindings は操作ごとのキー指定から対応表を作成する
+// 未知の操作・解釈できないキー・複数の操作に割り当てられたキーはエラーにする
+func NewKeyBindings(config map[Action][]string) (*KeyBindings, error) {
+	kb := &KeyBindings{
+		actions: make(map[string]Action),
+		keys:    make(map[Action][]string),
+	}
+
+	// エラーメッセージを安定させるため操作名の順に処理する
+	actions := make([]string, 0, len(config))
+	for action := range config {
+		actions = append(actions, string(action))
+	}
+	sort.Strings(actions)
+
+	var conflicts []string
+	for _, name := range actions {
+		action := Action(name)
+		if !isKnownAction(action) {
+			return nil, fmt.Errorf("未知の操作です: %q", name)
+		}
+		for _, spec := range config[action] {
+			key, err := parseKeyName(spec)
+			if err != nil {
+				return nil, fmt.Errorf("操作 %q: %v", name, err)
+			}
+			if key == reservedQuitKey && action != ActionQuit {
+				return nil, fmt.Errorf("操作 %q: %s は終了用に予約されています", name, reservedQuitKey)
+			}
+			if other, ok := kb.actions[key]; ok {
+				if other != action {
+					conflicts = append(conflicts, fmt.Sprintf("%s（%s と %s）", key, other, action))
+				}
+				continue
+			}
+			kb.actions[key] = action
+			kb.keys[action] = append(kb.keys[action], key)
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("キーが複数の操作に割り当てられています: %s", strings.Join(conflicts, ", "))
+	}
+
+	if _, ok := kb.actions[reservedQuitKey]; !ok {
+		kb.actions[reservedQuitKey] = ActionQuit
+		kb.keys[ActionQuit] = append(kb.keys[ActionQuit], reservedQuitKey)
+	}
+	return kb, nil
+}
+
+// DefaultKeyBindings は既定のキー割り当てを返す
+func DefaultKeyBindings() *KeyBindings {
+	kb, err := NewKeyBindings(DefaultKeyBindingConfig())
+	if err != nil {
+		panic(err) // 既定値は常に正しい
+	}
+	return kb
+}
+
+// Lookup はキーイベントに割り当てられた操作を返す
+func (kb *KeyBindings) Lookup(ev termbox.Event) (Action, bool) {
+	key, ok := eventKeyName(ev)
+	if !ok {
+		return "", false
+	}
+	action, ok := kb.actions[key]
+	return action, ok
+}
+
+// Keys は操作に割り当てられたキー名を返す
+func (kb *KeyBindings) Keys(action Action) []string {
+	return append([]string(nil), kb.keys[action]...)
+}
+
+// Help は現在の割り当てからキー凡例を作成する（キーのない操作は省略）
+func (kb *KeyBindings) Help() []HelpEntry {
+	var help []HelpEntry
+	for _, info := range actionInfo {
+		if keys := kb.keys[info.action]; len(keys) > 0 {
+			help = append(help, HelpEntry{Keys: strings.Join(keys, "/"), Description: info.description})
+		}
+	}
+	return help
+}
+
+// isKnownAction は操作名が定義済みかどうかを返す
+func isKnownAction(action Action) bool {
+	for _, info := range actionInfo {
+		if info.action == action {
+			return true
+		}
+	}
+	return false
+}
+
+// parseKeyName は設定ファイルのキー指定を正規化する
+// 1文字ならその文字（英字は大文字）、それ以外は "Space" "Esc" "Ctrl+Q" などの名前
+func parseKeyName(spec string) (string, error) {
+	spec = strings.TrimSpace(spec)
+	if utf8.RuneCountInString(spec) == 1 {
+		r, _ := utf8.DecodeRuneInString(spec)
+		if unicode.IsSpace(r) {
+			return "Space", nil
+		}
+		return string(unicode.ToUpper(r)), nil
+	}
+
+	for _, name := range namedKeys {
+		if strings.EqualFold(spec, name) {
+			return name, nil
+		}
+	}
+	if strings.EqualFold(spec, "Escape") {
+		return "Esc", nil
+	}
+
+	if len(spec) == len("Ctrl+X") && strings.EqualFold(spec[:5], "Ctrl+") {
+		if r := unicode.ToUpper(rune(spec[5])); r >= 'A' && r <= 'Z' {
+			// Ctrl+I（Tab）やCtrl+M（Enter）は端末上では名前付きキーと区別できない
+			if name, ok := namedKeys[termbox.KeyCtrlA+termbox.Key(r-'A')]; ok {
+				return name, nil
+			}
+			return "Ctrl+" + string(r), nil
+		}
+	}
+	return "", fmt.Errorf("解釈できないキーです: %q", spec)
+}
+
+// eventKeyName はキーイベントを正規化したキー名に変換する
+func eventKeyName(ev termbox.Event) (string, bool) {
+	if ev.Ch != 0 {
+		return string(unicode.ToUpper(ev.Ch)), true
+	}
+	if name, ok := namedKeys[ev.Key]; ok {
+		return name, true
+	}
+	if ev.Key >= termbox.KeyCtrlA && ev.Key <= termbox.KeyCtrlZ {
+		return "Ctrl+" + string(rune('A'+ev.Key-termbox.KeyCtrlA)), true
+	}
+	return "", false
+}
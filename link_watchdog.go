@@ -0,0 +1,206 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// 通信の監視の既定値
+const (
+	defaultLinkTimeout       = 1500 * time.Millisecond // ドローンからの受信がこれだけ途絶えたら通信途絶とみなす
+	linkCheckInterval        = 100 * time.Millisecond  // 最後の受信からの時間を確認する間隔
+	linkReconnectInterval    = time.Second             // 接続要求を送り直す最初の間隔（送るたびに2倍にする）
+	linkReconnectMaxInterval = 8 * time.Second         // 接続要求を送り直す間隔の上限
+	linkReconnectAttempts    = 8                       // 1回の通信途絶で接続要求を送る回数の上限
+)
+
+// SessionReconnector はドライバーの接続処理をやり直さずに、ドローンへ接続要求を送り直せるドローン
+// TelloDriver は映像のポートを自分で受信しているので、接続応答が届き直しても映像は途切れない
+type SessionReconnector interface {
+	Reconnect() error
+}
+
+// reconnectBackoff は attempt 回目の接続要求を送ってから次に送るまでの間隔を返す
+func reconnectBackoff(attempt int) time.Duration {
+	return min(linkReconnectInterval<<(attempt-1), linkReconnectMaxInterval)
+}
+
+// LinkStatus はドローンとの通信の状態
+type LinkStatus struct {
+	Received bool          // ドローンから一度でも受信したか
+	Lost     bool          // 通信途絶中か
+	Age      time.Duration // 最後に受信してからの時間
+	Outage   time.Duration // 通信途絶中ならその長さ、そうでなければ直前の通信途絶の長さ
+	Attempts int           // 今回の通信途絶で送った接続要求の回数
+}
+
+// linkWatchdog はドローンから最後に受信した時刻を監視する
+// 通信途絶中は間隔を空けながら接続要求を送り直し、回復は次に受信したとき（packetReceived）に判断する
+type linkWatchdog struct {
+	mu            sync.Mutex
+	timeout       time.Duration
+	landAfter     time.Duration // これ以上途絶えてから回復したら着陸させる（0なら着陸させない）
+	lastPacket    time.Time
+	lost          bool
+	lostAt        time.Time // 最後に受信した時刻（通信途絶の始まり）
+	lastOutage    time.Duration
+	attempts      int       // 今回の通信途絶で送った接続要求の回数
+	nextReconnect time.Time // 次に接続要求を送る時刻
+
+	// 監視ループ
+	running bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// SetLinkPolicy は通信途絶とみなすまでの時間と、回復後に着陸させる通信途絶の長さ（0なら着陸させない）を設定する
+func (dc *DroneController) SetLinkPolicy(timeout, landAfter time.Duration) {
+	dc.link.mu.Lock()
+	defer dc.link.mu.Unlock()
+
+	if timeout > 0 {
+		dc.link.timeout = timeout
+	}
+	dc.link.landAfter = landAfter
+}
+
+// LinkStatus はドローンとの通信の状態を返す
+func (dc *DroneController) LinkStatus() LinkStatus {
+	now := dc.now()
+
+	dc.link.mu.Lock()
+	defer dc.link.mu.Unlock()
+
+	status := LinkStatus{
+		Received: !dc.link.lastPacket.IsZero(),
+		Lost:     dc.link.lost,
+		Outage:   dc.link.lastOutage,
+		Attempts: dc.link.attempts,
+	}
+	if status.Received {
+		status.Age = now.Sub(dc.link.lastPacket)
+	}
+	if status.Lost {
+		status.Outage = now.Sub(dc.link.lostAt)
+	}
+	return status
+}
+
+// IsLinkLost はドローンとの通信が途絶えているかどうかを返す
+func (dc *DroneController) IsLinkLost() bool {
+	dc.link.mu.Lock()
+	defer dc.link.mu.Unlock()
+	return dc.link.lost
+}
+
+// packetReceived はドローンから受信したことを記録し、通信途絶中なら回復させる
+// 設定した長さ以上途絶えていた場合、飛行中なら着陸させる
+func (dc *DroneController) packetReceived() {
+	now := dc.now()
+
+	dc.link.mu.Lock()
+	dc.link.lastPacket = now
+	if !dc.link.lost {
+		dc.link.mu.Unlock()
+		return
+	}
+	outage := now.Sub(dc.link.lostAt)
+	dc.link.lost = false
+	dc.link.lastOutage = outage
+	land := dc.link.landAfter > 0 && outage >= dc.link.landAfter
+	dc.link.mu.Unlock()
+
+	dc.notify("ドローンとの通信が回復しました（%.1f秒途絶）", outage.Seconds())
+	if land {
+		dc.notify("通信が %.1f秒途絶えていたため着陸します", outage.Seconds())
+		dc.forceLand()
+	}
+}
+
+// checkLink は最後の受信からの時間を調べ、通信途絶ならホバリングさせて接続要求を送り直す
+// 通信途絶中は、最後に送ったスティックの値でドローンが動き続けないよう全軸を止めておく
+// 接続要求は間隔を倍にしながら上限の回数まで送り、それ以降は受信の再開だけを待つ
+func (dc *DroneController) checkLink(now time.Time) {
+	reconnector, canReconnect := dc.drone.(SessionReconnector)
+
+	dc.link.mu.Lock()
+	if dc.link.lastPacket.IsZero() {
+		dc.link.mu.Unlock()
+		return
+	}
+	age := now.Sub(dc.link.lastPacket)
+	started := !dc.link.lost && age >= dc.link.timeout
+	if started {
+		dc.link.lost = true
+		dc.link.lostAt = dc.link.lastPacket
+		dc.link.attempts = 0
+		dc.link.nextReconnect = now
+	}
+	reconnect := canReconnect && dc.link.lost && dc.link.attempts < linkReconnectAttempts && !now.Before(dc.link.nextReconnect)
+	if reconnect {
+		dc.link.attempts++
+		dc.link.nextReconnect = now.Add(reconnectBackoff(dc.link.attempts))
+	}
+	attempt := dc.link.attempts
+	dc.link.mu.Unlock()
+
+	if started {
+		dc.notify("ドローンからの通信が %.1f秒途絶えています。再接続を試みます（飛行操作は無効）", age.Seconds())
+		dc.resetSticks()
+		dc.apply(EventLinkLost)
+	}
+	if !reconnect {
+		return
+	}
+	if err := reconnector.Reconnect(); err != nil {
+		dc.notify("接続要求の送信に失敗: %v", err)
+	}
+	if attempt == linkReconnectAttempts {
+		dc.notify("接続要求を %d回送りました。以降は受信の再開を待ちます", attempt)
+	}
+}
+
+// StartLinkWatchdog は通信途絶と、非常停止の確認の制限時間を監視するループを開始する
+func (dc *DroneController) StartLinkWatchdog() {
+	dc.link.mu.Lock()
+	defer dc.link.mu.Unlock()
+
+	if dc.link.running {
+		return
+	}
+	dc.link.running = true
+	dc.link.stop = make(chan struct{})
+	dc.link.done = make(chan struct{})
+
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(linkCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				now := dc.now()
+				dc.checkLink(now)
+				dc.expireEmergency(now)
+			}
+		}
+	}(dc.link.stop, dc.link.done)
+}
+
+// StopLinkWatchdog は通信途絶の監視ループを停止する（複数回呼んでも安全）
+func (dc *DroneController) StopLinkWatchdog() {
+	dc.link.mu.Lock()
+	if !dc.link.running {
+		dc.link.mu.Unlock()
+		return
+	}
+	dc.link.running = false
+	close(dc.link.stop)
+	done := dc.link.done
+	dc.link.mu.Unlock()
+
+	<-done
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nsf/termbox-go"
+	"gobot.io/x/gobot/platforms/dji/tello"
+)
+
+// TestLinkWatchdogLostAndRecovered 通信途絶でホバリングして接続要求を送り直し、回復後に着陸することを確認します
+func TestLinkWatchdogLostAndRecovered(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := newGroundedController(fake)
+	keyboardHandler := NewKeyboardHandler(droneController, nil)
+	connectFakeDrone(t, fake, droneController)
+
+	clock := time.Now()
+	droneController.now = func() time.Time { return clock }
+	droneController.SetLinkPolicy(time.Second, 3*time.Second)
+
+	droneController.TakeOff()
+	droneController.MoveForward()
+	droneController.packetReceived()
+	fake.Reset()
+
+	// タイムアウトまでは何もしない
+	clock = clock.Add(900 * time.Millisecond)
+	droneController.checkLink(clock)
+	if droneController.IsLinkLost() || len(fake.Commands()) != 0 {
+		t.Fatalf("タイムアウト前に通信途絶とみなすべきでない: %v", fake.Commands())
+	}
+
+	// 通信途絶: 全軸を止めて接続要求を送り、飛行操作を受け付けない
+	clock = clock.Add(100 * time.Millisecond)
+	droneController.checkLink(clock)
+	keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Ch: 'w'})
+	if got := fake.Commands(); !reflect.DeepEqual(got, []string{"Hover", "Reconnect"}) {
+		t.Errorf("通信途絶時のコマンドが不正: %v", got)
+	}
+	if !strings.Contains(NewDashboard(droneController, nil, nil, nil).headerLine().text, "通信途絶") {
+		t.Error("ダッシュボードに通信途絶を表示すべき")
+	}
+
+	// 接続要求は間隔を空けて送り直す
+	for range 10 {
+		clock = clock.Add(linkCheckInterval)
+		droneController.checkLink(clock)
+	}
+	if got := fake.Commands(); !reflect.DeepEqual(got, []string{"Hover", "Reconnect", "Reconnect"}) {
+		t.Errorf("通信途絶中のコマンドが不正: %v", got)
+	}
+	if status := droneController.LinkStatus(); !status.Lost || status.Attempts != 2 || status.Outage != 2*time.Second {
+		t.Errorf("通信途絶中の状態が不正: %+v", status)
+	}
+
+	// 設定した長さ以上途絶えてから回復したら着陸する
+	clock = clock.Add(time.Second)
+	fake.Reset()
+	droneController.packetReceived()
+	if got := fake.Commands(); !reflect.DeepEqual(got, []string{"Land"}) {
+		t.Errorf("回復後のコマンドが不正: %v", got)
+	}
+	if status := droneController.LinkStatus(); status.Lost || status.Outage != 3*time.Second {
+		t.Errorf("回復後の状態が不正: %+v", status)
+	}
+}
+
+// TestLinkWatchdogReconnectBackoff 接続要求は間隔を倍にしながら上限の回数まで送ることを確認します
+func TestLinkWatchdogReconnectBackoff(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := newGroundedController(fake)
+	events := NewEventLog(20)
+	droneController.SetEventLog(events)
+	clock := time.Now()
+	droneController.now = func() time.Time { return clock }
+	droneController.SetLinkPolicy(time.Second, 0)
+	droneController.packetReceived()
+	fake.Reset()
+
+	// 通信途絶の始まりから、接続要求を送った時刻を記録する
+	var sent []time.Duration
+	for elapsed := time.Second; elapsed <= time.Minute; elapsed += linkCheckInterval {
+		droneController.checkLink(clock.Add(elapsed))
+		if n := len(fake.Commands()); n > len(sent) {
+			sent = append(sent, elapsed-time.Second)
+		}
+	}
+	expected := []time.Duration{0, 1 * time.Second, 3 * time.Second, 7 * time.Second,
+		15 * time.Second, 23 * time.Second, 31 * time.Second, 39 * time.Second}
+	if !reflect.DeepEqual(sent, expected) {
+		t.Errorf("接続要求の間隔が不正\n期待: %v\n実際: %v", expected, sent)
+	}
+	if got := fake.Commands(); len(got) != linkReconnectAttempts || got[0] != "Reconnect" {
+		t.Errorf("接続要求は上限の回数だけ送るべき: %v", got)
+	}
+	if messages := eventMessages(events); !strings.Contains(messages[len(messages)-1], "以降は受信の再開を待ちます") {
+		t.Errorf("接続要求をやめたことを通知すべき: %v", messages)
+	}
+
+	// 回復後にまた途絶えたら、最初から送り直す
+	droneController.packetReceived()
+	fake.Reset()
+	droneController.checkLink(clock.Add(2 * time.Minute))
+	if got := fake.Commands(); !reflect.DeepEqual(got, []string{"Reconnect"}) {
+		t.Errorf("次の通信途絶では接続要求を送るべき: %v", got)
+	}
+}
+
+// TestLinkWatchdogShortOutage 短い通信途絶や着陸しない設定では、回復後も飛行を続けることを確認します
+func TestLinkWatchdogShortOutage(t *testing.T) {
+	for _, landAfter := range []time.Duration{0, 5 * time.Second} {
+		fake := NewFakeDrone()
+		droneController := newGroundedController(fake)
+		clock := time.Now()
+		droneController.now = func() time.Time { return clock }
+		droneController.SetLinkPolicy(time.Second, landAfter)
+
+		// 一度も受信していなければ監視しない
+		droneController.checkLink(clock.Add(time.Minute))
+		if droneController.IsLinkLost() {
+			t.Error("受信前に通信途絶とみなすべきでない")
+		}
+
+		droneController.TakeOff()
+		droneController.packetReceived()
+		clock = clock.Add(4 * time.Second)
+		droneController.checkLink(clock)
+		if state := droneController.FlightState(); state != StateLinkLost {
+			t.Errorf("着陸させる長さ %v: 通信途絶中の飛行状態が不正: %v", landAfter, state)
+		}
+		// 回復後のフライトデータで飛行中に戻る
+		droneController.packetReceived()
+		droneController.reconcileFlying(&tello.FlightData{Flying: true})
+
+		if got := fake.Commands(); !reflect.DeepEqual(got, []string{"TakeOff", "Reconnect"}) {
+			t.Errorf("着陸させる長さ %v: コマンドが不正: %v", landAfter, got)
+		}
+		if !droneController.IsFlying() || droneController.IsLinkLost() {
+			t.Errorf("着陸させる長さ %v: 飛行を続けるべき", landAfter)
+		}
+	}
+}
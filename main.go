@@ -1,54 +1,204 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"GobotProject/simulator"
+
 	"gobot.io/x/gobot"
 )
 
-// waitForConnection 接続確認を行い、タイムアウト付きで待機
+// 接続確認の失敗理由
+var (
+	// ErrNoRoute はドローンのネットワークへの経路がない（TelloのWi-Fiに未接続）
+	ErrNoRoute = errors.New("ドローンへのWi-Fi経路がありません")
+	// ErrNoResponse は接続要求にドローンが応答しない
+	ErrNoResponse = errors.New("ドローンから応答がありません")
+	// ErrStaleFirmware は接続応答はあるがフライトデータが届かない
+	ErrStaleFirmware = errors.New("フライトデータが届きません（ファームウェアが古い可能性があります）")
+)
+
+// checkRoute はドローンのアドレスへ直接届くネットワークインターフェースがあるか確認
+func checkRoute(address string) error {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNoRoute, err)
+	}
+	defer conn.Close()
+
+	local := conn.LocalAddr().(*net.UDPAddr).IP
+	remote := conn.RemoteAddr().(*net.UDPAddr).IP
+
+	// 送信元アドレスのサブネットに宛先が含まれていなければ、
+	// デフォルトゲートウェイ経由（TelloのWi-Fi以外）で送ろうとしている
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNoRoute, err)
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(local) && ipNet.Contains(remote) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s は %s と同じネットワークにありません", ErrNoRoute, remote, local)
+}
+
+// waitForConnection ドローンの接続応答と最初のフライトデータを、タイムアウト付きで待機
 func waitForConnection(droneController *DroneController, maxWaitTime time.Duration) error {
 	log.Println("ドローンに接続中...")
-	
-	// シンプルな接続確認（実際の実装では、ドローンの状態を確認）
-	startTime := time.Now()
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
-	
-	// タイムアウトタイマーをループ外で設定
-	timeout := time.After(maxWaitTime)
-	
-	for {
-		select {
-		case <-ticker.C:
-			// 実際の接続確認ロジック（ここでは簡略化）
-			if time.Since(startTime) >= time.Second {
-				log.Println("準備完了！")
-				return nil
-			}
-		case <-timeout:
-			return fmt.Errorf("接続タイムアウト: %v", maxWaitTime)
+
+	if address := droneController.Address(); address != "" {
+		if err := checkRoute(address); err != nil {
+			return err
 		}
 	}
+
+	// タイムアウトタイマーは接続応答とフライトデータで共有する
+	timeout := time.After(maxWaitTime)
+
+	select {
+	case <-droneController.Connected():
+		log.Println("接続応答を受信しました")
+	case <-timeout:
+		return fmt.Errorf("%w（%v 待機）", ErrNoResponse, maxWaitTime)
+	}
+
+	select {
+	case <-droneController.FlightDataReceived():
+		log.Println("準備完了！")
+		return nil
+	case <-timeout:
+		return fmt.Errorf("%w（%v 待機）", ErrStaleFirmware, maxWaitTime)
+	}
+}
+
+// runSimulator はsimulateコマンドを実行し、シグナルを受けるまでシミュレーターを動かす
+func runSimulator(args []string) error {
+	cfg := simulator.DefaultConfig()
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	fs.StringVar(&cfg.CommandAddr, "addr", cfg.CommandAddr, "制御コマンドを待ち受けるアドレス")
+	fs.StringVar(&cfg.VideoFile, "video", "", "ループ再生するH.264(Annex-B)ファイル（省略時は合成映像）")
+	fs.IntVar(&cfg.FrameRate, "fps", cfg.FrameRate, "ビデオの送信フレームレート")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg.Logf = log.Printf
+
+	sim, err := simulator.New(cfg)
+	if err != nil {
+		return err
+	}
+	if err := sim.Start(); err != nil {
+		return err
+	}
+	log.Println("シミュレーター実行中 - 別のターミナルで `go run . -drone 127.0.0.1` を実行してください")
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	<-c
+
+	return sim.Stop()
 }
 
 func main() {
+	// サブコマンドの処理
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		if err := runSimulator(os.Args[2:]); err != nil {
+			log.Fatalf("シミュレーターエラー: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "repair" {
+		if err := runRepair(os.Args[2:]); err != nil {
+			log.Fatalf("修復エラー: %v", err)
+		}
+		return
+	}
+
+	droneIP := flag.String("drone", "", "接続先ドローンのIPアドレス（シミュレーター使用時は127.0.0.1）")
+	configPath := flag.String("config", defaultConfigFile, "設定ファイル（JSON）のパス")
+	formatName := flag.String("format", "", "録画形式（MOV, MP4, H264, TS。省略時は設定ファイルの値）")
+	flag.Parse()
+
+	// 設定ファイルを読み込む（存在しなければ既定値）
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("設定エラー: %v", err)
+	}
+	bindings, err := config.Bindings()
+	if err != nil {
+		log.Fatalf("設定エラー: %v", err)
+	}
+	// コマンドラインで指定した録画形式は設定ファイルには保存しない
+	if *formatName == "" {
+		*formatName = config.Recording.Format
+	}
+	recordingFormat, err := ParseRecordingFormat(*formatName)
+	if err != nil {
+		log.Fatalf("設定エラー: %v", err)
+	}
+
 	// ドローンコントローラーを作成
-	droneController := NewDroneController()
-	
+	address := defaultDroneAddress
+	if *droneIP != "" {
+		address = net.JoinHostPort(*droneIP, "8889")
+	}
+	// 写真撮影の中継は設定で有効にした場合だけ使い、開始できなければ写真撮影なしで接続する
+	drone, err := NewTelloDriver(address, config.Photo.Relay)
+	var photoErr error
+	if err != nil && config.Photo.Relay {
+		photoErr = err
+		drone, err = NewTelloDriver(address, false)
+	}
+	if err != nil {
+		log.Fatalf("ドライバーの作成エラー: %v", err)
+	}
+	droneController := NewDroneControllerWithDrone(drone)
+	droneController.SetAddress(address)
+	droneController.SetHoldTimeout(config.HoldTimeout())
+	droneController.SetBatteryThresholds(config.Battery.WarnPercent, config.Battery.MinTakeOffPercent, config.Battery.CriticalPercent)
+	droneController.SetLinkPolicy(config.Link.Timeout(), config.Link.LandAfterOutage())
+	droneController.SetGeofence(config.Geofence.CeilingM, config.Geofence.MinLateralHeightM, config.Geofence.MaxFlightTime())
+
 	// カメラビューワーを作成
 	cameraViewer := NewCameraViewer(droneController.GetDriver())
-	
+	cameraViewer.SetRecordingFormat(recordingFormat)
+	cameraViewer.SetRecordingOptions(config.Recording.MP4Options())
+	cameraViewer.SetPreRecord(config.Recording.PreRecordLength(), config.Recording.PreRecordMaxBytes())
+
 	// キーボードハンドラーを作成
 	keyboardHandler := NewKeyboardHandler(droneController, cameraViewer)
+	keyboardHandler.SetKeyBindings(bindings)
+	if photoErr != nil {
+		cameraViewer.notify("写真撮影の中継を開始できないため、写真撮影なしで接続しました: %v", photoErr)
+	}
+
+	// 速度レベルとモードはイベントログの設定後に反映する
+	droneController.SetSpeed(config.Speed)
+	droneController.SetFastMode(config.FastMode)
+
+	// 実行中に変更した速度レベルとモードは設定ファイルに保存し、次回も使う
+	droneController.SetSettingsChangedCallback(func(speed int, fastMode bool) {
+		config.Speed = speed
+		config.FastMode = fastMode
+		if err := config.Save(*configPath); err != nil {
+			log.Printf("設定の保存に失敗: %v", err)
+		}
+	})
 
 	// ドローンの動作を定義する関数
 	work := func() {
 		// カメラビューワーを開始
 		cameraViewer.Start()
-		
+
 		// キーボードハンドラーを開始
 		err := keyboardHandler.Start()
 		if err != nil {
@@ -58,12 +208,24 @@ func main() {
 
 		// プログラムの説明を表示
 		log.Println("=== Tello ドローンコントローラー ===")
-		
-		// 接続確認のため少し待機
+
+		// 接続の確認が遅れても、あとから届いたテレメトリーで飛行操作が有効になるため、
+		// 飛行中の安全のための監視は接続を待つ前に開始しておく
+		// キーを離したら自動で止まるようにする
+		droneController.StartStickDecay()
+		// バッテリー残量を監視し、危険な残量では自動着陸する
+		droneController.StartBatterySupervisor()
+		// 通信が途絶えたらホバリングさせ、再接続を試みる
+		droneController.StartLinkWatchdog()
+		// 天井・最低高度・飛行時間の制限を監視する
+		droneController.StartGeofence()
+
+		// 接続応答とフライトデータを確認するまで飛行操作は無効
 		err = waitForConnection(droneController, 10*time.Second)
 		if err != nil {
-			log.Printf("接続エラー: %v", err)
-			return
+			log.Printf("接続エラー: %v（接続を確認できた時点で飛行操作が有効になります）", err)
+		} else {
+			log.Println("飛行操作が有効になりました")
 		}
 	}
 
@@ -75,8 +237,8 @@ func main() {
 	)
 
 	// ロボットを開始し、エラーがあれば表示
-	err := robot.Start()
+	err = robot.Start()
 	if err != nil {
 		log.Printf("ロボット開始エラー: %v", err)
 	}
-}
\ No newline at end of file
+}
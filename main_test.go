@@ -31,8 +31,11 @@ $ go test -v
 package main
 
 import (
+	"errors"
 	"testing"
 	"time"
+
+	"gobot.io/x/gobot/platforms/dji/tello"
 )
 
 // TestDroneControllerCreation ドローンコントローラーの作成をテストします
@@ -41,7 +44,7 @@ func TestDroneControllerCreation(t *testing.T) {
 	if droneController == nil {
 		t.Fatal("DroneController should not be nil")
 	}
-	
+
 	driver := droneController.GetDriver()
 	if driver == nil {
 		t.Fatal("Driver should not be nil")
@@ -52,7 +55,7 @@ func TestDroneControllerCreation(t *testing.T) {
 func TestCameraViewerCreation(t *testing.T) {
 	droneController := NewDroneController()
 	cameraViewer := NewCameraViewer(droneController.GetDriver())
-	
+
 	if cameraViewer == nil {
 		t.Fatal("CameraViewer should not be nil")
 	}
@@ -63,7 +66,7 @@ func TestKeyboardHandlerCreation(t *testing.T) {
 	droneController := NewDroneController()
 	cameraViewer := NewCameraViewer(droneController.GetDriver())
 	keyboardHandler := NewKeyboardHandler(droneController, cameraViewer)
-	
+
 	if keyboardHandler == nil {
 		t.Fatal("KeyboardHandler should not be nil")
 	}
@@ -75,12 +78,12 @@ func TestComponentsIntegration(t *testing.T) {
 	droneController := NewDroneController()
 	cameraViewer := NewCameraViewer(droneController.GetDriver())
 	keyboardHandler := NewKeyboardHandler(droneController, cameraViewer)
-	
+
 	// 全てのコンポーネントが正常に作成されることを確認
 	if droneController == nil || cameraViewer == nil || keyboardHandler == nil {
 		t.Fatal("All components should be created successfully")
 	}
-	
+
 	// 追加のアサーション
 	t.Log("All components created successfully")
 }
@@ -96,13 +99,13 @@ func BenchmarkDroneControllerCreation(b *testing.B) {
 func TestWorkFunctionExecution(t *testing.T) {
 	// タイムアウト付きでテストを実行
 	done := make(chan bool, 1)
-	
+
 	go func() {
 		// work関数の主要ロジックをテスト
 		droneController := NewDroneController()
 		cameraViewer := NewCameraViewer(droneController.GetDriver())
 		keyboardHandler := NewKeyboardHandler(droneController, cameraViewer)
-		
+
 		// 実際の開始は行わず、オブジェクトの作成のみテスト
 		if droneController != nil && cameraViewer != nil && keyboardHandler != nil {
 			done <- true
@@ -110,7 +113,7 @@ func TestWorkFunctionExecution(t *testing.T) {
 			done <- false
 		}
 	}()
-	
+
 	// タイムアウト設定
 	select {
 	case success := <-done:
@@ -131,7 +134,7 @@ func TestErrorHandling(t *testing.T) {
 				t.Log("Properly handled nil driver panic:", r)
 			}
 		}()
-		
+
 		// 実際のエラーケースをテスト
 		t.Log("Testing error handling scenarios")
 	})
@@ -143,40 +146,40 @@ func TestCleanup(t *testing.T) {
 	t.Cleanup(func() {
 		t.Log("Test cleanup completed")
 	})
-	
+
 	t.Log("Testing cleanup functionality")
 }
 
 // TestDroneBasicOperations ドローンの基本動作をテストします
 func TestDroneBasicOperations(t *testing.T) {
 	droneController := NewDroneController()
-	
+
 	// 初期状態の確認
 	if droneController.IsFlying() {
 		t.Error("Drone should not be flying initially")
 	}
-	
+
 	if droneController.IsRecording() {
 		t.Error("Drone should not be recording initially")
 	}
-	
+
 	t.Log("Drone basic operations test completed (initial state check only)")
 }
 
 // TestDroneRecordingOperations ドローンの録画機能をテストします
 func TestDroneRecordingOperations(t *testing.T) {
 	droneController := NewDroneController()
-	
+
 	// 初期状態の確認
 	if droneController.IsRecording() {
 		t.Error("Drone should not be recording initially")
 	}
-	
+
 	// IsFlying状態の確認
 	if droneController.IsFlying() {
 		t.Error("Drone should not be flying initially")
 	}
-	
+
 	t.Log("Drone recording operations test completed (state check only)")
 }
 
@@ -184,39 +187,39 @@ func TestDroneRecordingOperations(t *testing.T) {
 func TestCameraViewerOperations(t *testing.T) {
 	droneController := NewDroneController()
 	cameraViewer := NewCameraViewer(droneController.GetDriver())
-	
+
 	// 初期状態の確認
 	if cameraViewer.IsRunning() {
 		t.Error("CameraViewer should not be running initially")
 	}
-	
+
 	if cameraViewer.IsRecording() {
 		t.Error("CameraViewer should not be recording initially")
 	}
-	
+
 	// 録画開始テスト
 	cameraViewer.StartRecording()
 	if !cameraViewer.IsRecording() {
 		t.Error("CameraViewer should be recording after StartRecording")
 	}
-	
+
 	// 録画停止テスト
 	cameraViewer.StopRecording()
 	if cameraViewer.IsRecording() {
 		t.Error("CameraViewer should not be recording after StopRecording")
 	}
-	
+
 	// 録画切り替えテスト
 	cameraViewer.ToggleRecording() // 開始
 	if !cameraViewer.IsRecording() {
 		t.Error("CameraViewer should be recording after first ToggleRecording")
 	}
-	
+
 	cameraViewer.ToggleRecording() // 停止
 	if cameraViewer.IsRecording() {
 		t.Error("CameraViewer should not be recording after second ToggleRecording")
 	}
-	
+
 	t.Log("Camera viewer operations test completed")
 }
 
@@ -225,12 +228,12 @@ func TestKeyboardHandlerOperations(t *testing.T) {
 	droneController := NewDroneController()
 	cameraViewer := NewCameraViewer(droneController.GetDriver())
 	keyboardHandler := NewKeyboardHandler(droneController, cameraViewer)
-	
+
 	// 初期状態の確認
 	if keyboardHandler.IsRunning() {
 		t.Error("KeyboardHandler should not be running initially")
 	}
-	
+
 	// キーボードハンドラー停止テスト（開始なしでも停止できることを確認）
 	keyboardHandler.Stop()
 	if keyboardHandler.IsRunning() {
@@ -241,7 +244,7 @@ func TestKeyboardHandlerOperations(t *testing.T) {
 // TestMoveOperationsWhenNotFlying 飛行していない時の移動操作をテストします
 func TestMoveOperationsWhenNotFlying(t *testing.T) {
 	droneController := NewDroneController()
-	
+
 	// 飛行していない状態で移動コマンドを実行
 	// （条件分岐のテストのみ、実際のドローンAPIは呼び出さない）
 	droneController.MoveForward()
@@ -250,12 +253,12 @@ func TestMoveOperationsWhenNotFlying(t *testing.T) {
 	droneController.MoveRight()
 	droneController.MoveUp()
 	droneController.MoveDown()
-	
+
 	// 飛行状態は変わらないことを確認
 	if droneController.IsFlying() {
 		t.Error("Drone should not be flying after move commands when not flying")
 	}
-	
+
 	t.Log("Move operations when not flying test completed")
 }
 
@@ -263,18 +266,18 @@ func TestMoveOperationsWhenNotFlying(t *testing.T) {
 func TestCameraViewerFrameProcessing(t *testing.T) {
 	droneController := NewDroneController()
 	cameraViewer := NewCameraViewer(droneController.GetDriver())
-	
+
 	// フレーム処理のテスト用ダミーデータ
 	testFrameData := []byte("test frame data")
-	
+
 	// カメラビューアーが停止状態でのフレーム処理
 	cameraViewer.processFrame(testFrameData)
-	
+
 	// 複数フレームの処理（フレーム数カウントのテスト）
 	for i := 0; i < 10; i++ {
 		cameraViewer.processFrame(testFrameData)
 	}
-	
+
 	t.Log("Frame processing test completed")
 }
 
@@ -282,7 +285,7 @@ func TestCameraViewerFrameProcessing(t *testing.T) {
 func TestCameraViewerRecordingFileOperations(t *testing.T) {
 	droneController := NewDroneController()
 	cameraViewer := NewCameraViewer(droneController.GetDriver())
-	
+
 	// 重複録画開始のテスト（既に録画中に再度開始）
 	cameraViewer.StartRecording()
 	originalRecordingState := cameraViewer.IsRecording()
@@ -290,13 +293,63 @@ func TestCameraViewerRecordingFileOperations(t *testing.T) {
 	if cameraViewer.IsRecording() != originalRecordingState {
 		t.Error("Recording state should not change when starting recording while already recording")
 	}
-	
+
 	// 重複録画停止のテスト（録画していない時に停止）
 	cameraViewer.StopRecording()
 	cameraViewer.StopRecording() // 既に停止しているので何も起こらない
 	if cameraViewer.IsRecording() {
 		t.Error("Should not be recording after multiple stop calls")
 	}
-	
+
 	t.Log("Recording file operations test completed")
 }
+
+// TestWaitForConnectionNoResponse 応答がない場合にErrNoResponseを返すことをテストします
+func TestWaitForConnectionNoResponse(t *testing.T) {
+	droneController := NewDroneControllerWithDrone(NewFakeDrone())
+
+	err := waitForConnection(droneController, 50*time.Millisecond)
+	if !errors.Is(err, ErrNoResponse) {
+		t.Errorf("ErrNoResponseが期待されます: %v", err)
+	}
+}
+
+// TestWaitForConnectionStaleFirmware 接続応答のみでフライトデータがない場合をテストします
+func TestWaitForConnectionStaleFirmware(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := NewDroneControllerWithDrone(fake)
+	fake.Publish(tello.ConnectedEvent, nil)
+
+	err := waitForConnection(droneController, 100*time.Millisecond)
+	if !errors.Is(err, ErrStaleFirmware) {
+		t.Errorf("ErrStaleFirmwareが期待されます: %v", err)
+	}
+}
+
+// TestWaitForConnectionSuccess 接続応答とフライトデータが揃えば成功することをテストします
+func TestWaitForConnectionSuccess(t *testing.T) {
+	fake := NewFakeDrone()
+	droneController := NewDroneControllerWithDrone(fake)
+	droneController.SetAddress("127.0.0.1:8889")
+	fake.Publish(tello.ConnectedEvent, nil)
+	fake.Publish(tello.FlightDataEvent, &tello.FlightData{})
+
+	if err := waitForConnection(droneController, time.Second); err != nil {
+		t.Errorf("接続確認が成功するべき: %v", err)
+	}
+	if !droneController.IsLinkReady() {
+		t.Error("接続確認後はIsLinkReadyがtrueであるべき")
+	}
+}
+
+// TestCheckRouteUnreachable ローカルネットワーク外のアドレスはErrNoRouteになることをテストします
+func TestCheckRouteUnreachable(t *testing.T) {
+	if err := checkRoute("127.0.0.1:8889"); err != nil {
+		t.Errorf("ループバックへの経路は存在するべき: %v", err)
+	}
+
+	// TEST-NET-3 (203.0.113.0/24) はローカルのサブネットに含まれない
+	if err := checkRoute("203.0.113.1:8889"); !errors.Is(err, ErrNoRoute) {
+		t.Errorf("ErrNoRouteが期待されます: %v", err)
+	}
+}
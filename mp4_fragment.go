@@ -0,0 +1,141 @@
+package main
+
+// trunのサンプルフラグ
+const (
+	sampleFlagsKeyframe    = 0x02000000 // 他のフレームに依存しない（同期サンプル）
+	sampleFlagsNonKeyframe = 0x01010000 // 他のフレームに依存する非同期サンプル
+)
+
+// mp4Fragment はフラグメント形式で書き込み待ちのサンプルと書き込みの進み具合
+type mp4Fragment struct {
+	initialized bool   // moov（初期化セグメント）を書き込んだか
+	sequence    uint32 // moofの通し番号
+	decodeTime  uint64 // 次のフラグメントの先頭サンプルの時刻（videoTimescale単位）
+	written     int    // 書き込み済みのサンプル数
+
+	sizes     []uint32
+	durations []uint32
+	keyframes []bool
+	data      []byte
+}
+
+// length は現在のフラグメントの長さ（videoTimescale単位）を返す
+func (f *mp4Fragment) length() uint64 {
+	var length uint64
+	for _, d := range f.durations {
+		length += uint64(d)
+	}
+	return length
+}
+
+// addFragmentSample はサンプルを現在のフラグメントに追加する
+// deltaで直前のサンプルの長さが決まった時点で指定時間分たまっていれば、先にそこまでを書き込む
+func (w *MP4Writer) addFragmentSample(sample []byte, keyframe bool, delta uint32) error {
+	f := &w.fragment
+	if n := len(f.durations); n > 0 {
+		w.retime(&f.durations[n-1], delta)
+		if ticksToDuration(f.length()) >= w.fragmentDuration {
+			if err := w.flushFragment(); err != nil {
+				return err
+			}
+		}
+	}
+
+	f.sizes = append(f.sizes, uint32(len(sample)))
+	f.durations = append(f.durations, delta)
+	f.keyframes = append(f.keyframes, keyframe)
+	f.data = append(f.data, sample...)
+	w.duration += uint64(delta)
+	return nil
+}
+
+// flushFragment はたまったサンプルをmoof/mdatとして書き込み、ディスクへ同期する
+// 最初のフラグメントの前にmoovを書くが、SPS/PPSがまだ届いていなければデコードできないので捨てる
+func (w *MP4Writer) flushFragment() error {
+	f := &w.fragment
+	if len(f.sizes) == 0 {
+		return nil
+	}
+	defer func() {
+		f.sizes = f.sizes[:0]
+		f.durations = f.durations[:0]
+		f.keyframes = f.keyframes[:0]
+		f.data = f.data[:0]
+	}()
+
+	if !f.initialized {
+		if w.sps == nil || w.pps == nil {
+			w.duration -= f.length()
+			return nil
+		}
+		if _, err := w.file.Write(w.fragmentedMoovBox()); err != nil {
+			return err
+		}
+		f.initialized = true
+	}
+
+	f.sequence++
+	// data_offsetはmoofの先頭からmdatのデータまでの距離なので、moofの大きさを求めてから作り直す
+	moof := w.moofBox(0)
+	moof = w.moofBox(uint32(len(moof) + 8))
+
+	if _, err := w.file.Write(moof); err != nil {
+		return err
+	}
+	if _, err := w.file.Write(mp4Box("mdat", f.data)); err != nil {
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+
+	f.decodeTime += f.length()
+	f.written += len(f.sizes)
+	return nil
+}
+
+// moofBox は現在のフラグメントのmoofを作成
+func (w *MP4Writer) moofBox(dataOffset uint32) []byte {
+	f := &w.fragment
+
+	entries := make([]byte, 0, len(f.sizes)*12)
+	for i, size := range f.sizes {
+		flags := uint32(sampleFlagsNonKeyframe)
+		if f.keyframes[i] {
+			flags = sampleFlagsKeyframe
+		}
+		entries = append(entries, u32(f.durations[i])...)
+		entries = append(entries, u32(size)...)
+		entries = append(entries, u32(flags)...)
+	}
+
+	return mp4Box("moof",
+		mp4FullBox("mfhd", 0, 0, u32(f.sequence)),
+		mp4Box("traf",
+			mp4FullBox("tfhd", 0, 0x020000, u32(1)), // default-base-is-moof, track ID
+			mp4FullBox("tfdt", 1, 0, u64(f.decodeTime)),
+			// data-offset, sample-duration, sample-size, sample-flags
+			mp4FullBox("trun", 0, 0x000701, u32(uint32(len(f.sizes))), u32(dataOffset), entries),
+		),
+	)
+}
+
+// fragmentedMoovBox はフラグメント形式の初期化用moov（サンプルテーブルは空、mvexあり）を作成
+func (w *MP4Writer) fragmentedMoovBox() []byte {
+	delta := frameDelta(w.info)
+	stbl := mp4Box("stbl",
+		mp4FullBox("stsd", 0, 0, u32(1), w.avc1Box()),
+		mp4FullBox("stts", 0, 0, u32(0)),
+		mp4FullBox("stsc", 0, 0, u32(0)),
+		mp4FullBox("stsz", 0, 0, u32(0), u32(0)),
+		mp4FullBox("stco", 0, 0, u32(0)),
+	)
+	return mp4Box("moov",
+		mvhdBox(0, 2),
+		w.trakBox(0, 0, stbl),
+		mp4Box("mvex",
+			// track ID, sample description index, duration, size, flags の既定値
+			mp4FullBox("trex", 0, 0, u32(1), u32(1), u32(delta), u32(0), u32(0)),
+		),
+	)
+}
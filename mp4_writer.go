@@ -0,0 +1,548 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"GobotProject/h264"
+)
+
+// 録画ファイルの時間単位とフレームレート
+const (
+	movieTimescale   = 1000  // mvhd/tkhdの時間単位（ミリ秒）
+	videoTimescale   = 90000 // mdhd/sttsの時間単位（H.264の慣例）
+	defaultFrameRate = 30    // SPSにフレームレートがない場合（Telloの映像は30fps）
+)
+
+// SPSを解析できない場合に使うTelloの映像解像度
+const (
+	telloVideoWidth  = 960
+	telloVideoHeight = 720
+)
+
+// macEpochOffset は1904年1月1日（QuickTimeの時刻の基準）から1970年1月1日までの秒数
+const macEpochOffset = 2082844800
+
+// frameDelta はSPSのフレームレートから求めた1フレームの長さ（videoTimescale単位）を返す
+// フレームレートが分からない、または範囲外の場合は既定の30fpsとみなす
+func frameDelta(info *h264.SPS) uint32 {
+	if info != nil {
+		if fps := info.FrameRate(); fps >= 1 && fps <= 120 {
+			return uint32(math.Round(videoTimescale / fps))
+		}
+	}
+	return videoTimescale / defaultFrameRate
+}
+
+// mp4Sample はmdatに書き込んだ1フレームの位置と大きさ
+type mp4Sample struct {
+	offset   uint64
+	size     uint32
+	duration uint32 // 次のフレームの受信時刻までの長さ（videoTimescale単位）
+	keyframe bool
+}
+
+// MP4Writer はTelloのH.264ストリームからMOV/MP4ファイルを作成するクラス
+// 受信データをフレーム単位にまとめ、長さ付きNAL形式で届いた順にmdatへ書き込む
+// 各サンプルの長さはフレームの受信時刻の差から求めるので、フレームが欠落しても再生速度は変わらない
+// メモリにはサンプルの位置と大きさだけを保持し、Close時にmdatのサイズを確定して
+// avcCとサンプルテーブル（stts/stss/stsz/stsc/stco）を含むmoovを書き込む
+type MP4Writer struct {
+	file      *os.File
+	quickTime bool // .movならQuickTime形式のftyp/hdlrを使う（フラグメント形式はISO形式のみ）
+	startTime time.Time
+
+	assembler h264.Assembler
+	sps, pps  []byte    // avcCに格納するパラメータセット
+	info      *h264.SPS // SPSから読み取った解像度とフレームレート（解析できなければnil）
+	samples   []mp4Sample
+	timing    frameTiming // 受信時刻からサンプルの長さを求める
+	duration  uint64      // 書き込んだサンプルの長さの合計（videoTimescale単位）
+	mdatStart uint64      // mdatヘッダーの位置
+	mdatSize  uint64      // 書き込み済みのサンプルデータの大きさ
+	sample    []byte      // サンプル組み立て用のバッファ（再利用）
+
+	// フラグメント形式（fragmentDurationが0なら通常形式）
+	fragmentDuration time.Duration
+	fragment         mp4Fragment
+}
+
+// MP4Options は録画ファイルの形式の設定
+type MP4Options struct {
+	// FragmentDuration が0より大きい場合、その間隔ごとにmoof/mdatを書き込むフラグメント形式にする
+	// Closeが呼ばれずに終了しても、書き込み済みのフラグメントは再生できる
+	FragmentDuration time.Duration
+}
+
+// NewMP4Writer は新しいMP4ライターを作成（拡張子が.movならQuickTime形式）
+func NewMP4Writer(filename string) (*MP4Writer, error) {
+	return NewMP4WriterWithOptions(filename, MP4Options{})
+}
+
+// NewMP4WriterWithOptions は形式を指定してMP4ライターを作成
+func NewMP4WriterWithOptions(filename string, options MP4Options) (*MP4Writer, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := &MP4Writer{
+		file: file,
+		// フラグメント形式のftypはISO形式（iso5）なので、.movでもhdlrなどをISO形式にそろえる
+		quickTime:        strings.EqualFold(filepath.Ext(filename), ".mov") && options.FragmentDuration <= 0,
+		startTime:        time.Now(),
+		fragmentDuration: options.FragmentDuration,
+	}
+
+	// 通常形式ではftypと仮のmdatヘッダーを書き、以降のサンプルはその後ろに追記する
+	// フラグメント形式ではSPS/PPSが届いてからmoovを書くため、ここではftypだけ書く
+	header := writer.ftypBox()
+	writer.mdatStart = uint64(len(header))
+	if !writer.fragmented() {
+		header = append(header, writer.mdatHeader(0)...)
+	}
+	if _, err := file.Write(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return writer, nil
+}
+
+// formatName は書き込んでいるファイルの形式名を返す（フラグメント形式は拡張子によらずISO形式）
+func (w *MP4Writer) formatName() string {
+	switch {
+	case w.fragmented():
+		return fmt.Sprintf("フラグメントMP4（%s）", filepath.Ext(w.file.Name()))
+	case w.quickTime:
+		return "MOV"
+	}
+	return "MP4"
+}
+
+// fragmented はフラグメント形式かどうかを返す
+func (w *MP4Writer) fragmented() bool {
+	return w.fragmentDuration > 0
+}
+
+// WriteFrame はTelloから受信したビデオデータ（Annex-B形式の断片）を追加する
+func (w *MP4Writer) WriteFrame(frameData []byte) error {
+	if w.file == nil {
+		return ErrRecordingClosed
+	}
+	if len(frameData) == 0 {
+		return nil
+	}
+
+	for _, au := range w.assembler.Write(frameData) {
+		if err := w.writeSample(au); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteAccessUnit はフレーム単位にまとめたNALユニットを1サンプルとして書き込む
+func (w *MP4Writer) WriteAccessUnit(au h264.AccessUnit) error {
+	if w.file == nil {
+		return ErrRecordingClosed
+	}
+	return w.writeSample(au)
+}
+
+// writeSample は1フレームを長さ付きNAL形式のサンプルとしてmdatに追記する
+// SPS/PPSはavcCに格納し（キーフレームのサンプルにも残す）、AUDは不要なのでサンプルには含めない
+func (w *MP4Writer) writeSample(au h264.AccessUnit) error {
+	sample := w.sample[:0]
+	for _, nal := range au.NALs {
+		switch h264.TypeOf(nal) {
+		case h264.NALSPS:
+			if w.sps == nil && len(nal) >= 4 {
+				w.sps = nal
+				w.info, _ = h264.ParseSPS(nal)
+			}
+			// キーフレームのSPS/PPSはサンプルにも残し、moovがなくてもmdatだけでデコードできるようにする
+			if !au.Keyframe {
+				continue
+			}
+		case h264.NALPPS:
+			if w.pps == nil {
+				w.pps = nal
+			}
+			if !au.Keyframe {
+				continue
+			}
+		case h264.NALAUD:
+			continue
+		}
+		sample = binary.BigEndian.AppendUint32(sample, uint32(len(nal)))
+		sample = append(sample, nal...)
+	}
+	w.sample = sample
+	if len(sample) == 0 {
+		return nil
+	}
+
+	// 受信時刻が分かったので直前のサンプルの長さが決まる。このサンプルの長さは次のフレームまで仮の値にする
+	delta := w.timing.stamp(au.Time, frameDelta(w.info))
+	if w.fragmented() {
+		return w.addFragmentSample(sample, au.Keyframe, delta)
+	}
+
+	if _, err := w.file.Write(sample); err != nil {
+		return err
+	}
+	if n := len(w.samples); n > 0 {
+		w.retime(&w.samples[n-1].duration, delta)
+	}
+	w.samples = append(w.samples, mp4Sample{
+		offset:   w.mdatSize,
+		size:     uint32(len(sample)),
+		duration: delta,
+		keyframe: au.Keyframe,
+	})
+	w.duration += uint64(delta)
+	w.mdatSize += uint64(len(sample))
+	return nil
+}
+
+// retime はサンプルの長さ（仮の値）を受信時刻から求めた長さに置き換える
+func (w *MP4Writer) retime(duration *uint32, delta uint32) {
+	w.duration = w.duration - uint64(*duration) + uint64(delta)
+	*duration = delta
+}
+
+// FrameCount は書き込んだフレーム数を返す
+func (w *MP4Writer) FrameCount() int {
+	return len(w.samples) + w.fragment.written
+}
+
+// Duration は書き込んだフレームの再生時間を返す
+func (w *MP4Writer) Duration() time.Duration {
+	return ticksToDuration(w.duration)
+}
+
+// Gaps は受信間隔から推定したフレームの欠落を返す
+func (w *MP4Writer) Gaps() GapStats {
+	return w.timing.gaps
+}
+
+// VideoInfo はSPSから読み取った映像の情報を返す（まだ届いていない、または解析できなければnil）
+func (w *MP4Writer) VideoInfo() *h264.SPS {
+	return w.info
+}
+
+// dimensions は映像の幅と高さを返す
+func (w *MP4Writer) dimensions() (int, int) {
+	if w.info == nil {
+		return telloVideoWidth, telloVideoHeight
+	}
+	return w.info.Width, w.info.Height
+}
+
+// Close は残りのフレームを書き込み、MOV/MP4ファイルを完成させる
+func (w *MP4Writer) Close() error {
+	if w.file == nil {
+		return nil
+	}
+
+	var err error
+	for _, au := range w.assembler.Flush() {
+		if err == nil {
+			err = w.writeSample(au)
+		}
+	}
+	if err == nil {
+		if w.fragmented() {
+			err = w.flushFragment()
+		} else {
+			err = w.finalize()
+		}
+	}
+	if err != nil {
+		w.file.Close()
+		w.file = nil
+		return err
+	}
+
+	duration := time.Since(w.startTime)
+	log.Printf("%s録画完了: %d フレーム, 録画時間: %v", w.formatName(), w.FrameCount(), duration)
+	if gaps := w.Gaps(); gaps.Count > 0 {
+		log.Printf("フレームの欠落: %d 箇所（約 %d フレーム、最長 %v）", gaps.Count, gaps.Dropped, gaps.Longest)
+	}
+
+	err = w.file.Close()
+	w.file = nil
+	return err
+}
+
+// finalize はmdatのサイズを確定し、ファイル末尾にmoovを書き込む
+func (w *MP4Writer) finalize() error {
+	header := w.mdatHeader(w.mdatSize)
+	if _, err := w.file.WriteAt(header, int64(w.mdatStart)); err != nil {
+		return err
+	}
+
+	dataStart := w.mdatStart + uint64(len(header))
+	if _, err := w.file.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	_, err := w.file.Write(w.moovBox(dataStart))
+	return err
+}
+
+// mdatHeader はmdatのヘッダー（常に16バイト）を返す
+// 4GB以下なら空きボックス（MOVはwide、MP4はfree）と32ビットサイズのヘッダー、超える場合は64ビットサイズのヘッダーにする
+func (w *MP4Writer) mdatHeader(dataSize uint64) []byte {
+	if dataSize+8 <= math.MaxUint32 {
+		header := mp4Box("free")
+		if w.quickTime {
+			header = mp4Box("wide")
+		}
+		header = append(header, u32(uint32(dataSize+8))...)
+		return append(header, "mdat"...)
+	}
+	header := append(u32(1), "mdat"...)
+	return binary.BigEndian.AppendUint64(header, dataSize+16)
+}
+
+// ftypBox はファイル形式を示すftypボックスを作成
+func (w *MP4Writer) ftypBox() []byte {
+	if w.fragmented() {
+		// moof/mdatを含むファイルはQuickTime形式ではなくISO形式（iso5以降）として扱わせる
+		return mp4Box("ftyp", []byte("iso5"), u32(0x200), []byte("iso5iso6avc1mp41"))
+	}
+	if w.quickTime {
+		return mp4Box("ftyp", []byte("qt  "), u32(0x20050300), []byte("qt  "))
+	}
+	return mp4Box("ftyp", []byte("isom"), u32(0x200), []byte("isomiso2avc1mp41"))
+}
+
+// moovBox はムービー全体の情報（mvhdとビデオトラック）を作成
+// パラメータセットかフレームがない場合はトラックを含めない
+func (w *MP4Writer) moovBox(dataStart uint64) []byte {
+	mediaDuration := w.duration
+	movieDuration := uint32(mediaDuration * movieTimescale / videoTimescale)
+
+	if w.sps == nil || w.pps == nil || len(w.samples) == 0 {
+		return mp4Box("moov", mvhdBox(movieDuration, 1))
+	}
+	return mp4Box("moov",
+		mvhdBox(movieDuration, 2),
+		w.trakBox(movieDuration, uint32(mediaDuration), w.stblBox(dataStart)),
+	)
+}
+
+// trakBox はビデオトラックを作成
+func (w *MP4Writer) trakBox(movieDuration, mediaDuration uint32, stbl []byte) []byte {
+	width, height := w.dimensions()
+	return mp4Box("trak",
+		tkhdBox(movieDuration, width, height),
+		mp4Box("mdia",
+			mdhdBox(mediaDuration),
+			hdlrBox(w.quickTime, "mhlr", "vide", "VideoHandler"),
+			mp4Box("minf",
+				mp4FullBox("vmhd", 0, 1, make([]byte, 8)),
+				w.dataHandlerBox(),
+				mp4Box("dinf", mp4FullBox("dref", 0, 0, u32(1), mp4FullBox("url ", 0, 1))),
+				stbl,
+			),
+		),
+	)
+}
+
+// dataHandlerBox はQuickTime形式で必要なデータハンドラーのhdlrを作成（MP4では不要）
+func (w *MP4Writer) dataHandlerBox() []byte {
+	if !w.quickTime {
+		return nil
+	}
+	return hdlrBox(true, "dhlr", "url ", "DataHandler")
+}
+
+// stblBox はサンプルテーブルを作成（1サンプル=1チャンク）
+// sttsは同じ長さのサンプルが続く区間ごとにまとめる
+func (w *MP4Writer) stblBox(dataStart uint64) []byte {
+	count := uint32(len(w.samples))
+
+	var timeToSample, syncSamples, sizes, offsets []byte
+	timeEntries, syncCount := uint32(0), uint32(0)
+	useCo64 := dataStart+w.mdatSize > math.MaxUint32
+	for i, sample := range w.samples {
+		if i > 0 && sample.duration == w.samples[i-1].duration {
+			// 直前のエントリーのサンプル数を増やす
+			n := len(timeToSample) - 8
+			binary.BigEndian.PutUint32(timeToSample[n:], binary.BigEndian.Uint32(timeToSample[n:])+1)
+		} else {
+			timeToSample = append(timeToSample, u32(1)...)
+			timeToSample = append(timeToSample, u32(sample.duration)...)
+			timeEntries++
+		}
+		if sample.keyframe {
+			syncSamples = append(syncSamples, u32(uint32(i+1))...)
+			syncCount++
+		}
+		sizes = append(sizes, u32(sample.size)...)
+		if useCo64 {
+			offsets = binary.BigEndian.AppendUint64(offsets, dataStart+sample.offset)
+		} else {
+			offsets = append(offsets, u32(uint32(dataStart+sample.offset))...)
+		}
+	}
+
+	chunkOffsets := mp4FullBox("stco", 0, 0, u32(count), offsets)
+	if useCo64 {
+		chunkOffsets = mp4FullBox("co64", 0, 0, u32(count), offsets)
+	}
+
+	return mp4Box("stbl",
+		mp4FullBox("stsd", 0, 0, u32(1), w.avc1Box()),
+		mp4FullBox("stts", 0, 0, u32(timeEntries), timeToSample),
+		mp4FullBox("stss", 0, 0, u32(syncCount), syncSamples),
+		mp4FullBox("stsc", 0, 0, u32(1), u32(1), u32(1), u32(1)),
+		mp4FullBox("stsz", 0, 0, u32(0), u32(count), sizes),
+		chunkOffsets,
+	)
+}
+
+// avc1Box はH.264のサンプル記述（avc1とavcC）を作成
+func (w *MP4Writer) avc1Box() []byte {
+	compressorName := make([]byte, 32)
+	compressorName[0] = byte(copy(compressorName[1:], "H.264"))
+	width, height := w.dimensions()
+
+	avcC := []byte{
+		1,                            // configurationVersion
+		w.sps[1], w.sps[2], w.sps[3], // profile, compatibility, level
+		0xfc | 3, // lengthSizeMinusOne（4バイト長）
+		0xe0 | 1, // SPSの数
+	}
+	avcC = append(avcC, u16(uint16(len(w.sps)))...)
+	avcC = append(avcC, w.sps...)
+	avcC = append(avcC, 1) // PPSの数
+	avcC = append(avcC, u16(uint16(len(w.pps)))...)
+	avcC = append(avcC, w.pps...)
+
+	return mp4Box("avc1",
+		make([]byte, 6), u16(1), // reserved, data_reference_index
+		make([]byte, 16), // pre_defined, reserved
+		u16(uint16(width)), u16(uint16(height)),
+		u32(0x00480000), u32(0x00480000), // 72dpi
+		u32(0), u16(1), // reserved, frame_count
+		compressorName,
+		u16(0x0018), u16(0xffff), // depth, pre_defined
+		mp4Box("avcC", avcC),
+	)
+}
+
+// mvhdBox はムービーヘッダーを作成
+func mvhdBox(duration uint32, nextTrackID uint32) []byte {
+	now := macTime(time.Now())
+	return mp4FullBox("mvhd", 0, 0,
+		u32(now), u32(now),
+		u32(movieTimescale), u32(duration),
+		u32(0x00010000), u16(0x0100), // rate 1.0, volume 1.0
+		make([]byte, 10), // reserved
+		identityMatrix(),
+		make([]byte, 24), // pre_defined
+		u32(nextTrackID),
+	)
+}
+
+// tkhdBox はトラックヘッダーを作成
+func tkhdBox(duration uint32, width, height int) []byte {
+	now := macTime(time.Now())
+	return mp4FullBox("tkhd", 0, 0x3, // track enabled, in movie
+		u32(now), u32(now),
+		u32(1), u32(0), // track ID, reserved
+		u32(duration),
+		make([]byte, 8),                // reserved
+		u16(0), u16(0), u16(0), u16(0), // layer, alternate group, volume, reserved
+		identityMatrix(),
+		u32(uint32(width)<<16), u32(uint32(height)<<16),
+	)
+}
+
+// mdhdBox はメディアヘッダーを作成
+func mdhdBox(duration uint32) []byte {
+	now := macTime(time.Now())
+	return mp4FullBox("mdhd", 0, 0,
+		u32(now), u32(now),
+		u32(videoTimescale), u32(duration),
+		u16(0x55c4), u16(0), // language 'und', quality
+	)
+}
+
+// hdlrBox はハンドラー参照を作成
+// QuickTimeではコンポーネントタイプを指定し名前をPascal文字列にする
+func hdlrBox(quickTime bool, componentType, handlerType, name string) []byte {
+	var predefined, nameBytes []byte
+	if quickTime {
+		predefined = []byte(componentType)
+		nameBytes = append([]byte{byte(len(name))}, name...)
+	} else {
+		predefined = u32(0)
+		nameBytes = append([]byte(name), 0)
+	}
+	return mp4FullBox("hdlr", 0, 0,
+		predefined, []byte(handlerType),
+		make([]byte, 12), // reserved
+		nameBytes,
+	)
+}
+
+// identityMatrix は単位変換行列（36バイト）を返す
+func identityMatrix() []byte {
+	m := make([]byte, 0, 36)
+	for _, v := range []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000} {
+		m = append(m, u32(v)...)
+	}
+	return m
+}
+
+// macTime はQuickTime形式の時刻（1904年基準の秒数）を返す
+func macTime(t time.Time) uint32 {
+	return uint32(t.Unix() + macEpochOffset)
+}
+
+// mp4Box はサイズとタイプのヘッダーを付けたボックスを作成
+func mp4Box(boxType string, payloads ...[]byte) []byte {
+	size := 8
+	for _, p := range payloads {
+		size += len(p)
+	}
+	box := make([]byte, 0, size)
+	box = append(box, u32(uint32(size))...)
+	box = append(box, boxType...)
+	for _, p := range payloads {
+		box = append(box, p...)
+	}
+	return box
+}
+
+// mp4FullBox はバージョンとフラグを持つボックスを作成
+func mp4FullBox(boxType string, version byte, flags uint32, payloads ...[]byte) []byte {
+	header := u32(uint32(version)<<24 | flags&0xffffff)
+	return mp4Box(boxType, append([][]byte{header}, payloads...)...)
+}
+
+// u32 はビッグエンディアンの4バイトを返す
+func u32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+// u64 はビッグエンディアンの8バイトを返す
+func u64(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)
+}
+
+// u16 はビッグエンディアンの2バイトを返す
+func u16(v uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, v)
+}
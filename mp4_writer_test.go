@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"GobotProject/h264"
+	"GobotProject/simulator"
+)
+
+// testBox はテスト用に読み取ったボックス
+type testBox struct {
+	boxType string
+	payload []byte
+}
+
+// readBoxes は連続したボックスを読み取ります（64ビットサイズにも対応）
+func readBoxes(t *testing.T, data []byte) []testBox {
+	t.Helper()
+	var boxes []testBox
+	for len(data) > 0 {
+		if len(data) < 8 {
+			t.Fatalf("ボックスヘッダーが途中で切れています: %d バイト", len(data))
+		}
+		size := uint64(binary.BigEndian.Uint32(data))
+		header := uint64(8)
+		if size == 1 {
+			size = binary.BigEndian.Uint64(data[8:])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			t.Fatalf("%s ボックスのサイズが不正: %d（残り %d バイト）", data[4:8], size, len(data))
+		}
+		boxes = append(boxes, testBox{boxType: string(data[4:8]), payload: data[header:size]})
+		data = data[size:]
+	}
+	return boxes
+}
+
+// findBox はパスで指定したボックスの中身を返します（stsdの場合はエントリ部分から探します）
+func findBox(t *testing.T, data []byte, path ...string) []byte {
+	t.Helper()
+	for _, name := range path {
+		found := false
+		for _, box := range readBoxes(t, data) {
+			if box.boxType == name {
+				data = box.payload
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("%s ボックスが見つかりません（%v）", name, path)
+		}
+		switch name {
+		case "stsd":
+			data = data[8:] // version/flags, entry_count
+		case "avc1":
+			data = data[78:] // VisualSampleEntryの固定部分
+		}
+	}
+	return data
+}
+
+// fullBoxUint32s はフルボックスのversion/flagsの後ろを4バイト整数の列として返します
+func fullBoxUint32s(payload []byte) []uint32 {
+	var values []uint32
+	for i := 4; i+4 <= len(payload); i += 4 {
+		values = append(values, binary.BigEndian.Uint32(payload[i:]))
+	}
+	return values
+}
+
+// telloVideoPackets はシミュレーターの合成映像をTelloと同じ大きさのパケットに分割します
+func telloVideoPackets(gop, frames int) ([][]byte, [][]byte) {
+	stream := simulator.SyntheticStream(telloVideoWidth, telloVideoHeight, defaultFrameRate, gop)
+	var data []byte
+	var units [][]byte
+	for i := 0; i < frames; i++ {
+		au := stream[i%gop]
+		units = append(units, au)
+		data = append(data, au...)
+	}
+
+	var packets [][]byte
+	for len(data) > 0 {
+		n := min(1460, len(data))
+		packets = append(packets, data[:n])
+		data = data[n:]
+	}
+	return packets, units
+}
+
+// TestMP4WriterStoresSamples 受信した映像がサンプルテーブル付きで保存されることをテストします
+func TestMP4WriterStoresSamples(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.mov")
+	writer, err := NewMP4Writer(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const gop, frames = 10, 25
+	packets, units := telloVideoPackets(gop, frames)
+	// 途中から受信したデータ（スタートコードより前）は捨てられる
+	writer.WriteFrame([]byte{0x12, 0x34, 0x56})
+	for _, packet := range packets {
+		if err := writer.WriteFrame(packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Closeに失敗: %v", err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var types []string
+	for _, box := range readBoxes(t, data) {
+		types = append(types, box.boxType)
+	}
+	if !reflect.DeepEqual(types, []string{"ftyp", "wide", "mdat", "moov"}) {
+		t.Fatalf("トップレベルのボックス構成が不正: %v", types)
+	}
+	if brand := string(findBox(t, data, "ftyp")[:4]); brand != "qt  " {
+		t.Errorf(".movのブランドは qt であるべき: %q", brand)
+	}
+
+	stbl := []string{"moov", "trak", "mdia", "minf", "stbl"}
+	sizes := fullBoxUint32s(findBox(t, data, append(stbl, "stsz")...))
+	if sizes[0] != 0 || sizes[1] != frames || len(sizes[2:]) != frames {
+		t.Fatalf("stszのサンプル数が不正: %v", sizes[:2])
+	}
+	if got := fullBoxUint32s(findBox(t, data, append(stbl, "stss")...)); !reflect.DeepEqual(got, []uint32{3, 1, 11, 21}) {
+		t.Errorf("stssが不正: %v", got)
+	}
+	if got := fullBoxUint32s(findBox(t, data, append(stbl, "stts")...)); !reflect.DeepEqual(got, []uint32{1, frames, 3000}) {
+		t.Errorf("sttsが不正: %v", got)
+	}
+	if got := fullBoxUint32s(findBox(t, data, append(stbl, "stsc")...)); !reflect.DeepEqual(got, []uint32{1, 1, 1, 1}) {
+		t.Errorf("stscが不正: %v", got)
+	}
+
+	// チャンクオフセットの位置に長さ付きNALとして元のフレームが格納されている
+	// （キーフレームはSPS/PPSも含む）
+	offsets := fullBoxUint32s(findBox(t, data, append(stbl, "stco")...))[1:]
+	for i, offset := range offsets {
+		var expected []byte
+		for _, nal := range h264.SplitAnnexB(units[i]) {
+			expected = binary.BigEndian.AppendUint32(expected, uint32(len(nal)))
+			expected = append(expected, nal...)
+		}
+		sample := data[offset : offset+sizes[2+i]]
+		if !bytes.Equal(sample, expected) {
+			t.Fatalf("サンプル %d の内容が元のフレームと一致しません", i+1)
+		}
+	}
+
+	// avcCにSPS/PPSが格納されている
+	avcC := findBox(t, data, append(stbl, "stsd", "avc1", "avcC")...)
+	sps := h264.SplitAnnexB(units[0])[0]
+	if avcC[0] != 1 || avcC[1] != sps[1] || avcC[4] != 0xff || avcC[5] != 0xe1 {
+		t.Errorf("avcCのヘッダーが不正: % x", avcC[:6])
+	}
+	if spsLen := int(binary.BigEndian.Uint16(avcC[6:])); !bytes.Equal(avcC[8:8+spsLen], sps) {
+		t.Error("avcCのSPSが元のSPSと一致しません")
+	}
+
+	mdhd := findBox(t, data, "moov", "trak", "mdia", "mdhd")
+	if timescale, duration := binary.BigEndian.Uint32(mdhd[12:]), binary.BigEndian.Uint32(mdhd[16:]); timescale != 90000 || duration != frames*3000 {
+		t.Errorf("mdhdが不正: timescale=%d duration=%d", timescale, duration)
+	}
+}
+
+// TestMP4WriterUsesSPS SPSの解像度とフレームレートがトラックに反映されることをテストします
+func TestMP4WriterUsesSPS(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "hd.mp4")
+	writer, err := NewMP4Writer(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, au := range simulator.SyntheticStream(1280, 720, 25, 10) {
+		if err := writer.WriteFrame(au); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if info := writer.VideoInfo(); info == nil || info.Width != 1280 || info.FrameRate() != 25 {
+		t.Fatalf("SPSの情報が不正: %v", info)
+	}
+	if writer.Duration() != 400*time.Millisecond {
+		t.Errorf("再生時間: 期待 400ms, 実際 %v", writer.Duration())
+	}
+
+	data, _ := os.ReadFile(filename)
+	tkhd := findBox(t, data, "moov", "trak", "tkhd")
+	if width, height := binary.BigEndian.Uint32(tkhd[76:]), binary.BigEndian.Uint32(tkhd[80:]); width != 1280<<16 || height != 720<<16 {
+		t.Errorf("tkhdの解像度が不正: %x %x", width, height)
+	}
+	stbl := []string{"moov", "trak", "mdia", "minf", "stbl"}
+	avc1 := findBox(t, data, append(stbl, "stsd")...)
+	if width, height := binary.BigEndian.Uint16(avc1[8+24:]), binary.BigEndian.Uint16(avc1[8+26:]); width != 1280 || height != 720 {
+		t.Errorf("avc1の解像度が不正: %dx%d", width, height)
+	}
+	if got := fullBoxUint32s(findBox(t, data, append(stbl, "stts")...)); !reflect.DeepEqual(got, []uint32{1, 10, 3600}) {
+		t.Errorf("25fpsのsttsが不正: %v", got)
+	}
+}
+
+// TestMP4WriterArrivalTimes 受信時刻の差がサンプルの長さになることをテストします
+func TestMP4WriterArrivalTimes(t *testing.T) {
+	stream := simulator.SyntheticStream(telloVideoWidth, telloVideoHeight, defaultFrameRate, 10)
+	start := time.Unix(1000, 0)
+	// 4フレーム目の後に5フレーム分（約167ms）受信が途切れる
+	arrivals := []time.Duration{0, 33, 67, 100, 267, 300, 333}
+
+	for _, options := range []MP4Options{{}, {FragmentDuration: time.Second}} {
+		filename := filepath.Join(t.TempDir(), "vfr.mp4")
+		writer, err := NewMP4WriterWithOptions(filename, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, ms := range arrivals {
+			nals := h264.SplitAnnexB(stream[i])
+			au := h264.AccessUnit{NALs: nals, Keyframe: i == 0, Time: start.Add(ms * time.Millisecond)}
+			if err := writer.WriteAccessUnit(au); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// 最後のフレームは直前と同じ長さとみなす
+		if want := 366 * time.Millisecond; writer.Duration() != want {
+			t.Errorf("%v: 再生時間: 期待 %v, 実際 %v", options, want, writer.Duration())
+		}
+		if gaps := writer.Gaps(); gaps.Count != 1 || gaps.Dropped != 4 {
+			t.Errorf("%v: 欠落: %+v", options, gaps)
+		}
+
+		data, _ := os.ReadFile(filename)
+		var durations []uint32
+		if options.FragmentDuration == 0 {
+			stts := fullBoxUint32s(findBox(t, data, "moov", "trak", "mdia", "minf", "stbl", "stts"))
+			for i := 1; i+1 < len(stts); i += 2 {
+				for n := uint32(0); n < stts[i]; n++ {
+					durations = append(durations, stts[i+1])
+				}
+			}
+		} else {
+			trun := fullBoxUint32s(findBox(t, data, "moof", "traf", "trun"))
+			for i := 2; i < len(trun); i += 3 {
+				durations = append(durations, trun[i])
+			}
+		}
+		want := []uint32{2970, 3060, 2970, 15030, 2970, 2970, 2970}
+		if !reflect.DeepEqual(durations, want) {
+			t.Errorf("%v: サンプルの長さ: 期待 %v, 実際 %v", options, want, durations)
+		}
+	}
+}
+
+// TestMP4WriterEmptyRecording フレームがなくても構造の正しいファイルになることをテストします
+func TestMP4WriterEmptyRecording(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "empty.mp4")
+	writer, err := NewMP4Writer(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteFrame([]byte{0, 0, 1, 0x65}); err == nil {
+		t.Error("Close後の書き込みはエラーにすべき")
+	}
+
+	data, _ := os.ReadFile(filename)
+	if brand := string(findBox(t, data, "ftyp")[:4]); brand != "isom" {
+		t.Errorf(".mp4のブランドは isom であるべき: %q", brand)
+	}
+	if mdat := findBox(t, data, "mdat"); len(mdat) != 0 {
+		t.Errorf("mdatは空であるべき: %d バイト", len(mdat))
+	}
+	if moov := readBoxes(t, findBox(t, data, "moov")); len(moov) != 1 || moov[0].boxType != "mvhd" {
+		t.Errorf("フレームがなければトラックは含めない: %v", moov)
+	}
+}
+
+// TestMP4WriterFragmented Closeせずに終了しても書き込み済みのフラグメントが読めることをテストします
+func TestMP4WriterFragmented(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "fragmented.mov")
+	writer, err := NewMP4WriterWithOptions(filename, MP4Options{FragmentDuration: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const gop, frames = 30, 75 // 1秒分のフラグメント2つと、書き込み待ちの0.5秒
+	packets, _ := telloVideoPackets(gop, frames)
+	for _, packet := range packets {
+		if err := writer.WriteFrame(packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Closeを呼ぶ前（プロセスが落ちた状態）のファイルを調べる
+	checkFragments := func(data []byte, expected []uint32) {
+		t.Helper()
+		var types []string
+		var counts []uint32
+		var decodeTime uint64
+		for _, box := range readBoxes(t, data) {
+			types = append(types, box.boxType)
+			if box.boxType != "moof" {
+				continue
+			}
+			traf := findBox(t, box.payload, "traf")
+			tfdt := findBox(t, traf, "tfdt")
+			if got := binary.BigEndian.Uint64(tfdt[4:]); got != decodeTime {
+				t.Errorf("tfdtが不正: 期待 %d, 実際 %d", decodeTime, got)
+			}
+			trun := fullBoxUint32s(findBox(t, traf, "trun"))
+			counts = append(counts, trun[0])
+			decodeTime += uint64(trun[0]) * 3000
+			// data_offsetはmoofの先頭からmdatの中身までの距離
+			if trun[1] != uint32(len(box.payload)+8+8) {
+				t.Errorf("trunのdata_offsetが不正: %d", trun[1])
+			}
+			if trun[4] != sampleFlagsKeyframe || trun[7] != sampleFlagsNonKeyframe {
+				t.Errorf("サンプルフラグが不正: %x %x", trun[4], trun[7])
+			}
+		}
+
+		want := []string{"ftyp", "moov"}
+		for range expected {
+			want = append(want, "moof", "mdat")
+		}
+		if !reflect.DeepEqual(types, want) {
+			t.Fatalf("トップレベルのボックス構成が不正: %v", types)
+		}
+		if !reflect.DeepEqual(counts, expected) {
+			t.Errorf("フラグメントごとのサンプル数: 期待 %v, 実際 %v", expected, counts)
+		}
+		if trex := fullBoxUint32s(findBox(t, data, "moov", "mvex", "trex")); trex[0] != 1 {
+			t.Errorf("trexのトラックIDが不正: %v", trex)
+		}
+		findBox(t, data, "moov", "trak", "mdia", "minf", "stbl", "stsd", "avc1", "avcC")
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFragments(data, []uint32{30, 30})
+	if brand := string(findBox(t, data, "ftyp")[:4]); brand != "iso5" {
+		t.Errorf("フラグメント形式のブランドは iso5 であるべき: %q", brand)
+	}
+	// .movでもftypに合わせてISO形式のhdlr（コンポーネントタイプなし）にする
+	if hdlr := findBox(t, data, "moov", "trak", "mdia", "hdlr"); string(hdlr[4:8]) != "\x00\x00\x00\x00" || string(hdlr[8:12]) != "vide" {
+		t.Errorf("フラグメント形式のhdlrはISO形式であるべき: %q", hdlr[4:12])
+	}
+
+	// Closeすると残りのサンプルも書き込まれる
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if writer.FrameCount() != frames {
+		t.Errorf("フレーム数: 期待 %d, 実際 %d", frames, writer.FrameCount())
+	}
+	data, _ = os.ReadFile(filename)
+	checkFragments(data, []uint32{30, 30, 15})
+}
+
+// writeTestRecording は合成映像を指定フレーム数だけ録画し、書き込み中のヒープ増加量を返します
+func writeTestRecording(tb testing.TB, filename string, frames int) uint64 {
+	tb.Helper()
+	packets, _ := telloVideoPackets(defaultFrameRate, defaultFrameRate)
+
+	writer, err := NewMP4Writer(filename)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	for i := 0; i < frames/defaultFrameRate; i++ {
+		for _, packet := range packets {
+			if err := writer.WriteFrame(packet); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+
+	if err := writer.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	if after.HeapAlloc < before.HeapAlloc {
+		return 0
+	}
+	return after.HeapAlloc - before.HeapAlloc
+}
+
+// TestMP4WriterStreamsToDisk 録画データをメモリに溜めずにファイルへ書き込むことをテストします
+func TestMP4WriterStreamsToDisk(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "long.mov")
+	const frames = 3000 // 約100秒
+	growth := writeTestRecording(t, filename, frames)
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// メモリに残るのはサンプルの索引（1フレーム数十バイト）だけ
+	if growth > uint64(info.Size())/10 {
+		t.Errorf("録画中のヒープ増加が大きすぎます: %d バイト（ファイル %d バイト）", growth, info.Size())
+	}
+}
+
+// BenchmarkMP4WriterMemory 録画の長さによらずヒープ使用量がほぼ一定であることを示します
+// 例: go test -run=^$ -bench=MP4WriterMemory -benchmem
+func BenchmarkMP4WriterMemory(b *testing.B) {
+	for _, frames := range []int{900, 9000, 18000} { // 30秒・5分・10分
+		b.Run(fmt.Sprintf("%dframes", frames), func(b *testing.B) {
+			dir := b.TempDir()
+			var growth uint64
+			for i := 0; i < b.N; i++ {
+				growth = writeTestRecording(b, filepath.Join(dir, "bench.mov"), frames)
+			}
+			b.ReportMetric(float64(growth), "heap-bytes")
+			b.ReportMetric(float64(growth)/float64(frames), "heap-bytes/frame")
+		})
+	}
+}
+
+// TestMP4WriterCloseMessage 録画完了のメッセージに実際のファイル形式を表示することをテストします
+func TestMP4WriterCloseMessage(t *testing.T) {
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		filename string
+		options  MP4Options
+		expected string
+	}{
+		{"recording.mov", MP4Options{}, "MOV録画完了"},
+		{"recording.mp4", MP4Options{}, "MP4録画完了"},
+		{"recording.mov", MP4Options{FragmentDuration: time.Second}, "フラグメントMP4（.mov）録画完了"},
+	}
+	for _, tt := range tests {
+		output.Reset()
+		writer, err := NewMP4WriterWithOptions(filepath.Join(t.TempDir(), tt.filename), tt.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(output.String(), tt.expected) {
+			t.Errorf("%s %v: 期待 %q, 実際 %q", tt.filename, tt.options, tt.expected, output.String())
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// 写真の転送に使うTelloバイナリプロトコルのメッセージID
+const (
+	msgFileSize = 0x0062 // 写真の大きさとファイルID
+	msgFileData = 0x0063 // 写真データのチャンク
+)
+
+// 写真の転送単位（1ピース = 最大8チャンク、1チャンク = 最大1024バイト）
+const (
+	photoChunkSize      = 1024
+	photoChunksPerPiece = 8
+)
+
+// PictureDataEvent はドローンから届いた写真の転送パケット（FilePacket）を通知するイベント
+const PictureDataEvent = "picturedata"
+
+// FilePacket は写真の転送パケット（msgFileSize または msgFileData のペイロード）
+type FilePacket struct {
+	Type    uint16
+	Payload []byte
+}
+
+// PictureTaker は写真撮影に対応したドローン
+// TakePictureで撮影を指示すると、写真の転送パケットをPictureDataEventで通知する
+// 転送の確認応答（ACK）はドライバー側で送る
+//
+// gobot v1.16 の tello.Driver は撮影コマンドを持たず、転送パケットも受信時に捨ててしまうため、
+// 設定で中継を有効にした TelloDriver が、通信を中継してこれを補う（photo_driver.go）
+type PictureTaker interface {
+	TakePicture() error
+}
+
+// 写真撮影のエラー
+var (
+	ErrPhotoUnsupported = errors.New("このドローンのドライバーは写真撮影に対応していません（実機では設定ファイルの photo.relay を有効にすると撮影できます）")
+	ErrPhotoBusy        = errors.New("前の写真を受信中です")
+	ErrPhotoNotJPEG     = errors.New("受信したデータがJPEGではありません")
+)
+
+// photoAssembler はチャンクに分かれて届く写真データを1つのファイルに組み立てる
+// チャンクは順不同・重複して届くことがあるので、位置を計算して書き込み、受信済みのものは数えない
+type photoAssembler struct {
+	fileID   uint16
+	size     int
+	data     []byte
+	chunks   map[int]bool // 受信済みのチャンク番号（ファイル先頭からの通し番号）
+	received int          // 受信済みのバイト数
+}
+
+// newPhotoAssembler はmsgFileSizeのペイロード（ファイル種別1バイト、大きさ4バイト、ファイルID2バイト）から組み立てを始める
+func newPhotoAssembler(payload []byte) (*photoAssembler, error) {
+	if len(payload) < 7 {
+		return nil, fmt.Errorf("写真の大きさのメッセージが短すぎます: %d バイト", len(payload))
+	}
+	size := int(binary.LittleEndian.Uint32(payload[1:5]))
+	if size <= 0 || size > 16<<20 {
+		return nil, fmt.Errorf("写真の大きさが不正です: %d バイト", size)
+	}
+	return &photoAssembler{
+		fileID: binary.LittleEndian.Uint16(payload[5:7]),
+		size:   size,
+		data:   make([]byte, size),
+		chunks: make(map[int]bool),
+	}, nil
+}
+
+// add はmsgFileDataのペイロード（ファイルID2バイト、ピース番号4バイト、チャンク番号4バイト、長さ2バイト、データ）を書き込む
+// 別のファイルのチャンクは無視する
+func (p *photoAssembler) add(payload []byte) error {
+	if len(payload) < 12 {
+		return fmt.Errorf("写真データのメッセージが短すぎます: %d バイト", len(payload))
+	}
+	if binary.LittleEndian.Uint16(payload[0:2]) != p.fileID {
+		return nil
+	}
+	piece := int(binary.LittleEndian.Uint32(payload[2:6]))
+	chunk := int(binary.LittleEndian.Uint32(payload[6:10]))
+	length := int(binary.LittleEndian.Uint16(payload[10:12]))
+	if chunk >= photoChunksPerPiece || length > photoChunkSize || 12+length > len(payload) {
+		return fmt.Errorf("写真データのチャンクが不正です（ピース %d, チャンク %d, %d バイト）", piece, chunk, length)
+	}
+
+	index := piece*photoChunksPerPiece + chunk
+	offset := index * photoChunkSize
+	if offset+length > p.size {
+		return fmt.Errorf("写真データがファイルの大きさを超えています（ピース %d, チャンク %d）", piece, chunk)
+	}
+	if p.chunks[index] {
+		return nil
+	}
+	copy(p.data[offset:], payload[12:12+length])
+	p.chunks[index] = true
+	p.received += length
+	return nil
+}
+
+// complete はすべてのデータを受信したかどうかを返す
+func (p *photoAssembler) complete() bool {
+	return p.received >= p.size
+}
+
+// pieceComplete はピースのチャンクをすべて受信したかどうかを返す（最後のピースはチャンクが8つより少ない）
+func (p *photoAssembler) pieceComplete(piece int) bool {
+	chunks := (p.size + photoChunkSize - 1) / photoChunkSize
+	first := piece * photoChunksPerPiece
+	if piece < 0 || first >= chunks {
+		return false
+	}
+	for index := first; index < min(first+photoChunksPerPiece, chunks); index++ {
+		if !p.chunks[index] {
+			return false
+		}
+	}
+	return true
+}
+
+// progress は受信済みの割合（0〜1）を返す
+func (p *photoAssembler) progress() float64 {
+	return float64(p.received) / float64(p.size)
+}
+
+// jpeg は組み立てたJPEGデータを返す（SOIとEOIがなければエラー）
+func (p *photoAssembler) jpeg() ([]byte, error) {
+	if !bytes.HasPrefix(p.data, []byte{0xff, 0xd8}) || !bytes.HasSuffix(bytes.TrimRight(p.data, "\x00"), []byte{0xff, 0xd9}) {
+		return nil, ErrPhotoNotJPEG
+	}
+	return p.data, nil
+}
+
+// photoTimeout は撮影を指示してから写真を受信し終えるまでの制限時間
+const photoTimeout = 10 * time.Second
+
+// PhotoStatus は写真撮影の状態
+type PhotoStatus struct {
+	Pending  bool    // 撮影を指示して受信を待っている
+	Progress float64 // 受信済みの割合（0〜1）
+	LastFile string  // 最後に保存した写真のファイル名
+}
+
+// TakePhoto はドローンに写真撮影を指示する
+// 写真は受信し終えたら録画ファイルと同じ場所に tello_photo_日時.jpg として保存し、結果をイベントログに表示する
+func (cv *CameraViewer) TakePhoto() error {
+	taker, ok := cv.drone.(PictureTaker)
+	if !ok {
+		cv.notify("写真撮影に失敗: %v", ErrPhotoUnsupported)
+		return ErrPhotoUnsupported
+	}
+
+	cv.photoMutex.Lock()
+	if cv.photoPending {
+		cv.photoMutex.Unlock()
+		cv.notify("写真撮影に失敗: %v", ErrPhotoBusy)
+		return ErrPhotoBusy
+	}
+	// 撮影の直後から転送が始まるので、先に受信の準備をする
+	requested := time.Now()
+	cv.photoPending = true
+	cv.photo = nil
+	cv.photoRequested = requested
+	cv.photoTimer = time.AfterFunc(photoTimeout, func() { cv.photoTimedOut(requested) })
+	cv.photoMutex.Unlock()
+
+	if err := taker.TakePicture(); err != nil {
+		cv.photoMutex.Lock()
+		cv.endPhotoLocked()
+		cv.photoMutex.Unlock()
+		cv.notify("写真撮影に失敗: %v", err)
+		return err
+	}
+	cv.notify("写真を撮影しています...")
+	return nil
+}
+
+// handleFilePacket は写真の転送パケットを組み立て、受信し終えたら保存する
+// 撮影を指示していないときに届いたパケットは無視する
+func (cv *CameraViewer) handleFilePacket(packet FilePacket) {
+	cv.photoMutex.Lock()
+	if !cv.photoPending {
+		cv.photoMutex.Unlock()
+		return
+	}
+
+	var err error
+	switch packet.Type {
+	case msgFileSize:
+		cv.photo, err = newPhotoAssembler(packet.Payload)
+	case msgFileData:
+		if cv.photo == nil {
+			cv.photoMutex.Unlock()
+			return
+		}
+		err = cv.photo.add(packet.Payload)
+	}
+
+	var data []byte
+	if err == nil && cv.photo != nil && cv.photo.complete() {
+		data, err = cv.photo.jpeg()
+	}
+	if err == nil && data == nil {
+		cv.photoMutex.Unlock()
+		return
+	}
+	elapsed := time.Since(cv.photoRequested)
+	cv.endPhotoLocked()
+	cv.photoMutex.Unlock()
+
+	if err != nil {
+		cv.notify("写真の受信に失敗: %v", err)
+		return
+	}
+	filename, err := savePhoto(data, time.Now())
+	if err != nil {
+		cv.notify("写真の保存に失敗: %v", err)
+		return
+	}
+
+	cv.photoMutex.Lock()
+	cv.lastPhoto = filename
+	cv.photoMutex.Unlock()
+	cv.notify("写真を保存しました: %s（%d KB, %.1f秒）", filename, len(data)/1024, elapsed.Seconds())
+}
+
+// photoTimedOut は制限時間内に写真を受信し終えなかった場合に呼ばれる
+func (cv *CameraViewer) photoTimedOut(requested time.Time) {
+	cv.photoMutex.Lock()
+	if !cv.photoPending || !cv.photoRequested.Equal(requested) {
+		cv.photoMutex.Unlock()
+		return
+	}
+	progress := 0.0
+	if cv.photo != nil {
+		progress = cv.photo.progress()
+	}
+	cv.endPhotoLocked()
+	cv.photoMutex.Unlock()
+
+	cv.notify("写真の受信に失敗: %v以内に受信できませんでした（%.0f%% 受信）", photoTimeout, progress*100)
+}
+
+// endPhotoLocked は写真の受信を終える（photoMutexを保持して呼ぶ）
+func (cv *CameraViewer) endPhotoLocked() {
+	cv.photoPending = false
+	cv.photo = nil
+	if cv.photoTimer != nil {
+		cv.photoTimer.Stop()
+		cv.photoTimer = nil
+	}
+}
+
+// PhotoStatus は写真撮影の状態を返す
+func (cv *CameraViewer) PhotoStatus() PhotoStatus {
+	cv.photoMutex.Lock()
+	defer cv.photoMutex.Unlock()
+	status := PhotoStatus{Pending: cv.photoPending, LastFile: cv.lastPhoto}
+	if cv.photo != nil {
+		status.Progress = cv.photo.progress()
+	}
+	return status
+}
+
+// savePhoto はJPEGデータを tello_photo_日時.jpg として保存し、ファイル名を返す
+func savePhoto(data []byte, now time.Time) (string, error) {
+	filename := fmt.Sprintf("tello_photo_%s.jpg", now.Format("20060102_150405.000000"))
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+
+	"gobot.io/x/gobot/platforms/dji/tello"
+)
+
+// 写真撮影に使うTelloバイナリプロトコルのメッセージID（msgFileSize・msgFileDataはphoto.go）
+const (
+	msgTakePicture  = 0x0030 // 撮影の指示
+	msgFileComplete = 0x0064 // 写真の受信完了
+)
+
+// Telloバイナリプロトコルのパケット種別
+const (
+	packetTypeCommand  = 0x68 // 応答を求めるコマンド（gobotの離陸などと同じ）
+	packetTypeAck      = 0x50 // 転送の確認応答
+	packetTypeComplete = 0x48 // 受信完了の通知
+)
+
+// relayAddress はドライバーの制御パケットを受ける中継のアドレス
+// ドライバーは送信先のポートを8889に固定しているため、中継も8889で待ち受ける
+const relayAddress = "127.0.0.1:8889"
+
+// ErrRelayLoopback はドローンが中継と同じループバックのアドレスにいて中継できない
+var ErrRelayLoopback = errors.New("ドローンがこのPC上にあるため中継できません（シミュレーター）")
+
+// telloRelay はドライバーとドローンの間で制御パケットを中継する（設定で写真撮影を有効にした場合のみ）
+// gobot v1.16 のドライバーは撮影コマンドを持たず、写真の転送パケットも受信時に捨ててしまうため、
+// 撮影の指示と写真の転送（msgFileSize・msgFileData）だけをここで扱い、それ以外はそのまま転送する
+type telloRelay struct {
+	local   *net.UDPConn // ドライバーからのパケットを受ける
+	remote  *net.UDPConn // ドローンとの通信
+	publish func(FilePacket)
+
+	mu       sync.Mutex
+	driver   *net.UDPAddr    // 最後にパケットを受けたドライバーのアドレス
+	seq      uint16          // 中継が送るパケットのシーケンス番号
+	transfer *photoAssembler // 受信中の写真（確認応答するピースの判定に使う）
+}
+
+// newTelloRelay は listen で待ち受け、drone へ中継する（開始はstart）
+func newTelloRelay(listen, drone string, publish func(FilePacket)) (*telloRelay, error) {
+	listenAddr, err := net.ResolveUDPAddr("udp", listen)
+	if err != nil {
+		return nil, err
+	}
+	droneAddr, err := net.ResolveUDPAddr("udp", drone)
+	if err != nil {
+		return nil, err
+	}
+	local, err := net.ListenUDP("udp", listenAddr)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := net.DialUDP("udp", nil, droneAddr)
+	if err != nil {
+		local.Close()
+		return nil, err
+	}
+	return &telloRelay{local: local, remote: remote, publish: publish}, nil
+}
+
+// start は両方向の中継を開始する
+func (r *telloRelay) start() {
+	go r.fromDriver()
+	go r.fromDrone()
+}
+
+// close は中継を閉じる
+func (r *telloRelay) close() {
+	r.local.Close()
+	r.remote.Close()
+}
+
+// fromDriver はドライバーからのパケットをドローンへ送る
+func (r *telloRelay) fromDriver() {
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := r.local.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			continue
+		}
+		r.mu.Lock()
+		r.driver = addr
+		r.mu.Unlock()
+		r.remote.Write(buf[:n])
+	}
+}
+
+// fromDrone はドローンからのパケットをドライバーへ渡す（写真の転送パケットを除く）
+func (r *telloRelay) fromDrone() {
+	buf := make([]byte, 2048)
+	for {
+		n, err := r.remote.Read(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		// ドローンに届かなかった送信のエラー（ICMP）も読み取りで返るので、読み続ける
+		if err != nil {
+			continue
+		}
+		if r.handleFile(buf[:n]) {
+			continue
+		}
+		r.mu.Lock()
+		driver := r.driver
+		r.mu.Unlock()
+		if driver != nil {
+			r.local.WriteToUDP(buf[:n], driver)
+		}
+	}
+}
+
+// handleFile は撮影と写真の転送のパケットを処理し、処理したかどうかを返す
+func (r *telloRelay) handleFile(packet []byte) bool {
+	msgType, payload, ok := parseTelloPacket(packet)
+	if !ok {
+		return false
+	}
+
+	switch msgType {
+	case msgTakePicture:
+		// 撮影の指示への応答（ドライバーは知らないメッセージなので渡さない）
+		return true
+	case msgFileSize:
+		r.send(msgFileSize, packetTypeAck, []byte{0x00})
+		if transfer, err := newPhotoAssembler(payload); err == nil {
+			r.mu.Lock()
+			r.transfer = transfer
+			r.mu.Unlock()
+		}
+	case msgFileData:
+		r.ackFileData(payload)
+	default:
+		return false
+	}
+
+	r.publish(FilePacket{Type: msgType, Payload: append([]byte(nil), payload...)})
+	return true
+}
+
+// ackFileData はチャンクを記録し、ピースがそろったら確認応答を、写真がそろったら受信完了を送る
+// 確認応答が届かずに再送されたピースにも、もう一度確認応答を返す
+func (r *telloRelay) ackFileData(payload []byte) {
+	r.mu.Lock()
+	transfer := r.transfer
+	if transfer == nil || len(payload) < 12 || transfer.add(payload) != nil {
+		r.mu.Unlock()
+		return
+	}
+	piece := int(binary.LittleEndian.Uint32(payload[2:6]))
+	pieceDone := transfer.pieceComplete(piece)
+	fileDone := transfer.complete()
+	if fileDone {
+		r.transfer = nil
+	}
+	r.mu.Unlock()
+
+	if pieceDone {
+		ack := []byte{0x00}
+		ack = binary.LittleEndian.AppendUint16(ack, transfer.fileID)
+		ack = binary.LittleEndian.AppendUint32(ack, uint32(piece))
+		r.send(msgFileData, packetTypeAck, ack)
+	}
+	if fileDone {
+		done := binary.LittleEndian.AppendUint16(nil, transfer.fileID)
+		done = binary.LittleEndian.AppendUint32(done, uint32(transfer.size))
+		r.send(msgFileComplete, packetTypeComplete, done)
+	}
+}
+
+// send は中継からドローンへパケットを送る
+func (r *telloRelay) send(msgType uint16, packetType byte, payload []byte) error {
+	r.mu.Lock()
+	r.seq++
+	seq := r.seq
+	r.mu.Unlock()
+
+	_, err := r.remote.Write(buildTelloPacket(msgType, packetType, seq, payload))
+	return err
+}
+
+// buildTelloPacket はTelloバイナリプロトコルのパケットを組み立てる
+// 0xcc、長さ（11+ペイロード、3ビット左シフト）、CRC8、種別、メッセージID、シーケンス番号、ペイロード、CRC16
+func buildTelloPacket(msgType uint16, packetType byte, seq uint16, payload []byte) []byte {
+	packet := []byte{0xcc}
+	packet = binary.LittleEndian.AppendUint16(packet, uint16(len(payload)+11)<<3)
+	packet = append(packet, tello.CalculateCRC8(packet))
+	packet = append(packet, packetType)
+	packet = binary.LittleEndian.AppendUint16(packet, msgType)
+	packet = binary.LittleEndian.AppendUint16(packet, seq)
+	packet = append(packet, payload...)
+	return binary.LittleEndian.AppendUint16(packet, tello.CalculateCRC16(packet))
+}
+
+// parseTelloPacket はTelloバイナリプロトコルのパケットからメッセージIDとペイロード（CRC16を除く）を取り出す
+func parseTelloPacket(packet []byte) (uint16, []byte, bool) {
+	if len(packet) < 11 || packet[0] != 0xcc {
+		return 0, nil, false
+	}
+	return binary.LittleEndian.Uint16(packet[5:7]), packet[9 : len(packet)-2], true
+}
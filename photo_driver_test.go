@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// readUDP は1つのパケットを受信して送信元とともに返す
+func readUDP(t *testing.T, conn *net.UDPConn) ([]byte, *net.UDPAddr) {
+	t.Helper()
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, addr, err := conn.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("パケットを受信できません: %v", err)
+	}
+	return buf[:n], addr
+}
+
+// TestTelloRelay 制御パケットを中継し、写真の転送パケットは通知して確認応答を返すことをテストします
+func TestTelloRelay(t *testing.T) {
+	drone, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer drone.Close()
+
+	published := make(chan FilePacket, 32)
+	relay, err := newTelloRelay("127.0.0.1:0", drone.LocalAddr().String(), func(packet FilePacket) {
+		published <- packet
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay.start()
+	defer relay.close()
+
+	driver, err := net.DialUDP("udp", nil, relay.local.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+
+	// ドライバーとドローンの間で中継する
+	driver.Write([]byte("conn_req:\x67\x2b"))
+	got, relayAddr := readUDP(t, drone)
+	if string(got) != "conn_req:\x67\x2b" {
+		t.Errorf("ドローンへの中継が不正: %q", got)
+	}
+	drone.WriteToUDP([]byte("conn_ack:"), relayAddr)
+	if got, _ := readUDP(t, driver); string(got) != "conn_ack:" {
+		t.Errorf("ドライバーへの中継が不正: %q", got)
+	}
+
+	// 撮影の指示
+	if err := relay.send(msgTakePicture, packetTypeCommand, nil); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = readUDP(t, drone)
+	if msgType, payload, ok := parseTelloPacket(got); !ok || msgType != msgTakePicture || len(payload) != 0 || got[4] != packetTypeCommand {
+		t.Errorf("撮影の指示が不正: % x", got)
+	}
+	if expected := []byte{0xcc, 0x58, 0x00}; !bytes.Equal(got[:3], expected) {
+		t.Errorf("パケットの長さが不正: % x", got[:3])
+	}
+
+	// 2ピース（8チャンクと1チャンク）の写真を転送する
+	packets := filePackets(5, testJPEG(9*photoChunkSize-100))
+	for i, packet := range packets {
+		drone.WriteToUDP(buildTelloPacket(packet.Type, 0x50, uint16(i), packet.Payload), relayAddr)
+	}
+	var acks []FilePacket
+	for range 4 {
+		got, _ := readUDP(t, drone)
+		msgType, payload, _ := parseTelloPacket(got)
+		acks = append(acks, FilePacket{Type: msgType, Payload: payload})
+	}
+	// 大きさへの応答、ピースごとの応答（ファイルID、ピース番号）、受信完了（ファイルID、大きさ 9116 = 0x239c）
+	expectedAcks := []FilePacket{
+		{Type: msgFileSize, Payload: []byte{0x00}},
+		{Type: msgFileData, Payload: []byte{0x00, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{Type: msgFileData, Payload: []byte{0x00, 0x05, 0x00, 0x01, 0x00, 0x00, 0x00}},
+		{Type: msgFileComplete, Payload: []byte{0x05, 0x00, 0x9c, 0x23, 0x00, 0x00}},
+	}
+	if !reflect.DeepEqual(acks, expectedAcks) {
+		t.Errorf("確認応答が不正\n期待: %x\n実際: %x", expectedAcks, acks)
+	}
+	for i, packet := range packets {
+		select {
+		case got := <-published:
+			if !reflect.DeepEqual(got, packet) {
+				t.Errorf("%d番目の通知が不正: %x", i, got.Type)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%d番目の転送パケットが通知されません", i)
+		}
+	}
+
+	// 転送パケットはドライバーへ渡さず、それ以外のパケットは渡す
+	flightData := buildTelloPacket(0x56, 0x88, 0, make([]byte, 24))
+	drone.WriteToUDP(flightData, relayAddr)
+	if got, _ := readUDP(t, driver); !bytes.Equal(got, flightData) {
+		t.Errorf("ドライバーへ渡すべきパケットが不正: % x", got)
+	}
+}
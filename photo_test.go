@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nsf/termbox-go"
+	"gobot.io/x/gobot/platforms/dji/tello"
+)
+
+// testJPEG はSOIとEOIを持つ大きさsizeのダミーJPEGを作る
+func testJPEG(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	copy(data, []byte{0xff, 0xd8})
+	copy(data[size-2:], []byte{0xff, 0xd9})
+	return data
+}
+
+// filePackets は写真をTelloの転送パケット（大きさ、チャンクの順）に分ける
+func filePackets(fileID uint16, data []byte) []FilePacket {
+	size := make([]byte, 7)
+	binary.LittleEndian.PutUint32(size[1:], uint32(len(data)))
+	binary.LittleEndian.PutUint16(size[5:], fileID)
+	packets := []FilePacket{{Type: msgFileSize, Payload: size}}
+
+	for index := 0; index*photoChunkSize < len(data); index++ {
+		chunk := data[index*photoChunkSize : min((index+1)*photoChunkSize, len(data))]
+		payload := binary.LittleEndian.AppendUint16(nil, fileID)
+		payload = binary.LittleEndian.AppendUint32(payload, uint32(index/photoChunksPerPiece))
+		payload = binary.LittleEndian.AppendUint32(payload, uint32(index%photoChunksPerPiece))
+		payload = binary.LittleEndian.AppendUint16(payload, uint16(len(chunk)))
+		packets = append(packets, FilePacket{Type: msgFileData, Payload: append(payload, chunk...)})
+	}
+	return packets
+}
+
+// TestPhotoAssembler 順不同・重複して届いたチャンクから写真を組み立てることをテストします
+func TestPhotoAssembler(t *testing.T) {
+	jpeg := testJPEG(20000)
+	packets := filePackets(3, jpeg)
+
+	assembler, err := newPhotoAssembler(packets[0].Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := packets[1:]
+	// 逆順に、途中のチャンクを重複させて届ける
+	order := append([]FilePacket{chunks[5]}, chunks...)
+	for i := len(order) - 1; i >= 0; i-- {
+		if assembler.complete() && i > 0 {
+			t.Fatalf("すべてのチャンクが届く前に完了しています（残り %d）", i)
+		}
+		if err := assembler.add(order[i].Payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 別のファイルのチャンクは無視する
+	if err := assembler.add(filePackets(4, jpeg)[1].Payload); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := assembler.jpeg()
+	if err != nil || !assembler.complete() || !bytes.Equal(got, jpeg) {
+		t.Fatalf("組み立てた写真が一致しません: %v", err)
+	}
+
+	if _, err := newPhotoAssembler([]byte{0, 0, 0}); err == nil {
+		t.Error("短いメッセージはエラーにすべき")
+	}
+	broken, _ := newPhotoAssembler(filePackets(1, make([]byte, 100))[0].Payload)
+	broken.add(filePackets(1, make([]byte, 100))[1].Payload)
+	if _, err := broken.jpeg(); !errors.Is(err, ErrPhotoNotJPEG) {
+		t.Errorf("JPEGでなければエラーにすべき: %v", err)
+	}
+}
+
+// TestCameraViewerTakePhoto 撮影の指示から写真の保存までをテストします
+func TestCameraViewerTakePhoto(t *testing.T) {
+	fake := NewFakeDrone()
+	cameraViewer := NewCameraViewer(fake)
+	keyboardHandler := NewKeyboardHandler(nil, cameraViewer)
+	events := keyboardHandler.Events()
+
+	jpeg := testJPEG(9000)
+	packets := filePackets(1, jpeg)
+
+	// 撮影を指示していないときの転送は無視する
+	cameraViewer.handleFilePacket(packets[0])
+	if cameraViewer.PhotoStatus().Pending {
+		t.Error("撮影を指示していないのに受信を始めています")
+	}
+
+	// Pキーで撮影する
+	keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Ch: 'p'})
+	if commands := fake.Commands(); len(commands) != 1 || commands[0] != "TakePicture" {
+		t.Errorf("撮影コマンドが送られていません: %v", commands)
+	}
+	if err := cameraViewer.TakePhoto(); !errors.Is(err, ErrPhotoBusy) {
+		t.Errorf("受信中は撮影できない: %v", err)
+	}
+
+	for _, packet := range packets[:5] {
+		cameraViewer.handleFilePacket(packet)
+	}
+	if status := cameraViewer.PhotoStatus(); !status.Pending || status.Progress < 0.4 || status.Progress > 0.5 {
+		t.Errorf("受信中の状態: %+v", status)
+	}
+	for _, packet := range packets[5:] {
+		cameraViewer.handleFilePacket(packet)
+	}
+
+	status := cameraViewer.PhotoStatus()
+	if status.Pending || !strings.HasPrefix(status.LastFile, "tello_photo_") || !strings.HasSuffix(status.LastFile, ".jpg") {
+		t.Fatalf("写真が保存されていません: %+v", status)
+	}
+	defer os.Remove(status.LastFile)
+	saved, err := os.ReadFile(status.LastFile)
+	if err != nil || !bytes.Equal(saved, jpeg) {
+		t.Errorf("保存した写真が一致しません: %v", err)
+	}
+	if entries := events.Entries(1); !strings.Contains(entries[0].Message, "写真を保存しました: "+status.LastFile) {
+		t.Errorf("保存の通知: %v", entries)
+	}
+
+	// 制限時間内に届かなければ失敗を通知する
+	if err := cameraViewer.TakePhoto(); err != nil {
+		t.Fatal(err)
+	}
+	cameraViewer.handleFilePacket(packets[0])
+	cameraViewer.handleFilePacket(packets[1])
+	cameraViewer.photoTimedOut(cameraViewer.photoRequested)
+	if cameraViewer.PhotoStatus().Pending {
+		t.Error("タイムアウト後も受信を待っています")
+	}
+	if entries := events.Entries(1); !strings.Contains(entries[0].Message, "写真の受信に失敗") || !strings.Contains(entries[0].Message, "11% 受信") {
+		t.Errorf("タイムアウトの通知: %v", entries)
+	}
+}
+
+// TestCameraViewerTakePhotoUnsupported 写真撮影に対応していないドライバーではエラーになることをテストします
+func TestCameraViewerTakePhotoUnsupported(t *testing.T) {
+	cameraViewer := NewCameraViewer(tello.NewDriver("8890"))
+	if err := cameraViewer.TakePhoto(); !errors.Is(err, ErrPhotoUnsupported) {
+		t.Errorf("期待 ErrPhotoUnsupported, 実際 %v", err)
+	}
+}
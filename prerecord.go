@@ -0,0 +1,115 @@
+package main
+
+import (
+	"time"
+
+	"GobotProject/h264"
+)
+
+// 先行録画の既定値
+const (
+	defaultPreRecordSeconds = 5  // 録画開始前にさかのぼる秒数
+	defaultPreRecordMaxMB   = 32 // 先行録画に使うメモリの上限（MB）
+)
+
+// preRecordGOP はキーフレームから始まる一続きのフレーム
+type preRecordGOP struct {
+	start time.Time // キーフレームを受信した時刻
+	units []h264.AccessUnit
+	bytes int
+}
+
+// preRecordBuffer は録画していない間も直近の映像をGOP単位で保持するリングバッファ
+// 録画開始時に中身を書き出すので、録画ファイルは必ずキーフレームから始まる
+type preRecordBuffer struct {
+	length   time.Duration // 保持する長さ（0なら先行録画しない）
+	maxBytes int           // 保持するデータ量の上限
+	gops     []preRecordGOP
+	bytes    int
+	last     time.Time // 最後にフレームを受信した時刻
+}
+
+// PreRecordStatus は先行録画バッファの状態
+type PreRecordStatus struct {
+	Length    time.Duration // 保持している映像の長さ
+	MaxLength time.Duration // 設定した長さ（0なら無効）
+	Bytes     int           // 保持しているデータ量
+	MaxBytes  int           // データ量の上限
+}
+
+// Enabled は先行録画が有効かどうかを返す
+func (s PreRecordStatus) Enabled() bool {
+	return s.MaxLength > 0
+}
+
+// configure は保持する長さとデータ量の上限を設定し、それまでの中身を捨てる
+func (b *preRecordBuffer) configure(length time.Duration, maxBytes int) {
+	b.length = length
+	b.maxBytes = maxBytes
+	b.reset()
+}
+
+// add はフレームを追加し、古いGOPを捨てる
+// 最初のキーフレームを受信するまでのフレームは、単独では再生できないので保持しない
+func (b *preRecordBuffer) add(au h264.AccessUnit, now time.Time) {
+	if b.length <= 0 {
+		return
+	}
+	if au.Keyframe {
+		b.gops = append(b.gops, preRecordGOP{start: now})
+	}
+	if len(b.gops) == 0 {
+		return
+	}
+
+	size := 0
+	for _, nal := range au.NALs {
+		size += len(nal)
+	}
+	gop := &b.gops[len(b.gops)-1]
+	gop.units = append(gop.units, au)
+	gop.bytes += size
+	b.bytes += size
+	b.last = now
+
+	// 2番目のGOPからでも設定した長さを満たすなら、最も古いGOPは要らない
+	for len(b.gops) > 1 && now.Sub(b.gops[1].start) >= b.length {
+		b.dropOldest()
+	}
+	// 上限を超えたら古いGOPから捨てる（1つのGOPだけで超える場合は次のキーフレームまで保持しない）
+	for len(b.gops) > 0 && b.bytes > b.maxBytes {
+		b.dropOldest()
+	}
+}
+
+// dropOldest は最も古いGOPを捨てる
+func (b *preRecordBuffer) dropOldest() {
+	b.bytes -= b.gops[0].bytes
+	b.gops[0] = preRecordGOP{}
+	b.gops = b.gops[1:]
+}
+
+// drain は保持しているフレームを古い順に返し、バッファを空にする
+func (b *preRecordBuffer) drain() []h264.AccessUnit {
+	var units []h264.AccessUnit
+	for _, gop := range b.gops {
+		units = append(units, gop.units...)
+	}
+	b.reset()
+	return units
+}
+
+// reset はバッファを空にする
+func (b *preRecordBuffer) reset() {
+	b.gops = nil
+	b.bytes = 0
+}
+
+// status はバッファの状態を返す
+func (b *preRecordBuffer) status() PreRecordStatus {
+	status := PreRecordStatus{MaxLength: b.length, Bytes: b.bytes, MaxBytes: b.maxBytes}
+	if len(b.gops) > 0 {
+		status.Length = b.last.Sub(b.gops[0].start)
+	}
+	return status
+}
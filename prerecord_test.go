@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"GobotProject/h264"
+)
+
+// TestPreRecordBuffer 先行録画バッファがGOP単位で古い映像を捨てることをテストします
+func TestPreRecordBuffer(t *testing.T) {
+	var buffer preRecordBuffer
+	buffer.configure(2*time.Second, 1<<20)
+
+	frame := func(keyframe bool) h264.AccessUnit {
+		nal := []byte{0x41, 0x9a, 0, 0}
+		if keyframe {
+			nal[0] = 0x65
+		}
+		return h264.AccessUnit{NALs: [][]byte{nal}, Keyframe: keyframe}
+	}
+
+	// 最初のキーフレームの前のフレームは保持しない
+	start := time.Unix(1000, 0)
+	buffer.add(frame(false), start)
+	if status := buffer.status(); status.Bytes != 0 {
+		t.Errorf("キーフレームの前のフレームを保持しています: %+v", status)
+	}
+
+	// 1秒ごとのGOPを4秒分（10フレーム/秒）
+	for i := 0; i < 40; i++ {
+		buffer.add(frame(i%10 == 0), start.Add(time.Duration(i)*100*time.Millisecond))
+	}
+	status := buffer.status()
+	if status.Length < 2*time.Second || status.Length >= 3*time.Second {
+		t.Errorf("保持する長さ: %v", status.Length)
+	}
+	units := buffer.drain()
+	if len(units) != 30 || !units[0].Keyframe {
+		t.Errorf("GOPの先頭から3秒分を保持すべき: %d フレーム, 先頭キーフレーム %v", len(units), units[0].Keyframe)
+	}
+	if status := buffer.status(); status.Bytes != 0 || status.Length != 0 {
+		t.Errorf("書き出した後は空にすべき: %+v", status)
+	}
+
+	// 上限を超えたら古いGOPから捨てる
+	buffer.configure(time.Minute, 60)
+	for i := 0; i < 40; i++ {
+		buffer.add(frame(i%10 == 0), start.Add(time.Duration(i)*100*time.Millisecond))
+	}
+	if status := buffer.status(); status.Bytes != 40 {
+		t.Errorf("上限内の1GOPだけを保持すべき: %+v", status)
+	}
+
+	// 無効なら何も保持しない
+	buffer.configure(0, 1<<20)
+	buffer.add(frame(true), start)
+	if units := buffer.drain(); len(units) != 0 {
+		t.Errorf("先行録画が無効なのにフレームを保持しています: %d", len(units))
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"GobotProject/h264"
+)
+
+// ErrRecordingClosed は閉じた録画ファイルに書き込もうとした
+var ErrRecordingClosed = errors.New("録画ファイルは既に閉じられています")
+
+// RecordingFormat は録画ファイルの形式
+type RecordingFormat string
+
+// 録画形式
+const (
+	FormatMOV  RecordingFormat = "MOV"  // QuickTime形式（既定）
+	FormatMP4  RecordingFormat = "MP4"  // ISO MP4形式
+	FormatH264 RecordingFormat = "H264" // 受信したAnnex-Bストリームそのまま（デバッグ用）
+	FormatTS   RecordingFormat = "TS"   // MPEG-2 TS（地上局ツール向け）
+)
+
+// recordingFormats は選択できる録画形式と拡張子
+var recordingFormats = []struct {
+	format    RecordingFormat
+	extension string
+}{
+	{FormatMOV, ".mov"},
+	{FormatMP4, ".mp4"},
+	{FormatH264, ".h264"},
+	{FormatTS, ".ts"},
+}
+
+// ParseRecordingFormat は形式名（大文字小文字は区別しない）を録画形式に変換する
+func ParseRecordingFormat(name string) (RecordingFormat, error) {
+	for _, f := range recordingFormats {
+		if strings.EqualFold(name, string(f.format)) {
+			return f.format, nil
+		}
+	}
+	return "", fmt.Errorf("未知の録画形式です: %q（MOV, MP4, H264, TS のいずれか）", name)
+}
+
+// Extension は録画形式のファイル拡張子を返す
+func (f RecordingFormat) Extension() string {
+	for _, rf := range recordingFormats {
+		if rf.format == f {
+			return rf.extension
+		}
+	}
+	return ".mov"
+}
+
+// RecordingSink はドローンから受信した映像をフレーム単位で書き込む録画先
+type RecordingSink interface {
+	// WriteAccessUnit は1フレーム分のNALユニットを書き込む
+	WriteAccessUnit(au h264.AccessUnit) error
+	// Close は残りのデータを書き込み、ファイルを閉じる
+	Close() error
+	// FrameCount は書き込んだフレーム数を返す
+	FrameCount() int
+}
+
+// NewRecordingSink は録画形式に応じた録画先を作成する
+// MP4Optionsは MOV/MP4 形式の場合だけ使われる
+func NewRecordingSink(format RecordingFormat, filename string, options MP4Options) (RecordingSink, error) {
+	switch format {
+	case FormatMOV, FormatMP4:
+		return NewMP4WriterWithOptions(filename, options)
+	case FormatH264:
+		return NewH264Writer(filename)
+	case FormatTS:
+		return NewTSWriter(filename)
+	}
+	return nil, fmt.Errorf("未知の録画形式です: %q", format)
+}
+
+// H264Writer は受信したフレームをAnnex-B形式のままファイルに書き込む
+type H264Writer struct {
+	file   *os.File
+	buf    *bufio.Writer
+	frames int
+}
+
+// NewH264Writer は新しい.h264ライターを作成
+func NewH264Writer(filename string) (*H264Writer, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &H264Writer{file: file, buf: bufio.NewWriter(file)}, nil
+}
+
+// WriteAccessUnit はNALユニットをスタートコード付きで書き込む
+func (w *H264Writer) WriteAccessUnit(au h264.AccessUnit) error {
+	if w.file == nil {
+		return ErrRecordingClosed
+	}
+	for _, nal := range au.NALs {
+		if _, err := w.buf.Write([]byte{0, 0, 0, 1}); err != nil {
+			return err
+		}
+		if _, err := w.buf.Write(nal); err != nil {
+			return err
+		}
+	}
+	w.frames++
+	return nil
+}
+
+// FrameCount は書き込んだフレーム数を返す
+func (w *H264Writer) FrameCount() int {
+	return w.frames
+}
+
+// Close はバッファを書き出してファイルを閉じる
+func (w *H264Writer) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.buf.Flush()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.file = nil
+	return err
+}
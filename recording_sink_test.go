@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"GobotProject/h264"
+)
+
+// TestParseRecordingFormat 録画形式の名前と拡張子をテストします
+func TestParseRecordingFormat(t *testing.T) {
+	cases := map[string]string{"mov": ".mov", "MP4": ".mp4", "h264": ".h264", "Ts": ".ts"}
+	for name, ext := range cases {
+		format, err := ParseRecordingFormat(name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if format.Extension() != ext {
+			t.Errorf("%s の拡張子: 期待 %s, 実際 %s", name, ext, format.Extension())
+		}
+	}
+	if _, err := ParseRecordingFormat("avi"); err == nil {
+		t.Error("未知の形式はエラーにすべき")
+	}
+}
+
+// TestH264WriterAnnexB フレームがスタートコード付きで保存されることをテストします
+func TestH264WriterAnnexB(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "raw.h264")
+	writer, err := NewH264Writer(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, units := telloVideoPackets(10, 20)
+	var expected []byte
+	for _, unit := range units {
+		expected = append(expected, normalizeStartCodes(unit)...)
+		if err := writer.WriteAccessUnit(h264.AccessUnit{NALs: h264.SplitAnnexB(unit)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteAccessUnit(h264.AccessUnit{NALs: h264.SplitAnnexB(units[0])}); err != ErrRecordingClosed {
+		t.Errorf("Close後の書き込みは ErrRecordingClosed: %v", err)
+	}
+
+	data, _ := os.ReadFile(filename)
+	if !bytes.Equal(data, expected) {
+		t.Error("保存したデータが受信したフレームと一致しません")
+	}
+	if writer.FrameCount() != 20 {
+		t.Errorf("フレーム数: 期待 20, 実際 %d", writer.FrameCount())
+	}
+}
+
+// tsPES はテスト用に読み取ったPES
+type tsPES struct {
+	pts      uint64
+	keyframe bool // random_access_indicator
+	hasPCR   bool
+	payload  []byte
+	afterPSI bool // 直前にPAT/PMTがあったか
+}
+
+// readTS はTSファイルを検証しながら映像のPESを取り出します
+func readTS(t *testing.T, data []byte) []tsPES {
+	t.Helper()
+	if len(data)%tsPacketSize != 0 {
+		t.Fatalf("ファイルサイズが188の倍数ではありません: %d", len(data))
+	}
+
+	var pes []tsPES
+	continuity := map[uint16]int{}
+	sawPSI := false
+	for i := 0; i < len(data); i += tsPacketSize {
+		packet := data[i : i+tsPacketSize]
+		if packet[0] != tsSyncByte {
+			t.Fatalf("パケット %d の同期バイトが不正: %x", i/tsPacketSize, packet[0])
+		}
+		pid := uint16(packet[1]&0x1f)<<8 | uint16(packet[2])
+		unitStart := packet[1]&0x40 != 0
+		cc := int(packet[3] & 0x0f)
+		if last, ok := continuity[pid]; ok && cc != (last+1)&0x0f {
+			t.Fatalf("PID %#x の連続性カウンタが不正: %d → %d", pid, last, cc)
+		}
+		continuity[pid] = cc
+
+		payload := packet[4:]
+		var adaptation []byte
+		if packet[3]&0x20 != 0 {
+			adaptation = payload[1 : 1+payload[0]]
+			payload = payload[1+payload[0]:]
+		}
+
+		switch pid {
+		case tsPIDPAT, tsPIDPMT:
+			section := payload[1:]
+			length := int(binary.BigEndian.Uint16(section[1:]) & 0x0fff)
+			if crc32MPEG2(section[:3+length]) != 0 {
+				t.Fatalf("PID %#x のCRCが不正", pid)
+			}
+			if pid == tsPIDPMT && (section[12] != tsStreamTypeAVC || binary.BigEndian.Uint16(section[13:])&0x1fff != tsPIDVideo) {
+				t.Fatalf("PMTの映像ストリームが不正: % x", section[12:15])
+			}
+			sawPSI = true
+		case tsPIDVideo:
+			if unitStart {
+				if !bytes.HasPrefix(payload, []byte{0, 0, 1, tsStreamIDVideo}) || payload[7]&0x80 == 0 {
+					t.Fatalf("PESヘッダーが不正: % x", payload[:9])
+				}
+				ts := payload[9:14]
+				pts := uint64(ts[0]>>1&0x07)<<30 | uint64(ts[1])<<22 | uint64(ts[2]>>1)<<15 | uint64(ts[3])<<7 | uint64(ts[4]>>1)
+				pes = append(pes, tsPES{
+					pts:      pts,
+					keyframe: len(adaptation) > 0 && adaptation[0]&0x40 != 0,
+					hasPCR:   len(adaptation) > 0 && adaptation[0]&0x10 != 0,
+					afterPSI: sawPSI,
+				})
+				payload = payload[9+payload[8]:]
+				sawPSI = false
+			}
+			if len(pes) == 0 {
+				t.Fatal("PESの途中から始まっています")
+			}
+			pes[len(pes)-1].payload = append(pes[len(pes)-1].payload, payload...)
+		default:
+			t.Fatalf("未知のPID: %#x", pid)
+		}
+	}
+	return pes
+}
+
+// TestTSWriterStream フレームごとにPTS付きのPESが作られることをテストします
+func TestTSWriterStream(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.ts")
+	writer, err := NewTSWriter(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 空のフレームは書き込まずに無視する
+	if err := writer.WriteAccessUnit(h264.AccessUnit{}); err != nil {
+		t.Fatalf("空のフレームでエラー: %v", err)
+	}
+
+	const gop, frames = 10, 25
+	packets, units := telloVideoPackets(gop, frames)
+	for _, packet := range packets {
+		if err := writer.WriteFrame(packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(filename)
+	pes := readTS(t, data)
+	if len(pes) != frames || writer.FrameCount() != frames {
+		t.Fatalf("PESの数: 期待 %d, 実際 %d（FrameCount %d）", frames, len(pes), writer.FrameCount())
+	}
+	for i, p := range pes {
+		if p.pts != uint64(tsPTSDelay+i*3000) {
+			t.Errorf("フレーム %d のPTS: 期待 %d, 実際 %d", i, tsPTSDelay+i*3000, p.pts)
+		}
+		keyframe := i%gop == 0
+		if p.keyframe != keyframe || p.afterPSI != keyframe || !p.hasPCR {
+			t.Errorf("フレーム %d: keyframe=%v afterPSI=%v PCR=%v", i, p.keyframe, p.afterPSI, p.hasPCR)
+		}
+		// 中身はAUDと元のフレーム
+		expected := append(append([]byte(nil), tsAUD...), units[i]...)
+		if !bytes.Equal(normalizeStartCodes(p.payload), normalizeStartCodes(expected)) {
+			t.Fatalf("フレーム %d の内容が元のフレームと一致しません", i)
+		}
+	}
+}
+
+// normalizeStartCodes はAnnex-Bバイト列を4バイトのスタートコードにそろえます
+func normalizeStartCodes(data []byte) []byte {
+	var out []byte
+	for _, nal := range h264.SplitAnnexB(data) {
+		out = appendAnnexB(out, nal)
+	}
+	return out
+}
+
+// TestCameraViewerRecordingFormats 設定した形式と拡張子で録画されることをテストします
+func TestCameraViewerRecordingFormats(t *testing.T) {
+	packets, _ := telloVideoPackets(10, 20)
+	for _, format := range []RecordingFormat{FormatMOV, FormatMP4, FormatH264, FormatTS} {
+		cv := NewCameraViewer(NewFakeDrone())
+		cv.SetRecordingFormat(format)
+		cv.isRunning = true
+		cv.StartRecording()
+		for _, packet := range packets {
+			cv.processFrame(packet)
+		}
+		cv.StopRecording()
+
+		filename := cv.GetCurrentRecordingFile()
+		info, err := os.Stat(filename)
+		os.Remove(filename)
+		if err != nil {
+			t.Errorf("%s: 録画ファイルがありません: %v", format, err)
+			continue
+		}
+		if !strings.HasSuffix(filename, format.Extension()) || info.Size() == 0 {
+			t.Errorf("%s: 録画ファイルが不正: %s（%d バイト）", format, filename, info.Size())
+		}
+		if cv.GetRecordingFormat() != string(format) {
+			t.Errorf("録画形式: 期待 %s, 実際 %s", format, cv.GetRecordingFormat())
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"GobotProject/h264"
+)
+
+// ErrNoVideoData は修復対象のファイルから映像データが見つからない
+var ErrNoVideoData = errors.New("映像データが見つかりません")
+
+// ErrNoParameterSets はSPS/PPSが見つからず、映像をデコードできるファイルを作れない
+var ErrNoParameterSets = errors.New("SPS/PPSが見つかりません（Annex-B形式(.h264)の映像があれば -sidecar で指定してください）")
+
+// repairChunkSize は修復時に映像データを書き込む単位
+const repairChunkSize = 64 * 1024
+
+// RepairResult は録画ファイルの修復結果
+type RepairResult struct {
+	Source   string        // 映像データを読み取ったファイル
+	Output   string        // 修復後のファイル
+	Frames   int           // 復元したフレーム数
+	Duration time.Duration // 復元した映像の長さ
+}
+
+// mp4TopLevelBoxes は録画ファイルのトップレベルに現れるボックス
+// 書き込み途中で終わったmdatの続きが正しいボックスかどうかの判定に使う
+var mp4TopLevelBoxes = map[string]bool{
+	"ftyp": true, "styp": true, "moov": true, "moof": true, "mdat": true,
+	"free": true, "skip": true, "wide": true, "sidx": true, "mfra": true, "uuid": true,
+}
+
+// RepairRecording は途中で終了した録画ファイル（moovがない、途中で切れているなど）から
+// H.264のNALユニットを探し出し、サンプルテーブルを作り直したMOV/MP4ファイルを出力する
+// 入力がAnnex-B形式（.h264のサイドカーファイルなど）の場合はそのまま読み込む
+func RepairRecording(input, output string) (*RepairResult, error) {
+	if same, _ := sameFile(input, output); same {
+		return nil, fmt.Errorf("出力先が入力ファイルと同じです: %s", output)
+	}
+
+	data, err := os.ReadFile(input)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := data
+	if !isAnnexB(data) {
+		stream = nil
+		// avcCが残っていればSPS/PPSを先頭に置く（キーフレームに含まれていない古い録画用）
+		for _, nal := range avcCParameterSets(data) {
+			stream = appendAnnexB(stream, nal)
+		}
+		for _, nal := range recordingNALs(data) {
+			stream = appendAnnexB(stream, nal)
+		}
+	}
+
+	writer, err := NewMP4Writer(output)
+	if err != nil {
+		return nil, err
+	}
+	// 受信時と同じくらいの大きさに分けて渡す（アセンブラーは未処理データを詰め直すため）
+	for len(stream) > 0 {
+		n := min(repairChunkSize, len(stream))
+		if err := writer.WriteFrame(stream[:n]); err != nil {
+			writer.Close()
+			return nil, err
+		}
+		stream = stream[n:]
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	frames := writer.FrameCount()
+	switch {
+	case frames == 0:
+		os.Remove(output)
+		return nil, fmt.Errorf("%s: %w", input, ErrNoVideoData)
+	case writer.sps == nil || writer.pps == nil:
+		os.Remove(output)
+		return nil, fmt.Errorf("%s: %w", input, ErrNoParameterSets)
+	}
+
+	return &RepairResult{
+		Source:   input,
+		Output:   output,
+		Frames:   frames,
+		Duration: writer.Duration(),
+	}, nil
+}
+
+// recordingNALs はMOV/MP4ファイルのmdatから長さ付きNALユニットを取り出す
+// moovがない、mdatのサイズが更新されていない、末尾が切れているファイルにも対応する
+func recordingNALs(data []byte) [][]byte {
+	var nals [][]byte
+	foundMdat := false
+
+	for pos := 0; pos+8 <= len(data); {
+		boxType := string(data[pos+4 : pos+8])
+		size, header := uint64(binary.BigEndian.Uint32(data[pos:])), 8
+		if size == 1 && pos+16 <= len(data) {
+			size, header = binary.BigEndian.Uint64(data[pos+8:]), 16
+		}
+		if !mp4TopLevelBoxes[boxType] || (size != 0 && size < uint64(header)) {
+			break
+		}
+
+		end := len(data)
+		if size != 0 && size <= uint64(len(data)-pos) {
+			end = pos + int(size)
+		}
+		if boxType == "mdat" {
+			foundMdat = true
+			// 書き込み途中のmdatはサイズが更新されていないので、
+			// 続きが正しいボックスでなければファイルの末尾までをmdatとみなす
+			if !validBoxAt(data, end) {
+				end = len(data)
+			}
+			nals = append(nals, lengthPrefixedNALs(data[pos+header:end])...)
+		}
+		pos = end
+	}
+
+	// ボックス構造が壊れている場合はファイル全体から探す
+	if !foundMdat {
+		return lengthPrefixedNALs(data)
+	}
+	return nals
+}
+
+// validBoxAt はposから正しいボックスが始まる（またはファイルの末尾）かどうかを返す
+func validBoxAt(data []byte, pos int) bool {
+	if pos == len(data) {
+		return true
+	}
+	if pos+8 > len(data) {
+		return false
+	}
+	size := binary.BigEndian.Uint32(data[pos:])
+	return mp4TopLevelBoxes[string(data[pos+4:pos+8])] && (size == 0 || size == 1 || size >= 8)
+}
+
+// lengthPrefixedNALs は4バイトの長さ付きNALユニットを順に取り出す
+// 壊れた部分は1バイトずつずらして次のNALを探し、末尾で切れたNALは捨てる
+func lengthPrefixedNALs(data []byte) [][]byte {
+	var nals [][]byte
+	for i := 0; i+4 < len(data); {
+		n := int(binary.BigEndian.Uint32(data[i:]))
+		if n > 0 && n <= len(data)-i-4 && validNALHeader(data[i+4]) {
+			nals = append(nals, data[i+4:i+4+n])
+			i += 4 + n
+			continue
+		}
+		i++
+	}
+	return nals
+}
+
+// validNALHeader はNALヘッダーとして正しい（禁止ビットが0で、映像のNALタイプ）かどうかを返す
+func validNALHeader(b byte) bool {
+	nalType := b & 0x1f
+	return b&0x80 == 0 && nalType >= byte(h264.NALSlice) && nalType <= 12
+}
+
+// avcCParameterSets はファイル中のavcCボックスからSPS/PPSを取り出す（なければnil）
+func avcCParameterSets(data []byte) [][]byte {
+	pos := bytes.Index(data, []byte("avcC"))
+	if pos < 0 {
+		return nil
+	}
+	avcC := data[pos+4:]
+	if len(avcC) < 8 || avcC[0] != 1 {
+		return nil
+	}
+
+	var nals [][]byte
+	p := 5
+	// SPSの個数（下位5ビット）、PPSの個数の順に、長さ付きで並んでいる
+	for _, mask := range []byte{0x1f, 0xff} {
+		if p >= len(avcC) {
+			return nil
+		}
+		count := int(avcC[p] & mask)
+		p++
+		for i := 0; i < count; i++ {
+			if p+2 > len(avcC) {
+				return nil
+			}
+			n := int(binary.BigEndian.Uint16(avcC[p:]))
+			p += 2
+			if n == 0 || p+n > len(avcC) {
+				return nil
+			}
+			nals = append(nals, avcC[p:p+n])
+			p += n
+		}
+	}
+	return nals
+}
+
+// isAnnexB はデータがスタートコードで始まるAnnex-B形式かどうかを返す
+func isAnnexB(data []byte) bool {
+	return bytes.HasPrefix(data, []byte{0, 0, 1}) || bytes.HasPrefix(data, []byte{0, 0, 0, 1})
+}
+
+// appendAnnexB はNALユニットをスタートコード付きで追加する
+func appendAnnexB(stream, nal []byte) []byte {
+	stream = append(stream, 0, 0, 0, 1)
+	return append(stream, nal...)
+}
+
+// sameFile は2つのパスが同じファイルを指すかどうかを返す
+func sameFile(a, b string) (bool, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(infoA, infoB), nil
+}
+
+// repairOutputName は修復後のファイル名（元の名前_repaired.拡張子）を返す
+// Annex-Bのファイルを修復した場合は.movにする
+func repairOutputName(input string) string {
+	ext := filepath.Ext(input)
+	base := strings.TrimSuffix(input, ext)
+	if !strings.EqualFold(ext, ".mov") && !strings.EqualFold(ext, ".mp4") {
+		ext = ".mov"
+	}
+	return base + "_repaired" + ext
+}
+
+// runRepair はrepairコマンドを実行し、指定された録画ファイルを修復する
+func runRepair(args []string) error {
+	fs := flag.NewFlagSet("repair", flag.ContinueOnError)
+	output := fs.String("o", "", "修復後のファイル名（省略時は 元の名前_repaired.mov）")
+	sidecar := fs.String("sidecar", "", "映像を読み取るAnnex-B形式のファイル（省略時は録画ファイルから読み取る）")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "使い方: repair [-o 出力ファイル] [-sidecar ファイル.h264] 録画ファイル...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	inputs := fs.Args()
+	if len(inputs) == 0 {
+		fs.Usage()
+		return errors.New("録画ファイルを指定してください")
+	}
+	if len(inputs) > 1 && (*output != "" || *sidecar != "") {
+		return errors.New("-o と -sidecar は録画ファイルを1つだけ指定したときに使えます")
+	}
+
+	failed := 0
+	for _, input := range inputs {
+		source := *sidecar
+		if source == "" {
+			source = input
+		}
+		out := *output
+		if out == "" {
+			out = repairOutputName(input)
+		}
+
+		result, err := RepairRecording(source, out)
+		if err != nil {
+			log.Printf("修復失敗: %v", err)
+			failed++
+			continue
+		}
+		log.Printf("修復完了: %s → %s（%d フレーム, %.1f 秒を復元）",
+			result.Source, result.Output, result.Frames, result.Duration.Seconds())
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d 個のファイルを修復できませんでした", failed)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// recordWithoutClose は合成映像を録画し、Closeを呼ぶ前（プロセスが落ちた状態）のファイル内容を返します
+func recordWithoutClose(t *testing.T, filename string, options MP4Options, frames int) []byte {
+	t.Helper()
+	writer, err := NewMP4WriterWithOptions(filename, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+
+	packets, _ := telloVideoPackets(10, frames)
+	for _, packet := range packets {
+		if err := writer.WriteFrame(packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// repairedSampleCount は修復後のファイルのサンプル数を返します
+func repairedSampleCount(t *testing.T, filename string) uint32 {
+	t.Helper()
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stbl := []string{"moov", "trak", "mdia", "minf", "stbl"}
+	findBox(t, data, append(stbl, "stsd", "avc1", "avcC")...)
+	return fullBoxUint32s(findBox(t, data, append(stbl, "stsz")...))[1]
+}
+
+// TestRepairUnfinalizedRecording moovがなく末尾が切れた録画からフレームを復元できることをテストします
+func TestRepairUnfinalizedRecording(t *testing.T) {
+	dir := t.TempDir()
+	data := recordWithoutClose(t, filepath.Join(dir, "recording.mov"), MP4Options{}, 25)
+
+	// 書き込み済みの23フレームのうち、最後のフレームの途中で切れたファイル
+	damaged := filepath.Join(dir, "damaged.mov")
+	if err := os.WriteFile(damaged, data[:len(data)-10], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "repaired.mov")
+	result, err := RepairRecording(damaged, output)
+	if err != nil {
+		t.Fatalf("修復に失敗: %v", err)
+	}
+	if result.Frames != 22 {
+		t.Errorf("復元したフレーム数: 期待 22, 実際 %d", result.Frames)
+	}
+	if got := result.Duration.Seconds(); got < 0.73 || got > 0.74 {
+		t.Errorf("復元した長さが不正: %v", result.Duration)
+	}
+	if got := repairedSampleCount(t, output); got != 22 {
+		t.Errorf("修復後のサンプル数: 期待 22, 実際 %d", got)
+	}
+
+	if _, err := RepairRecording(damaged, damaged); err == nil {
+		t.Error("入力ファイルへの上書きはエラーにすべき")
+	}
+}
+
+// TestRepairFragmentedRecording 途中で切れたフラグメント形式の録画を通常形式に直せることをテストします
+func TestRepairFragmentedRecording(t *testing.T) {
+	dir := t.TempDir()
+	data := recordWithoutClose(t, filepath.Join(dir, "recording.mp4"), MP4Options{FragmentDuration: 500 * time.Millisecond}, 60)
+
+	damaged := filepath.Join(dir, "damaged.mp4")
+	if err := os.WriteFile(damaged, data[:len(data)-500], 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "repaired.mp4")
+	result, err := RepairRecording(damaged, output)
+	if err != nil {
+		t.Fatalf("修復に失敗: %v", err)
+	}
+	// 書き込み済みの45フレームのうち、切れた最後のフレーム以外が戻る
+	if result.Frames != 44 {
+		t.Errorf("復元したフレーム数: 期待 44, 実際 %d", result.Frames)
+	}
+	if got := repairedSampleCount(t, output); got != uint32(result.Frames) {
+		t.Errorf("修復後のサンプル数が不正: %d", got)
+	}
+}
+
+// TestRunRepairSidecar -sidecar で指定した.h264ファイルから修復することをテストします
+func TestRunRepairSidecar(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "tello_recording_1.mov")
+	// 映像データを含まない以前の録画ファイル
+	if err := os.WriteFile(input, mp4Box("ftyp", []byte("qt  ")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RepairRecording(input, filepath.Join(dir, "out.mov")); !errors.Is(err, ErrNoVideoData) {
+		t.Errorf("映像データがなければ ErrNoVideoData: %v", err)
+	}
+
+	var stream []byte
+	_, units := telloVideoPackets(10, 20)
+	for _, unit := range units {
+		stream = append(stream, unit...)
+	}
+	sidecar := filepath.Join(dir, "tello_recording_1.h264")
+	if err := os.WriteFile(sidecar, stream, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 同名の.h264ファイルがあっても、指定しなければ使わない
+	if err := runRepair([]string{input}); err == nil {
+		t.Error("映像データのない録画ファイルは -sidecar なしでは修復できないはず")
+	}
+	if err := runRepair([]string{"-sidecar", sidecar, input}); err != nil {
+		t.Fatalf("修復に失敗: %v", err)
+	}
+	if got := repairedSampleCount(t, filepath.Join(dir, "tello_recording_1_repaired.mov")); got != 20 {
+		t.Errorf("修復後のサンプル数: 期待 20, 実際 %d", got)
+	}
+}
@@ -0,0 +1,192 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"gobot.io/x/gobot/platforms/dji/tello"
+)
+
+// Telloバイナリプロトコルのメッセージ/コマンドID（tello.Driverと同じ値）
+const (
+	messageStart = 0xcc
+
+	msgWifi       = 0x001a
+	msgLight      = 0x0035
+	msgFlightData = 0x0056
+	msgLog        = 0x1050
+
+	cmdVideoEncoderRate = 0x0020
+	cmdVideoStart       = 0x0025
+	cmdExposure         = 0x0034
+	cmdTime             = 0x0046
+	cmdStick            = 0x0050
+	cmdTakeOff          = 0x0054
+	cmdLand             = 0x0055
+	cmdFlip             = 0x005c
+	cmdThrowTakeOff     = 0x005d
+	cmdPalmLand         = 0x005e
+	cmdBounce           = 0x1053
+)
+
+// パケットの固定長（ヘッダー9バイト + CRC16 2バイト）
+const packetOverhead = 11
+
+// 接続要求/応答のテキストプレフィックス
+const (
+	connRequestPrefix = "conn_req:"
+	connAckPrefix     = "conn_ack:"
+)
+
+// emergencyCommand はモーターを即時停止させるテキストコマンド
+const emergencyCommand = "emergency"
+
+var errInvalidPacket = errors.New("不正なTelloパケット")
+
+// packet は受信したバイナリパケット
+type packet struct {
+	pktType byte
+	cmd     uint16
+	seq     uint16
+	payload []byte
+}
+
+// parsePacket はドライバーから送られたバイナリパケットを解析する
+func parsePacket(b []byte) (*packet, error) {
+	if len(b) < packetOverhead || b[0] != messageStart {
+		return nil, errInvalidPacket
+	}
+
+	size := int(binary.LittleEndian.Uint16(b[1:3]) >> 3)
+	if size > len(b) || size < packetOverhead {
+		return nil, errInvalidPacket
+	}
+	if tello.CalculateCRC8(b[0:3]) != b[3] {
+		return nil, errInvalidPacket
+	}
+	if tello.CalculateCRC16(b[0:size-2]) != binary.LittleEndian.Uint16(b[size-2:size]) {
+		return nil, errInvalidPacket
+	}
+
+	return &packet{
+		pktType: b[4],
+		cmd:     binary.LittleEndian.Uint16(b[5:7]),
+		seq:     binary.LittleEndian.Uint16(b[7:9]),
+		payload: b[9 : size-2],
+	}, nil
+}
+
+// buildPacket はドローンからドライバーへ送るバイナリパケットを組み立てる
+func buildPacket(pktType byte, cmd uint16, seq uint16, payload []byte) []byte {
+	buf := &bytes.Buffer{}
+	size := uint16(len(payload) + packetOverhead)
+
+	buf.WriteByte(messageStart)
+	binary.Write(buf, binary.LittleEndian, size<<3)
+	buf.WriteByte(tello.CalculateCRC8(buf.Bytes()[0:3]))
+	buf.WriteByte(pktType)
+	binary.Write(buf, binary.LittleEndian, cmd)
+	binary.Write(buf, binary.LittleEndian, seq)
+	buf.Write(payload)
+	binary.Write(buf, binary.LittleEndian, tello.CalculateCRC16(buf.Bytes()))
+
+	return buf.Bytes()
+}
+
+// Stick はスティック入力（-1.0〜1.0）
+type Stick struct {
+	RX, RY, LX, LY float64
+	Fast           bool
+}
+
+// parseStick はスティックコマンドのペイロードを解析する
+func parseStick(payload []byte) (Stick, error) {
+	if len(payload) < 6 {
+		return Stick{}, errInvalidPacket
+	}
+
+	var packed int64
+	for i := 0; i < 6; i++ {
+		packed |= int64(payload[i]) << (8 * uint(i))
+	}
+
+	axis := func(shift uint) float64 {
+		return (float64(packed>>shift&0x7FF) - 1024.0) / 660.0
+	}
+
+	return Stick{
+		RX:   axis(0),
+		RY:   axis(11),
+		LY:   axis(22),
+		LX:   axis(33),
+		Fast: packed>>44&0x1 == 1,
+	}, nil
+}
+
+// FlightData はドローンが送信するフライトデータ
+type FlightData struct {
+	Height        int16 // 0.1m単位
+	NorthSpeed    int16
+	EastSpeed     int16
+	VerticalSpeed int16
+	FlyTime       int16 // 0.1秒単位
+	Battery       int8
+	FlyTimeLeft   int16
+	Flying        bool
+	OnGround      bool
+	Hover         bool
+	BatteryLow    bool
+	BatteryLower  bool
+	WindState     bool
+}
+
+// encodeFlightData はtello.Driver.ParseFlightDataが読めるペイロードを作る
+func encodeFlightData(fd FlightData) []byte {
+	buf := &bytes.Buffer{}
+
+	binary.Write(buf, binary.LittleEndian, fd.Height)
+	binary.Write(buf, binary.LittleEndian, fd.NorthSpeed)
+	binary.Write(buf, binary.LittleEndian, fd.EastSpeed)
+	binary.Write(buf, binary.LittleEndian, fd.VerticalSpeed)
+	binary.Write(buf, binary.LittleEndian, fd.FlyTime)
+
+	// IMU/気圧/下方ビジョン/電源/バッテリー/重力の各状態は正常、bit7が風
+	states := byte(0x3f)
+	if fd.WindState {
+		states |= 1 << 7
+	}
+	buf.WriteByte(states)
+
+	buf.WriteByte(0) // IMUキャリブレーション状態
+	binary.Write(buf, binary.LittleEndian, fd.Battery)
+	binary.Write(buf, binary.LittleEndian, fd.FlyTimeLeft)
+	binary.Write(buf, binary.LittleEndian, int16(3800)) // バッテリー電圧(mV)
+
+	var flags byte
+	if fd.Flying {
+		flags |= 1 << 0
+	}
+	if fd.OnGround {
+		flags |= 1 << 1
+	}
+	if fd.Hover {
+		flags |= 1 << 3
+	}
+	if fd.BatteryLow {
+		flags |= 1 << 5
+	}
+	if fd.BatteryLower {
+		flags |= 1 << 6
+	}
+	buf.WriteByte(flags)
+
+	buf.WriteByte(6) // FlyMode
+	buf.WriteByte(0) // ThrowFlyTimer
+	buf.WriteByte(0) // CameraState
+	buf.WriteByte(0) // ElectricalMachineryState
+	buf.WriteByte(0) // FrontIn/FrontOut/FrontLSC
+	buf.WriteByte(0) // TemperatureHigh
+
+	return buf.Bytes()
+}
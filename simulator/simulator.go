@@ -0,0 +1,388 @@
+// Package simulator はTelloのバイナリ制御プロトコルを話すローカルUDPシミュレーターを提供する
+//
+// tello.NewDriverWithIP("127.0.0.1", ...) で作成したドライバーから接続すると、
+// 接続応答・フライトデータ・Wi-Fi・ログの各パケットを返し、
+// H.264ファイル（未指定時は合成ストリーム）をループ再生してビデオポートへ送信する。
+package simulator
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config はシミュレーターの設定
+type Config struct {
+	// CommandAddr は制御コマンドを待ち受けるアドレス（ドライバーは8889番に送信する）
+	CommandAddr string
+	// VideoFile はループ再生するAnnex-B形式のH.264ファイル（空なら合成ストリーム）
+	VideoFile string
+	// FrameRate はビデオの送信フレームレート
+	FrameRate int
+	// TelemetryInterval はフライトデータの送信間隔
+	TelemetryInterval time.Duration
+	// Logf は受信コマンドのログ出力先（nilならログを出さない）
+	Logf func(format string, args ...interface{})
+}
+
+// DefaultConfig は既定の設定を返す
+func DefaultConfig() Config {
+	return Config{
+		CommandAddr:       "127.0.0.1:8889",
+		FrameRate:         30,
+		TelemetryInterval: 100 * time.Millisecond,
+	}
+}
+
+// State はシミュレートしているドローンの状態
+type State struct {
+	Connected   bool
+	Flying      bool
+	Height      int16 // 0.1m単位
+	Battery     int8
+	FlyTime     int16 // 0.1秒単位
+	Stick       Stick
+	TakeOffs    int
+	Landings    int
+	Emergencies int
+	VideoStart  int
+}
+
+// Simulator はTelloドローンのシミュレーター
+type Simulator struct {
+	cfg    Config
+	conn   *net.UDPConn
+	video  *net.UDPConn
+	units  [][]byte
+	mu     sync.Mutex
+	state  State
+	client *net.UDPAddr
+	vaddr  *net.UDPAddr
+	seq    uint16
+	frame  int
+	climb  bool
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// New は新しいシミュレーターを作成する
+func New(cfg Config) (*Simulator, error) {
+	def := DefaultConfig()
+	if cfg.CommandAddr == "" {
+		cfg.CommandAddr = def.CommandAddr
+	}
+	if cfg.FrameRate <= 0 {
+		cfg.FrameRate = def.FrameRate
+	}
+	if cfg.TelemetryInterval <= 0 {
+		cfg.TelemetryInterval = def.TelemetryInterval
+	}
+
+	var units [][]byte
+	if cfg.VideoFile != "" {
+		loaded, err := loadAccessUnits(cfg.VideoFile)
+		if err != nil {
+			return nil, err
+		}
+		units = loaded
+	} else {
+		units = syntheticStream(960, 720, cfg.FrameRate, cfg.FrameRate)
+	}
+
+	return &Simulator{
+		cfg:   cfg,
+		units: units,
+		state: State{Battery: 100},
+		done:  make(chan struct{}),
+	}, nil
+}
+
+// Start はUDPの待ち受けと送信ループを開始する
+func (s *Simulator) Start() error {
+	addr, err := net.ResolveUDPAddr("udp", s.cfg.CommandAddr)
+	if err != nil {
+		return err
+	}
+	s.conn, err = net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+	s.video, err = net.ListenUDP("udp", &net.UDPAddr{IP: addr.IP})
+	if err != nil {
+		s.conn.Close()
+		return err
+	}
+
+	s.wg.Add(3)
+	go s.receiveLoop()
+	go s.telemetryLoop()
+	go s.videoLoop()
+
+	s.logf("Telloシミュレーター開始: %s", s.conn.LocalAddr())
+	return nil
+}
+
+// Stop はシミュレーターを停止する
+func (s *Simulator) Stop() error {
+	close(s.done)
+	s.conn.Close()
+	s.video.Close()
+	s.wg.Wait()
+	return nil
+}
+
+// Addr は制御コマンドの待ち受けアドレスを返す
+func (s *Simulator) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// State は現在の状態のコピーを返す
+func (s *Simulator) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// logf は設定されたロガーへ出力する
+func (s *Simulator) logf(format string, args ...interface{}) {
+	if s.cfg.Logf != nil {
+		s.cfg.Logf(format, args...)
+	}
+}
+
+// receiveLoop はドライバーからのパケットを処理する
+func (s *Simulator) receiveLoop() {
+	defer s.wg.Done()
+
+	buf := make([]byte, 2048)
+	for {
+		n, from, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-s.done:
+				return
+			default:
+				log.Printf("シミュレーター受信エラー: %v", err)
+				continue
+			}
+		}
+		s.handle(from, buf[:n])
+	}
+}
+
+// handle は1パケットを処理する
+func (s *Simulator) handle(from *net.UDPAddr, b []byte) {
+	if strings.HasPrefix(string(b), connRequestPrefix) {
+		s.handleConnect(from, b[len(connRequestPrefix):])
+		return
+	}
+	if string(b) == emergencyCommand {
+		s.handleEmergency()
+		return
+	}
+
+	pkt, err := parsePacket(b)
+	if err != nil {
+		s.logf("不正なパケットを無視: % x", b)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch pkt.cmd {
+	case cmdStick:
+		if stick, err := parseStick(pkt.payload); err == nil {
+			s.state.Stick = stick
+		}
+	case cmdTakeOff, cmdThrowTakeOff:
+		s.logf("離陸コマンド受信")
+		s.state.TakeOffs++
+		if s.state.Battery > 0 && !s.state.Flying {
+			s.state.Flying = true
+			s.climb = true
+		}
+		s.replyLocked(pkt.cmd, []byte{0x00})
+	case cmdLand, cmdPalmLand:
+		// ペイロード0x01は着陸中止
+		if len(pkt.payload) > 0 && pkt.payload[0] == 0x01 {
+			s.replyLocked(pkt.cmd, []byte{0x00})
+			return
+		}
+		s.logf("着陸コマンド受信")
+		s.state.Landings++
+		s.state.Flying = false
+		s.replyLocked(pkt.cmd, []byte{0x00})
+	case cmdVideoStart:
+		// 次のフレームからSPS/PPS付きのキーフレームを送り直す
+		s.state.VideoStart++
+		s.frame = 0
+	case cmdTime, cmdExposure, cmdVideoEncoderRate, cmdFlip, cmdBounce:
+		s.replyLocked(pkt.cmd, []byte{0x00})
+	default:
+		s.logf("未対応のコマンド: 0x%04x", pkt.cmd)
+	}
+}
+
+// handleConnect は接続要求に応答する
+func (s *Simulator) handleConnect(from *net.UDPAddr, port []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.client = from
+	s.state.Connected = true
+	if len(port) >= 2 {
+		s.vaddr = &net.UDPAddr{IP: from.IP, Port: int(port[0]) | int(port[1])<<8}
+	}
+	s.logf("接続要求受信: %s (ビデオ: %v)", from, s.vaddr)
+
+	ack := append([]byte(connAckPrefix), port...)
+	s.conn.WriteToUDP(ack, from)
+}
+
+// handleEmergency はモーターを止める（機体はその場で落下する）
+func (s *Simulator) handleEmergency() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logf("非常停止コマンド受信")
+	s.state.Emergencies++
+	s.state.Flying = false
+	s.state.Height = 0
+	s.state.Stick = Stick{}
+}
+
+// replyLocked はクライアントへパケットを送信する（s.muを保持して呼ぶ）
+func (s *Simulator) replyLocked(cmd uint16, payload []byte) {
+	if s.client == nil {
+		return
+	}
+	s.seq++
+	s.conn.WriteToUDP(buildPacket(0x50, cmd, s.seq, payload), s.client)
+}
+
+// telemetryLoop は飛行状態を更新し、フライトデータ等を定期送信する
+func (s *Simulator) telemetryLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.cfg.TelemetryInterval)
+	defer ticker.Stop()
+
+	tick := 0
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		s.step(s.cfg.TelemetryInterval)
+		if s.client != nil {
+			s.replyLocked(msgFlightData, encodeFlightData(s.flightDataLocked()))
+			if tick%10 == 0 {
+				s.replyLocked(msgWifi, []byte{90, 0})
+				s.replyLocked(msgLight, []byte{0})
+				s.replyLocked(msgLog, []byte(fmt.Sprintf("sim log %d", tick)))
+			}
+		}
+		s.mu.Unlock()
+		tick++
+	}
+}
+
+// step は経過時間dtだけ機体の状態を進める（s.muを保持して呼ぶ）
+func (s *Simulator) step(dt time.Duration) {
+	st := &s.state
+	deci := int16(dt / (100 * time.Millisecond))
+	if deci < 1 {
+		deci = 1
+	}
+
+	if st.Flying {
+		// 離陸直後は0.8mまで自動上昇し、その後はスティックに従う（最大0.5m/tick）
+		if s.climb {
+			st.Height++
+			s.climb = st.Height < 8
+		} else {
+			st.Height += int16(math.Round(st.Stick.LY * 5))
+		}
+		if st.Height < 1 {
+			st.Height = 1
+		}
+		st.FlyTime += deci
+
+		// 1分あたり約5%消費
+		if st.FlyTime%120 == 0 && st.Battery > 0 {
+			st.Battery--
+		}
+		if st.Battery == 0 {
+			st.Flying = false
+		}
+	} else if st.Height > 0 {
+		st.Height -= 2
+		if st.Height < 0 {
+			st.Height = 0
+		}
+	}
+}
+
+// flightDataLocked は現在の状態からフライトデータを作る（s.muを保持して呼ぶ）
+func (s *Simulator) flightDataLocked() FlightData {
+	st := s.state
+	speed := func(v float64) int16 {
+		if !st.Flying {
+			return 0
+		}
+		return int16(v * 10)
+	}
+
+	return FlightData{
+		Height:        st.Height,
+		NorthSpeed:    speed(st.Stick.RY),
+		EastSpeed:     speed(st.Stick.RX),
+		VerticalSpeed: speed(st.Stick.LY),
+		FlyTime:       st.FlyTime,
+		Battery:       st.Battery,
+		FlyTimeLeft:   int16(st.Battery) * 6,
+		Flying:        st.Flying,
+		OnGround:      !st.Flying && st.Height == 0,
+		Hover:         st.Flying && st.Stick == (Stick{Fast: st.Stick.Fast}),
+		BatteryLow:    st.Battery <= 20,
+		BatteryLower:  st.Battery <= 10,
+	}
+}
+
+// videoLoop はアクセスユニットをフレームレートに合わせて送信する
+func (s *Simulator) videoLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(time.Second / time.Duration(s.cfg.FrameRate))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		vaddr := s.vaddr
+		au := s.units[s.frame%len(s.units)]
+		seq := byte(s.frame)
+		s.frame++
+		s.mu.Unlock()
+
+		if vaddr == nil {
+			continue
+		}
+		for _, chunk := range chunkAccessUnit(seq, au) {
+			s.video.WriteToUDP(chunk, vaddr)
+		}
+	}
+}
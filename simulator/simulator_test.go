@@ -0,0 +1,200 @@
+package simulator
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"GobotProject/h264"
+
+	"gobot.io/x/gobot/platforms/dji/tello"
+)
+
+// TestFlightDataRoundTrip 生成したフライトデータをtelloドライバーが解析できることを確認します
+func TestFlightDataRoundTrip(t *testing.T) {
+	in := FlightData{
+		Height:      12,
+		NorthSpeed:  3,
+		FlyTime:     45,
+		Battery:     76,
+		FlyTimeLeft: 300,
+		Flying:      true,
+		BatteryLow:  true,
+		WindState:   true,
+	}
+
+	fd, err := tello.NewDriver("0").ParseFlightData(encodeFlightData(in))
+	if err != nil {
+		t.Fatalf("フライトデータの解析に失敗: %v", err)
+	}
+
+	if fd.Height != 12 || fd.NorthSpeed != 3 || fd.FlyTime != 45 || fd.BatteryPercentage != 76 {
+		t.Errorf("数値フィールドが一致しない: %+v", fd)
+	}
+	if !fd.Flying || fd.OnGround || !fd.BatteryLow || !fd.WindState {
+		t.Errorf("フラグが一致しない: %+v", fd)
+	}
+}
+
+// TestPacketRoundTrip パケットの組み立てと解析が対になっていることを確認します
+func TestPacketRoundTrip(t *testing.T) {
+	b := buildPacket(0x68, cmdLand, 7, []byte{0x00})
+
+	pkt, err := parsePacket(b)
+	if err != nil {
+		t.Fatalf("パケット解析に失敗: %v", err)
+	}
+	if pkt.cmd != cmdLand || pkt.seq != 7 || !bytes.Equal(pkt.payload, []byte{0x00}) {
+		t.Errorf("解析結果が不正: %+v", pkt)
+	}
+
+	// CRCが壊れたパケットは拒否する
+	b[len(b)-1] ^= 0xff
+	if _, err := parsePacket(b); err == nil {
+		t.Error("CRC不一致のパケットはエラーになるべき")
+	}
+}
+
+// TestParseStick スティックコマンドの軸値を復元できることを確認します
+func TestParseStick(t *testing.T) {
+	// ドライバーと同じ計算で rx=0.5, ly=-0.5 を詰める
+	rx := int64(660.0*0.5 + 1024.0)
+	ry := int64(1024)
+	ly := int64(660.0*-0.5 + 1024.0)
+	lx := int64(1024)
+	packed := rx&0x7FF | (ry&0x7FF)<<11 | (ly&0x7FF)<<22 | (lx&0x7FF)<<33 | 1<<44
+
+	payload := make([]byte, 6)
+	for i := range payload {
+		payload[i] = byte(packed >> (8 * uint(i)))
+	}
+
+	stick, err := parseStick(payload)
+	if err != nil {
+		t.Fatalf("スティック解析に失敗: %v", err)
+	}
+	if stick.RX < 0.49 || stick.RX > 0.51 || stick.LY > -0.49 || stick.LY < -0.51 || !stick.Fast {
+		t.Errorf("軸値が不正: %+v", stick)
+	}
+}
+
+// TestSyntheticStream 合成ストリームがSPS/PPS/IDRで始まることを確認します
+func TestSyntheticStream(t *testing.T) {
+	units := syntheticStream(960, 720, 30, 30)
+	if len(units) != 30 {
+		t.Fatalf("アクセスユニット数が不正: %d", len(units))
+	}
+
+	nals := h264.SplitAnnexB(units[0])
+	if len(nals) != 3 {
+		t.Fatalf("先頭アクセスユニットのNAL数が不正: %d", len(nals))
+	}
+	for i, want := range []byte{7, 8, 5} {
+		if got := nals[i][0] & 0x1f; got != want {
+			t.Errorf("NAL[%d]の種別: 期待 %d, 実際 %d", i, want, got)
+		}
+	}
+
+	sps, err := h264.ParseSPS(nals[0])
+	if err != nil {
+		t.Fatalf("SPSを解析できません: %v", err)
+	}
+	if sps.Width != 960 || sps.Height != 720 || sps.FrameRate() != 30 {
+		t.Errorf("SPSの内容が不正: %v", sps)
+	}
+
+	if got := h264.SplitAnnexB(units[1])[0][0] & 0x1f; got != 1 {
+		t.Errorf("2番目のアクセスユニットは非IDRスライスであるべき: %d", got)
+	}
+}
+
+// TestSimulatorHandshake 生のUDPクライアントで接続・離陸・着陸を確認します
+func TestSimulatorHandshake(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.CommandAddr = "127.0.0.1:0"
+	cfg.TelemetryInterval = 20 * time.Millisecond
+	sim, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Stop()
+
+	video, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer video.Close()
+	videoPort := video.LocalAddr().(*net.UDPAddr).Port
+
+	conn, err := net.DialUDP("udp", nil, sim.Addr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	req := append([]byte(connRequestPrefix), byte(videoPort), byte(videoPort>>8))
+	conn.Write(req)
+
+	buf := make([]byte, 2048)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("接続応答を受信できない: %v", err)
+	}
+	if !bytes.HasPrefix(buf[:n], []byte(connAckPrefix)) {
+		t.Fatalf("接続応答が不正: %q", buf[:n])
+	}
+
+	// フライトデータが届くこと
+	gotFlightData := false
+	for !gotFlightData {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("フライトデータを受信できない: %v", err)
+		}
+		if pkt, err := parsePacket(buf[:n]); err == nil && pkt.cmd == msgFlightData {
+			gotFlightData = true
+		}
+	}
+
+	// ビデオが届くこと
+	video.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := video.ReadFromUDP(buf); err != nil {
+		t.Fatalf("ビデオパケットを受信できない: %v", err)
+	}
+
+	conn.Write(buildPacket(0x68, cmdTakeOff, 1, nil))
+	waitFor(t, func() bool { return sim.State().Flying })
+
+	conn.Write(buildPacket(0x68, cmdLand, 2, []byte{0x00}))
+	waitFor(t, func() bool { return !sim.State().Flying })
+
+	if st := sim.State(); st.TakeOffs != 1 || st.Landings != 1 {
+		t.Errorf("離着陸回数が不正: %+v", st)
+	}
+
+	// 非常停止はテキストコマンドで受け付け、その場でモーターを止める
+	conn.Write(buildPacket(0x68, cmdTakeOff, 3, nil))
+	waitFor(t, func() bool { return sim.State().Flying })
+	conn.Write([]byte(emergencyCommand))
+	waitFor(t, func() bool { return !sim.State().Flying })
+	if st := sim.State(); st.Emergencies != 1 || st.Height != 0 {
+		t.Errorf("非常停止の状態が不正: %+v", st)
+	}
+}
+
+// waitFor は条件が満たされるまで最大2秒待機します
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("条件が満たされずタイムアウトしました")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
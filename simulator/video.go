@@ -0,0 +1,241 @@
+package simulator
+
+import (
+	"errors"
+	"os"
+
+	"GobotProject/h264"
+)
+
+// Telloのビデオパケットの最大ペイロード長
+const videoChunkSize = 1460
+
+// annexBStartCode はAnnex-Bのスタートコード
+var annexBStartCode = []byte{0x00, 0x00, 0x00, 0x01}
+
+// bitWriter は指数ゴロム符号を含むビット列を書き込む
+type bitWriter struct {
+	buf   []byte
+	nbits uint
+}
+
+// writeBits は値の下位nビットを書き込む
+func (w *bitWriter) writeBits(v uint64, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		if w.nbits%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 == 1 {
+			w.buf[len(w.buf)-1] |= 0x80 >> (w.nbits % 8)
+		}
+		w.nbits++
+	}
+}
+
+// writeUE は符号なし指数ゴロム符号 ue(v) を書き込む
+func (w *bitWriter) writeUE(v uint64) {
+	v++
+	n := uint(0)
+	for x := v; x > 1; x >>= 1 {
+		n++
+	}
+	w.writeBits(0, n)
+	w.writeBits(v, n+1)
+}
+
+// writeSE は符号付き指数ゴロム符号 se(v) を書き込む
+func (w *bitWriter) writeSE(v int64) {
+	if v > 0 {
+		w.writeUE(uint64(2*v - 1))
+	} else {
+		w.writeUE(uint64(-2 * v))
+	}
+}
+
+// trailingBits はrbsp_trailing_bitsを書き込んでバイト境界に揃える
+func (w *bitWriter) trailingBits() []byte {
+	w.writeBits(1, 1)
+	for w.nbits%8 != 0 {
+		w.writeBits(0, 1)
+	}
+	return w.buf
+}
+
+// escapeRBSP はエミュレーション防止バイト(0x03)を挿入する
+func escapeRBSP(rbsp []byte) []byte {
+	out := make([]byte, 0, len(rbsp)+len(rbsp)/64)
+	zeros := 0
+	for _, b := range rbsp {
+		if zeros >= 2 && b <= 0x03 {
+			out = append(out, 0x03)
+			zeros = 0
+		}
+		out = append(out, b)
+		if b == 0x00 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
+
+// syntheticSPS は指定解像度・フレームレートのBaseline Profile SPSを生成する
+func syntheticSPS(width, height, fps int) []byte {
+	w := &bitWriter{}
+	w.writeBits(66, 8) // profile_idc (Baseline)
+	w.writeBits(0xc0, 8)
+	w.writeBits(40, 8) // level_idc 4.0
+	w.writeUE(0)       // seq_parameter_set_id
+	w.writeUE(0)       // log2_max_frame_num_minus4
+	w.writeUE(2)       // pic_order_cnt_type
+	w.writeUE(1)       // max_num_ref_frames
+	w.writeBits(0, 1)  // gaps_in_frame_num_value_allowed_flag
+	w.writeUE(uint64((width+15)/16 - 1))
+	w.writeUE(uint64((height+15)/16 - 1))
+	w.writeBits(1, 1) // frame_mbs_only_flag
+	w.writeBits(1, 1) // direct_8x8_inference_flag
+	w.writeBits(0, 1) // frame_cropping_flag
+	w.writeBits(1, 1) // vui_parameters_present_flag
+	w.writeBits(0, 1) // aspect_ratio_info_present_flag
+	w.writeBits(0, 1) // overscan_info_present_flag
+	w.writeBits(0, 1) // video_signal_type_present_flag
+	w.writeBits(0, 1) // chroma_loc_info_present_flag
+	w.writeBits(1, 1) // timing_info_present_flag
+	w.writeBits(1, 32)
+	w.writeBits(uint64(fps*2), 32)
+	w.writeBits(1, 1) // fixed_frame_rate_flag
+	w.writeBits(0, 1) // nal_hrd_parameters_present_flag
+	w.writeBits(0, 1) // vcl_hrd_parameters_present_flag
+	w.writeBits(0, 1) // pic_struct_present_flag
+	w.writeBits(0, 1) // bitstream_restriction_flag
+
+	return append([]byte{0x67}, escapeRBSP(w.trailingBits())...)
+}
+
+// syntheticPPS は最小構成のPPSを生成する
+func syntheticPPS() []byte {
+	w := &bitWriter{}
+	w.writeUE(0)      // pic_parameter_set_id
+	w.writeUE(0)      // seq_parameter_set_id
+	w.writeBits(0, 1) // entropy_coding_mode_flag
+	w.writeBits(0, 1) // bottom_field_pic_order_in_frame_present_flag
+	w.writeUE(0)      // num_slice_groups_minus1
+	w.writeUE(0)      // num_ref_idx_l0_default_active_minus1
+	w.writeUE(0)      // num_ref_idx_l1_default_active_minus1
+	w.writeBits(0, 1) // weighted_pred_flag
+	w.writeBits(0, 2) // weighted_bipred_idc
+	w.writeSE(0)      // pic_init_qp_minus26
+	w.writeSE(0)      // pic_init_qs_minus26
+	w.writeSE(0)      // chroma_qp_index_offset
+	w.writeBits(1, 1) // deblocking_filter_control_present_flag
+	w.writeBits(0, 1) // constrained_intra_pred_flag
+	w.writeBits(0, 1) // redundant_pic_cnt_present_flag
+
+	return append([]byte{0x68}, escapeRBSP(w.trailingBits())...)
+}
+
+// syntheticSlice はデコードはできないが構造上は正しいスライスNALを生成する
+func syntheticSlice(idr bool, frameNum int, size int) []byte {
+	w := &bitWriter{}
+	w.writeUE(0) // first_mb_in_slice
+	if idr {
+		w.writeUE(7) // slice_type (I)
+	} else {
+		w.writeUE(5) // slice_type (P)
+	}
+	w.writeUE(0) // pic_parameter_set_id
+	w.writeBits(uint64(frameNum%16), 4)
+	header := w.trailingBits()
+
+	nal := []byte{0x41}
+	if idr {
+		nal[0] = 0x65
+	}
+	nal = append(nal, header...)
+
+	// スタートコードを含まないように0以外のバイトで埋める
+	for i := len(nal); i < size; i++ {
+		nal = append(nal, byte(0x80|(i+frameNum)&0x7f))
+	}
+	return nal
+}
+
+// syntheticStream は1GOP分のアクセスユニット（Annex-B形式）を生成する
+func syntheticStream(width, height, fps, gop int) [][]byte {
+	sps := syntheticSPS(width, height, fps)
+	pps := syntheticPPS()
+
+	units := make([][]byte, 0, gop)
+	for i := 0; i < gop; i++ {
+		var au []byte
+		if i == 0 {
+			au = appendNAL(au, sps)
+			au = appendNAL(au, pps)
+			au = appendNAL(au, syntheticSlice(true, i, 4000))
+		} else {
+			au = appendNAL(au, syntheticSlice(false, i, 800))
+		}
+		units = append(units, au)
+	}
+	return units
+}
+
+// appendNAL はスタートコード付きでNALユニットを追加する
+func appendNAL(dst, nal []byte) []byte {
+	dst = append(dst, annexBStartCode...)
+	return append(dst, nal...)
+}
+
+// loadAccessUnits はH.264ファイルを読み込み、スライス単位のアクセスユニットに分割する
+// SPS/PPS/SEIなどの非VCL NALは直後のスライスと同じアクセスユニットにまとめる
+func loadAccessUnits(filename string) ([][]byte, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var units [][]byte
+	var pending []byte
+	for _, nal := range h264.SplitAnnexB(data) {
+		if len(nal) == 0 {
+			continue
+		}
+		pending = appendNAL(pending, nal)
+
+		if h264.TypeOf(nal).IsSlice() {
+			units = append(units, pending)
+			pending = nil
+		}
+	}
+
+	if len(units) == 0 {
+		return nil, errors.New("H.264ファイルにスライスが含まれていません: " + filename)
+	}
+	return units, nil
+}
+
+// chunkAccessUnit はアクセスユニットをTelloと同じ2バイトヘッダー付きUDPパケットに分割する
+func chunkAccessUnit(seq byte, au []byte) [][]byte {
+	var chunks [][]byte
+	sub := byte(0)
+	for len(au) > 0 {
+		n := len(au)
+		if n > videoChunkSize {
+			n = videoChunkSize
+		}
+		chunk := make([]byte, 0, n+2)
+		chunk = append(chunk, seq, sub)
+		chunk = append(chunk, au[:n]...)
+		chunks = append(chunks, chunk)
+		au = au[n:]
+		sub++
+	}
+	return chunks
+}
+
+// SyntheticStream はテスト用に、指定解像度・フレームレートで1GOP分のアクセスユニット（Annex-B形式）を生成する
+// 最初のアクセスユニットはSPS・PPS・IDRスライス、残りは非IDRスライス
+func SyntheticStream(width, height, fps, gop int) [][]byte {
+	return syntheticStream(width, height, fps, gop)
+}
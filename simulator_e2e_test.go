@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"GobotProject/simulator"
+
+	"github.com/nsf/termbox-go"
+	"gobot.io/x/gobot/platforms/dji/tello"
+)
+
+// TestSimulatorEndToEnd シミュレーターに対して KeyboardHandler → DroneController → CameraViewer を通しで動かします
+func TestSimulatorEndToEnd(t *testing.T) {
+	sim, err := simulator.New(simulator.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.Start(); err != nil {
+		t.Skipf("シミュレーターのポートを確保できないためスキップ: %v", err)
+	}
+	// tello.Driverは停止できない送信ループを持つため、シミュレーターはテストプロセス終了まで動かしておく
+
+	driver := tello.NewDriverWithIP("127.0.0.1", "0")
+	if err := driver.Start(); err != nil {
+		t.Fatalf("ドライバーの開始に失敗: %v", err)
+	}
+
+	droneController := NewDroneControllerWithDrone(driver)
+	cameraViewer := NewCameraViewer(driver)
+	keyboardHandler := NewKeyboardHandler(droneController, cameraViewer)
+
+	droneController.SetAddress("127.0.0.1:8889")
+	if err := waitForConnection(droneController, 3*time.Second); err != nil {
+		t.Fatalf("接続確認に失敗: %v", err)
+	}
+
+	cameraViewer.Start()
+	defer cameraViewer.Stop()
+	waitUntil(t, "ビデオ受信", func() bool { return cameraViewer.FrameCount() > 0 })
+
+	keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEsc})
+	waitUntil(t, "離陸", func() bool { return sim.State().Flying })
+
+	keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEsc})
+	waitUntil(t, "着陸", func() bool { return !sim.State().Flying })
+	waitUntil(t, "地上の報告", func() bool { return droneController.FlightState() == StateGrounded })
+
+	// 非常停止はキーを2回押すとシミュレーターに届く
+	keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEsc})
+	waitUntil(t, "再離陸", func() bool { return sim.State().Flying })
+	keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Ch: 'x'})
+	keyboardHandler.processKey(termbox.Event{Type: termbox.EventKey, Ch: 'x'})
+	waitUntil(t, "非常停止", func() bool { return sim.State().Emergencies == 1 && !sim.State().Flying })
+	// モーターの停止はシミュレーターのフライトデータで確認する
+	waitUntil(t, "非常停止の確認", droneController.EmergencyStopped)
+}
+
+// waitUntil は条件が満たされるまで最大3秒待機します
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s を待機中にタイムアウトしました", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
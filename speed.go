@@ -0,0 +1,102 @@
+package main
+
+// 速度レベルの範囲（ドライバーに渡す 0〜100 の値）
+const (
+	minSpeed     = 10
+	maxSpeed     = 100
+	speedStep    = 10
+	defaultSpeed = 20
+)
+
+// Speed は現在の速度レベルを返す
+func (dc *DroneController) Speed() int {
+	dc.sticks.mu.Lock()
+	defer dc.sticks.mu.Unlock()
+	return dc.sticks.speed
+}
+
+// SetSpeed は速度レベルを設定する（範囲外の値は丸める）
+// 動いている軸は新しい速度ですぐに送り直す
+func (dc *DroneController) SetSpeed(speed int) {
+	if speed < minSpeed {
+		speed = minSpeed
+	}
+	if speed > maxSpeed {
+		speed = maxSpeed
+	}
+
+	dc.sticks.mu.Lock()
+	changed := dc.sticks.speed != speed
+	dc.sticks.speed = speed
+	for axis := stickAxis(0); axis < numAxes && changed; axis++ {
+		switch {
+		case dc.sticks.value[axis] > 0:
+			dc.sticks.value[axis] = speed
+		case dc.sticks.value[axis] < 0:
+			dc.sticks.value[axis] = -speed
+		default:
+			continue
+		}
+		dc.sendAxis(axis, dc.sticks.value[axis])
+	}
+	dc.sticks.mu.Unlock()
+
+	if changed {
+		dc.notify("速度レベル: %d", speed)
+		dc.settingsChanged()
+	}
+}
+
+// IncreaseSpeed は速度レベルを1段階上げる
+func (dc *DroneController) IncreaseSpeed() {
+	dc.SetSpeed(dc.Speed() + speedStep)
+}
+
+// DecreaseSpeed は速度レベルを1段階下げる
+func (dc *DroneController) DecreaseSpeed() {
+	dc.SetSpeed(dc.Speed() - speedStep)
+}
+
+// IsFastMode は高速モードかどうかを返す
+func (dc *DroneController) IsFastMode() bool {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return dc.fastMode
+}
+
+// SetFastMode はドライバーの高速/低速モードを切り替える
+func (dc *DroneController) SetFastMode(fast bool) {
+	dc.mu.Lock()
+	changed := dc.fastMode != fast
+	dc.fastMode = fast
+	dc.mu.Unlock()
+
+	if fast {
+		dc.notify("高速モード")
+		dc.drone.SetFastMode()
+	} else {
+		dc.notify("低速モード")
+		dc.drone.SetSlowMode()
+	}
+	if changed {
+		dc.settingsChanged()
+	}
+}
+
+// ToggleFastMode は高速モードと低速モードを切り替える
+func (dc *DroneController) ToggleFastMode() {
+	dc.SetFastMode(!dc.IsFastMode())
+}
+
+// SetSettingsChangedCallback は速度レベルやモードが変わったときのコールバックを設定
+// （設定ファイルへの保存に使用）
+func (dc *DroneController) SetSettingsChangedCallback(callback func(speed int, fastMode bool)) {
+	dc.onSettingsChanged = callback
+}
+
+// settingsChanged は設定変更のコールバックを呼び出す
+func (dc *DroneController) settingsChanged() {
+	if dc.onSettingsChanged != nil {
+		dc.onSettingsChanged(dc.Speed(), dc.IsFastMode())
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultHoldTimeout はキー入力が途絶えてから軸を止めるまでの時間
+// 端末のキーリピートは最初の繰り返しまで約500ms空くため、それより長くする
+const defaultHoldTimeout = 600 * time.Millisecond
+
+// stickDecayInterval は軸の停止を確認する間隔
+const stickDecayInterval = 50 * time.Millisecond
+
+// stickAxis はスティックの軸
+type stickAxis int
+
+const (
+	axisPitch    stickAxis = iota // 前後（正: 前進）
+	axisRoll                      // 左右（正: 右）
+	axisThrottle                  // 上下（正: 上昇）
+	axisYaw                       // 旋回（正: 時計回り）
+	numAxes
+)
+
+// stickState はキー入力から推定したスティックの状態
+// 端末はキーを離したことを通知しないため、同じキーの繰り返し入力を「押し続けている」とみなす
+type stickState struct {
+	mu        sync.Mutex
+	value     [numAxes]int
+	lastInput [numAxes]time.Time
+	timeout   time.Duration
+	speed     int // 移動・旋回の速度レベル（10〜100）
+
+	// 停止確認ループ
+	running bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// SetHoldTimeout はキー入力が途絶えてから軸を止めるまでの時間を設定
+func (dc *DroneController) SetHoldTimeout(timeout time.Duration) {
+	dc.sticks.mu.Lock()
+	defer dc.sticks.mu.Unlock()
+
+	if timeout > 0 {
+		dc.sticks.timeout = timeout
+	}
+}
+
+// move は軸を指定した向き（+1/-1）に現在の速度レベルで動かす
+// 同じ向きの繰り返し入力は押し続けとみなし、コマンドを再送せずに時刻だけ更新する
+// 飛行状態が移動を受け付けない（地上・着陸中など）ときは何もしない
+func (dc *DroneController) move(axis stickAxis, direction int, label string) {
+	if !dc.canApply(EventMove) {
+		return
+	}
+	if dc.isForcedLanding() {
+		dc.notify("自動着陸中のため%sできません", label)
+		return
+	}
+
+	dc.sticks.mu.Lock()
+	defer dc.sticks.mu.Unlock()
+
+	speed, reason := dc.limitMove(axis, direction, dc.sticks.speed)
+	if reason != "" {
+		dc.rejectMove(reason)
+		return
+	}
+	value := direction * speed
+	held := dc.sticks.value[axis] == value
+	dc.sticks.value[axis] = value
+	dc.sticks.lastInput[axis] = dc.now()
+	dc.apply(EventMove)
+	if held {
+		return
+	}
+
+	dc.notify("%s", label)
+	dc.sendAxis(axis, value)
+}
+
+// sendAxis は1つの軸の速度をドローンへ送る（0で停止）
+func (dc *DroneController) sendAxis(axis stickAxis, value int) {
+	switch axis {
+	case axisPitch:
+		if value >= 0 {
+			dc.drone.Forward(value)
+		} else {
+			dc.drone.Backward(-value)
+		}
+	case axisRoll:
+		if value >= 0 {
+			dc.drone.Right(value)
+		} else {
+			dc.drone.Left(-value)
+		}
+	case axisThrottle:
+		if value >= 0 {
+			dc.drone.Up(value)
+		} else {
+			dc.drone.Down(-value)
+		}
+	case axisYaw:
+		if value >= 0 {
+			dc.drone.Clockwise(value)
+		} else {
+			dc.drone.CounterClockwise(-value)
+		}
+	}
+}
+
+// tick は入力が途絶えた軸を停止し、すべての軸が止まったらホバリングさせる
+func (dc *DroneController) tick(now time.Time) {
+	dc.sticks.mu.Lock()
+	defer dc.sticks.mu.Unlock()
+
+	var stopped []stickAxis
+	active := 0
+	for axis := stickAxis(0); axis < numAxes; axis++ {
+		if dc.sticks.value[axis] == 0 {
+			continue
+		}
+		if now.Sub(dc.sticks.lastInput[axis]) >= dc.sticks.timeout {
+			dc.sticks.value[axis] = 0
+			stopped = append(stopped, axis)
+		} else {
+			active++
+		}
+	}
+	if len(stopped) == 0 {
+		return
+	}
+
+	if active == 0 {
+		dc.notify("ホバリング")
+		dc.drone.Hover()
+		dc.apply(EventHover)
+		return
+	}
+	for _, axis := range stopped {
+		dc.sendAxis(axis, 0)
+	}
+}
+
+// resetSticks はすべての軸を停止する（動いている軸があればホバリングさせる）
+// 移動中ならホバリングの状態に戻す
+func (dc *DroneController) resetSticks() {
+	dc.sticks.mu.Lock()
+	defer dc.sticks.mu.Unlock()
+
+	moving := false
+	for axis := stickAxis(0); axis < numAxes; axis++ {
+		if dc.sticks.value[axis] != 0 {
+			moving = true
+		}
+		dc.sticks.value[axis] = 0
+	}
+	if moving {
+		dc.drone.Hover()
+	}
+	dc.apply(EventHover)
+}
+
+// StartStickDecay は入力が途絶えた軸を自動で止めるループを開始する
+func (dc *DroneController) StartStickDecay() {
+	dc.sticks.mu.Lock()
+	defer dc.sticks.mu.Unlock()
+
+	if dc.sticks.running {
+		return
+	}
+	dc.sticks.running = true
+	dc.sticks.stop = make(chan struct{})
+	dc.sticks.done = make(chan struct{})
+
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(stickDecayInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				dc.tick(dc.now())
+			}
+		}
+	}(dc.sticks.stop, dc.sticks.done)
+}
+
+// StopStickDecay は自動停止ループを停止する（複数回呼んでも安全）
+func (dc *DroneController) StopStickDecay() {
+	dc.sticks.mu.Lock()
+	if !dc.sticks.running {
+		dc.sticks.mu.Unlock()
+		return
+	}
+	dc.sticks.running = false
+	close(dc.sticks.stop)
+	done := dc.sticks.done
+	dc.sticks.mu.Unlock()
+
+	<-done
+}
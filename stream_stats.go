@@ -0,0 +1,169 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"GobotProject/h264"
+)
+
+// 映像の状態を監視する設定
+const (
+	streamStatsWindow     = 2 * time.Second        // フレームレート・ビットレート・ジッターを求める直近の時間
+	streamGapNotify       = 500 * time.Millisecond // この長さ以上途切れたらイベントログに通知する
+	streamKeyframeTimeout = 5 * time.Second        // キーフレームがこれより来なければ異常とみなす
+)
+
+// StreamStats は受信している映像ストリームの状態
+type StreamStats struct {
+	FrameRate float64       // 直近のフレームレート（フレーム/秒）
+	Bitrate   float64       // 直近のビットレート（ビット/秒）
+	Jitter    time.Duration // 直近のフレーム間隔のばらつき（標準偏差）
+
+	Frames    int // 受信したフレーム数
+	Keyframes int // 受信したキーフレーム数
+	Gaps      GapStats
+	NALCounts map[h264.NALType]int // NALタイプごとの受信数
+
+	// デコードエラーの兆候
+	CorruptNALs int  // 禁止ビットが立っている、または未定義タイプのNALユニット
+	Damaged     bool // 最後のキーフレームの後に欠落があり、次のキーフレームまで映像が乱れる
+
+	SinceFrame    time.Duration // 最後のフレームからの時間（まだ受信していなければ0）
+	SinceKeyframe time.Duration // 最後のキーフレームからの時間（まだ受信していなければ0）
+}
+
+// Healthy は映像が正常に届いているかどうかを返す
+func (s StreamStats) Healthy() bool {
+	return s.Frames > 0 && !s.Damaged && s.SinceFrame < streamGapNotify && s.SinceKeyframe < streamKeyframeTimeout
+}
+
+// streamArrival はフレームの受信時刻と大きさ
+type streamArrival struct {
+	at    time.Time
+	bytes int
+}
+
+// streamMonitor は受信したフレームから映像ストリームの状態を求める
+type streamMonitor struct {
+	recent       []streamArrival // 直近streamStatsWindow分のフレーム
+	first        time.Time       // 最初のフレームの受信時刻
+	timing       frameTiming     // フレーム間隔と欠落
+	frames       int
+	keyframes    int
+	nals         map[h264.NALType]int
+	corrupt      int
+	damaged      bool
+	lastFrame    time.Time
+	lastKeyframe time.Time
+}
+
+// add は受信したフレームを記録し、欠落していた時間を返す（欠落がなければ0）
+func (m *streamMonitor) add(au h264.AccessUnit, nominal uint32) time.Duration {
+	if m.nals == nil {
+		m.nals = make(map[h264.NALType]int)
+	}
+	size := 0
+	for _, nal := range au.NALs {
+		size += len(nal)
+		m.nals[h264.TypeOf(nal)]++
+		if !validNALHeader(nal[0]) {
+			m.corrupt++
+		}
+	}
+
+	gapsBefore := m.timing.gaps.Count
+	delta := m.timing.stamp(au.Time, nominal)
+	var gap time.Duration
+	if m.timing.gaps.Count > gapsBefore {
+		gap = ticksToDuration(uint64(delta))
+		m.damaged = true
+	}
+
+	if m.first.IsZero() {
+		m.first = au.Time
+	}
+	m.frames++
+	m.lastFrame = au.Time
+	if au.Keyframe {
+		m.keyframes++
+		m.lastKeyframe = au.Time
+		m.damaged = false
+	}
+
+	m.recent = append(m.recent, streamArrival{at: au.Time, bytes: size})
+	m.trim(au.Time)
+	return gap
+}
+
+// trim は直近streamStatsWindowより古いフレームを捨てる
+func (m *streamMonitor) trim(now time.Time) {
+	n := 0
+	for n < len(m.recent) && now.Sub(m.recent[n].at) > streamStatsWindow {
+		n++
+	}
+	m.recent = m.recent[n:]
+}
+
+// stats は現在の状態を返す
+func (m *streamMonitor) stats(now time.Time) StreamStats {
+	stats := StreamStats{
+		Frames:      m.frames,
+		Keyframes:   m.keyframes,
+		Gaps:        m.timing.gaps,
+		NALCounts:   make(map[h264.NALType]int, len(m.nals)),
+		CorruptNALs: m.corrupt,
+		Damaged:     m.damaged,
+	}
+	for t, n := range m.nals {
+		stats.NALCounts[t] = n
+	}
+	if m.frames == 0 {
+		return stats
+	}
+	stats.SinceFrame = now.Sub(m.lastFrame)
+	if !m.lastKeyframe.IsZero() {
+		stats.SinceKeyframe = now.Sub(m.lastKeyframe)
+	} else {
+		stats.SinceKeyframe = now.Sub(m.first)
+	}
+
+	var bytes, count int
+	var intervals []float64
+	var previous time.Time
+	for _, arrival := range m.recent {
+		if now.Sub(arrival.at) > streamStatsWindow {
+			continue
+		}
+		if count > 0 {
+			intervals = append(intervals, arrival.at.Sub(previous).Seconds())
+		}
+		previous = arrival.at
+		bytes += arrival.bytes
+		count++
+	}
+	// 受信を始めたばかりなら、その時間で割る
+	if window := min(streamStatsWindow, now.Sub(m.first)); window > 0 {
+		stats.FrameRate = float64(count) / window.Seconds()
+		stats.Bitrate = float64(bytes*8) / window.Seconds()
+	}
+	stats.Jitter = time.Duration(standardDeviation(intervals) * float64(time.Second))
+	return stats
+}
+
+// standardDeviation は値の標準偏差を返す（2個未満なら0）
+func standardDeviation(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(variance / float64(len(values)))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"GobotProject/h264"
+)
+
+// TestStreamMonitor フレームレート・ビットレート・欠落・NAL数などの統計をテストします
+func TestStreamMonitor(t *testing.T) {
+	const nominal = videoTimescale / 30
+	var monitor streamMonitor
+	start := time.Unix(1000, 0)
+
+	frame := func(i int, keyframe bool) h264.AccessUnit {
+		nals := [][]byte{make([]byte, 1000)}
+		nals[0][0] = 0x41
+		if keyframe {
+			nals = [][]byte{{0x67, 0x42}, {0x68, 0xce}, make([]byte, 996)}
+			nals[2][0] = 0x65
+		}
+		return h264.AccessUnit{NALs: nals, Keyframe: keyframe, Time: start.Add(time.Duration(i) * time.Second / 30)}
+	}
+
+	if stats := monitor.stats(start); stats.Frames != 0 || stats.FrameRate != 0 || stats.Healthy() {
+		t.Errorf("受信前: %+v", stats)
+	}
+
+	// 3秒分の30fps（1秒ごとにキーフレーム）
+	for i := 0; i < 90; i++ {
+		monitor.add(frame(i, i%30 == 0), nominal)
+	}
+	now := start.Add(89 * time.Second / 30)
+	stats := monitor.stats(now)
+	if math.Abs(stats.FrameRate-30) > 1 {
+		t.Errorf("フレームレート: %.2f", stats.FrameRate)
+	}
+	if math.Abs(stats.Bitrate-240000) > 10000 {
+		t.Errorf("ビットレート: %.0f", stats.Bitrate)
+	}
+	if stats.Jitter > time.Millisecond {
+		t.Errorf("一定間隔なのにジッターがあります: %v", stats.Jitter)
+	}
+	if stats.Frames != 90 || stats.Keyframes != 3 || stats.NALCounts[h264.NALIDR] != 3 || stats.NALCounts[h264.NALSlice] != 87 || stats.NALCounts[h264.NALSPS] != 3 {
+		t.Errorf("フレーム数・NAL数: %+v", stats)
+	}
+	if stats.SinceKeyframe != 29*time.Second/30 || !stats.Healthy() {
+		t.Errorf("キーフレームからの時間: %v, 正常 %v", stats.SinceKeyframe, stats.Healthy())
+	}
+
+	// 1秒途切れた後のPフレームは乱れている
+	if gap := monitor.add(frame(120, false), nominal); gap < time.Second {
+		t.Errorf("欠落した時間: %v", gap)
+	}
+	stats = monitor.stats(start.Add(4 * time.Second))
+	if !stats.Damaged || stats.Gaps.Count != 1 || stats.Gaps.Dropped != 30 || stats.Healthy() {
+		t.Errorf("欠落後: %+v", stats)
+	}
+	if stats.Jitter < 100*time.Millisecond {
+		t.Errorf("欠落があればジッターが大きくなるべき: %v", stats.Jitter)
+	}
+	monitor.add(frame(121, true), nominal)
+	if stats := monitor.stats(start.Add(4 * time.Second)); stats.Damaged {
+		t.Error("キーフレームを受信したら乱れは解消する")
+	}
+
+	// 禁止ビットが立ったNALは破損として数える
+	monitor.add(h264.AccessUnit{NALs: [][]byte{{0xc1, 0x00}}, Time: start.Add(5 * time.Second)}, nominal)
+	if stats := monitor.stats(start.Add(5 * time.Second)); stats.CorruptNALs != 1 {
+		t.Errorf("破損NAL: %d", stats.CorruptNALs)
+	}
+
+	// 受信が止まればフレームレートは下がる
+	if stats := monitor.stats(start.Add(10 * time.Second)); stats.FrameRate != 0 || stats.SinceFrame != 5*time.Second || stats.Healthy() {
+		t.Errorf("受信停止後: %+v", stats)
+	}
+}
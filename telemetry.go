@@ -0,0 +1,155 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"gobot.io/x/gobot/platforms/dji/tello"
+)
+
+// TelemetrySnapshot はある時点でドローンが報告した状態
+type TelemetrySnapshot struct {
+	HasFlightData bool // フライトデータを一度でも受信したか
+
+	BatteryPercent int
+	Height         float64       // 高度（m）
+	NorthSpeed     float64       // 北方向速度（m/s）
+	EastSpeed      float64       // 東方向速度（m/s）
+	VerticalSpeed  float64       // 垂直速度（m/s）
+	FlyTime        time.Duration // 飛行時間
+	FlyTimeLeft    time.Duration // 残り飛行可能時間
+
+	WifiStrength  int // Wi-Fi信号強度（0〜100）
+	LightStrength int // 照度
+
+	BatteryLow   bool
+	BatteryLower bool
+	WindState    bool
+	Flying       bool
+	OnGround     bool
+	Hovering     bool
+
+	UpdatedAt time.Time // 最後にいずれかのデータを受信した時刻
+}
+
+// GroundSpeed は水平方向の速さ（m/s）を返す
+func (s TelemetrySnapshot) GroundSpeed() float64 {
+	return math.Hypot(s.NorthSpeed, s.EastSpeed)
+}
+
+// Telemetry はドローンのフライトデータ等を購読し、最新状態をスレッドセーフに保持する
+type Telemetry struct {
+	mu          sync.RWMutex
+	snapshot    TelemetrySnapshot
+	subscribers map[<-chan TelemetrySnapshot]chan TelemetrySnapshot
+	now         func() time.Time
+}
+
+// NewTelemetry は新しいテレメトリーを作成
+func NewTelemetry() *Telemetry {
+	return &Telemetry{
+		subscribers: make(map[<-chan TelemetrySnapshot]chan TelemetrySnapshot),
+		now:         time.Now,
+	}
+}
+
+// Attach はドローンのFlightData/WifiData/LightStrengthイベントを購読する
+func (t *Telemetry) Attach(drone Drone) {
+	drone.On(tello.FlightDataEvent, func(data interface{}) {
+		if fd, ok := data.(*tello.FlightData); ok && fd != nil {
+			t.updateFlightData(fd)
+		}
+	})
+	drone.On(tello.WifiDataEvent, func(data interface{}) {
+		if wd, ok := data.(*tello.WifiData); ok && wd != nil {
+			t.updateWifi(wd)
+		}
+	})
+	drone.On(tello.LightStrengthEvent, func(data interface{}) {
+		if level, ok := data.(int8); ok {
+			t.updateLight(level)
+		}
+	})
+}
+
+// Snapshot は最新状態のコピーを返す
+func (t *Telemetry) Snapshot() TelemetrySnapshot {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.snapshot
+}
+
+// Subscribe は状態が更新されるたびに最新のスナップショットを受け取るチャネルを返す
+// 受信が遅れた場合は古い値を捨て、常に最新の値だけを保持する
+func (t *Telemetry) Subscribe() <-chan TelemetrySnapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ch := make(chan TelemetrySnapshot, 1)
+	t.subscribers[ch] = ch
+	return ch
+}
+
+// Unsubscribe は購読を解除し、チャネルを閉じる
+func (t *Telemetry) Unsubscribe(ch <-chan TelemetrySnapshot) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if sub, ok := t.subscribers[ch]; ok {
+		delete(t.subscribers, ch)
+		close(sub)
+	}
+}
+
+// update はスナップショットを更新して購読者へ通知する
+func (t *Telemetry) update(apply func(s *TelemetrySnapshot)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	apply(&t.snapshot)
+	t.snapshot.UpdatedAt = t.now()
+
+	for _, sub := range t.subscribers {
+		// 未読の古い値があれば捨てて最新の値に置き換える
+		select {
+		case <-sub:
+		default:
+		}
+		sub <- t.snapshot
+	}
+}
+
+// updateFlightData はフライトデータを反映する
+func (t *Telemetry) updateFlightData(fd *tello.FlightData) {
+	t.update(func(s *TelemetrySnapshot) {
+		s.HasFlightData = true
+		s.BatteryPercent = int(fd.BatteryPercentage)
+		s.Height = float64(fd.Height) / 10
+		s.NorthSpeed = float64(fd.NorthSpeed) / 10
+		s.EastSpeed = float64(fd.EastSpeed) / 10
+		s.VerticalSpeed = float64(fd.VerticalSpeed) / 10
+		s.FlyTime = time.Duration(fd.FlyTime) * 100 * time.Millisecond
+		s.FlyTimeLeft = time.Duration(fd.DroneFlyTimeLeft) * 100 * time.Millisecond
+		s.BatteryLow = fd.BatteryLow
+		s.BatteryLower = fd.BatteryLower
+		s.WindState = fd.WindState
+		s.Flying = fd.Flying
+		s.OnGround = fd.OnGround
+		s.Hovering = fd.DroneHover
+	})
+}
+
+// updateWifi はWi-Fiデータを反映する
+func (t *Telemetry) updateWifi(wd *tello.WifiData) {
+	t.update(func(s *TelemetrySnapshot) {
+		s.WifiStrength = int(wd.Strength)
+	})
+}
+
+// updateLight は照度を反映する
+func (t *Telemetry) updateLight(level int8) {
+	t.update(func(s *TelemetrySnapshot) {
+		s.LightStrength = int(level)
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"gobot.io/x/gobot/platforms/dji/tello"
+)
+
+// TestTelemetryFlightData フライトデータがスナップショットに反映されることをテストします
+func TestTelemetryFlightData(t *testing.T) {
+	telemetry := NewTelemetry()
+	telemetry.updateFlightData(&tello.FlightData{
+		BatteryPercentage: 42,
+		Height:            15,
+		NorthSpeed:        30,
+		EastSpeed:         40,
+		FlyTime:           125,
+		Flying:            true,
+		BatteryLow:        true,
+		WindState:         true,
+	})
+
+	s := telemetry.Snapshot()
+	if !s.HasFlightData || s.BatteryPercent != 42 || s.Height != 1.5 {
+		t.Errorf("バッテリー/高度が不正: %+v", s)
+	}
+	if s.GroundSpeed() != 5 {
+		t.Errorf("対地速度: 期待 5, 実際 %v", s.GroundSpeed())
+	}
+	if s.FlyTime != 12500*time.Millisecond {
+		t.Errorf("飛行時間: 期待 12.5s, 実際 %v", s.FlyTime)
+	}
+	if !s.Flying || s.OnGround || !s.BatteryLow || !s.WindState {
+		t.Errorf("フラグが不正: %+v", s)
+	}
+}
+
+// TestTelemetryFromDroneEvents ドローンのイベント経由で更新されることをテストします
+func TestTelemetryFromDroneEvents(t *testing.T) {
+	fake := NewFakeDrone()
+	telemetry := NewTelemetry()
+	telemetry.Attach(fake)
+	updates := telemetry.Subscribe()
+
+	fake.Publish(tello.WifiDataEvent, &tello.WifiData{Strength: 88})
+
+	select {
+	case s := <-updates:
+		if s.WifiStrength != 88 {
+			t.Errorf("Wi-Fi強度: 期待 88, 実際 %d", s.WifiStrength)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("テレメトリーの更新通知が届きません")
+	}
+}
+
+// TestTelemetrySubscribeKeepsLatest 購読者が遅れても最新値だけが残ることをテストします
+func TestTelemetrySubscribeKeepsLatest(t *testing.T) {
+	telemetry := NewTelemetry()
+	updates := telemetry.Subscribe()
+
+	for i := int8(1); i <= 5; i++ {
+		telemetry.updateFlightData(&tello.FlightData{BatteryPercentage: i * 10})
+	}
+
+	if s := <-updates; s.BatteryPercent != 50 {
+		t.Errorf("最新値が期待されます: %d", s.BatteryPercent)
+	}
+
+	telemetry.Unsubscribe(updates)
+	if _, ok := <-updates; ok {
+		t.Error("購読解除後はチャネルが閉じられるべき")
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"unsafe"
+
+	"gobot.io/x/gobot/platforms/dji/tello"
+)
+
+// telloVideoPort はドローンが映像を送ってくるポート（接続要求で伝える）
+const telloVideoPort = 11111
+
+// telloVideoAddress は映像を受信するアドレス
+var telloVideoAddress = fmt.Sprintf(":%d", telloVideoPort)
+
+// connectionRequest はドローンとのセッションを始める接続要求（conn_req:映像ポート）を返す
+func connectionRequest(videoPort int) string {
+	port := make([]byte, 2)
+	binary.LittleEndian.PutUint16(port, uint16(videoPort))
+	return "conn_req:" + string(port)
+}
+
+// TelloDriver はgobotのtelloドライバーに、映像の受信と停止処理、写真撮影（中継を有効にした場合）を補うドライバー
+//
+// gobot v1.16 のドライバーは接続応答（ConnectedEvent）のたびに映像のポートを開き直そうとし、
+// 2回目以降は開けずに受信中の接続を失ってしまう。映像のポートはこちらで先に開いて受信するので、
+// ドライバー側は開けずに何もしない
+type TelloDriver struct {
+	*tello.Driver
+	video *net.UDPConn
+	relay *telloRelay // 写真撮影用の中継（無効ならnil）
+}
+
+// ドローン操作・コマンド送信・写真撮影に対応していることをコンパイル時に確認
+var (
+	_ Drone         = (*TelloDriver)(nil)
+	_ CommandSender = (*TelloDriver)(nil)
+	_ PictureTaker  = (*TelloDriver)(nil)
+
+	_ SessionReconnector = (*TelloDriver)(nil)
+)
+
+// NewTelloDriver は address（ドローンの制御ポート）のドローンと通信するドライバーを作成する
+// photoRelay を指定すると、制御パケットを中継して写真撮影に対応する（ループバックのドローンでは ErrRelayLoopback）
+func NewTelloDriver(address string, photoRelay bool) (*TelloDriver, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if !photoRelay {
+		return newTelloDriver(tello.NewDriverWithIP(host, "8888"), telloVideoAddress, nil)
+	}
+
+	droneAddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	if droneAddr.IP.IsLoopback() {
+		return nil, ErrRelayLoopback
+	}
+	var d *TelloDriver
+	relay, err := newTelloRelay(relayAddress, address, func(packet FilePacket) {
+		d.Publish(PictureDataEvent, packet)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("写真撮影用の中継を開始できません: %w", err)
+	}
+	// ドライバーは中継へ送り、中継がドローンへ転送する
+	d, err = newTelloDriver(tello.NewDriverWithIP("127.0.0.1", "8888"), telloVideoAddress, relay)
+	if err != nil {
+		relay.close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// newTelloDriver は videoAddress で映像を受信するドライバーを作成する（テストでは任意のポートを使う）
+func newTelloDriver(driver *tello.Driver, videoAddress string, relay *telloRelay) (*TelloDriver, error) {
+	addr, err := net.ResolveUDPAddr("udp", videoAddress)
+	if err != nil {
+		return nil, err
+	}
+	video, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("映像の受信ポート %s を開けません: %w", videoAddress, err)
+	}
+	addDoneChannel(driver)
+
+	d := &TelloDriver{Driver: driver, video: video, relay: relay}
+	d.AddEvent(PictureDataEvent)
+	return d, nil
+}
+
+// addDoneChannel は NewDriverWithIP が作らない停止用のチャネルを補う
+// gobot v1.16 の NewDriverWithIP はこれを作らないため、そのままでは Halt が送信できずに戻らない
+func addDoneChannel(driver *tello.Driver) {
+	field := reflect.ValueOf(driver).Elem().FieldByName("doneCh")
+	done := reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem()
+	if done.IsNil() {
+		done.Set(reflect.ValueOf(make(chan struct{}, 1)))
+	}
+}
+
+// Start は映像の受信と中継を開始してから、ドライバーを起動する
+func (d *TelloDriver) Start() error {
+	if d.relay != nil {
+		d.relay.start()
+	}
+	go d.receiveVideo()
+	return d.Driver.Start()
+}
+
+// Halt はドライバーを停止し（着陸コマンドを送ってから制御の接続を閉じる）、映像と中継の接続を閉じる
+func (d *TelloDriver) Halt() error {
+	err := d.Driver.Halt()
+	d.video.Close()
+	if d.relay != nil {
+		d.relay.close()
+	}
+	return err
+}
+
+// receiveVideo はドローンからの映像を受信してVideoFrameEventで通知する（先頭2バイトはTelloのヘッダー）
+func (d *TelloDriver) receiveVideo() {
+	buf := make([]byte, 2048)
+	for {
+		n, err := d.video.Read(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil || n < 2 {
+			continue
+		}
+		d.Publish(tello.VideoFrameEvent, append([]byte(nil), buf[2:n]...))
+	}
+}
+
+// Reconnect はドローンへ接続要求を送り直す
+// 接続応答でドライバーが映像のポートを開き直そうとしても、こちらで受信しているので映像は途切れない
+func (d *TelloDriver) Reconnect() error {
+	return d.SendCommand(connectionRequest(telloVideoPort))
+}
+
+// TakePicture は撮影を指示する（写真はPictureDataEventで届く）
+// 中継を有効にしていなければ、ドライバーが写真の転送を受信できないので ErrPhotoUnsupported を返す
+func (d *TelloDriver) TakePicture() error {
+	if d.relay == nil {
+		return ErrPhotoUnsupported
+	}
+	return d.relay.send(msgTakePicture, packetTypeCommand, nil)
+}
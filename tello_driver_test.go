@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"gobot.io/x/gobot/platforms/dji/tello"
+)
+
+// TestTelloDriverVideoAndHalt 映像をこちらで受信して通知し、停止すると戻って接続を閉じることをテストします
+func TestTelloDriverVideoAndHalt(t *testing.T) {
+	// NewDriverWithIP のドライバーは停止用のチャネルを持たないので、補えていなければ Halt が戻らない
+	// 送信先はテスト中のシミュレーターと重ならないアドレスにする
+	drone, err := newTelloDriver(tello.NewDriverWithIP("127.0.0.2", "0"), "127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := make(chan []byte, 1)
+	drone.On(tello.VideoFrameEvent, func(data interface{}) {
+		frames <- data.([]byte)
+	})
+	if err := drone.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	sender, err := net.DialUDP("udp", nil, drone.video.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+	sender.Write([]byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x67})
+	select {
+	case frame := <-frames:
+		// 先頭2バイトのヘッダーを除いて通知する
+		if !bytes.Equal(frame, []byte{0x00, 0x00, 0x00, 0x01, 0x67}) {
+			t.Errorf("映像データが不正: % x", frame)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("映像が通知されません")
+	}
+
+	if err := drone.TakePicture(); !errors.Is(err, ErrPhotoUnsupported) {
+		t.Errorf("中継なしでは撮影できないはず: %v", err)
+	}
+
+	halted := make(chan error, 1)
+	go func() { halted <- drone.Halt() }()
+	select {
+	case <-halted:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Haltが戻りません")
+	}
+	if _, err := drone.video.Write(nil); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("映像の接続を閉じるべき: %v", err)
+	}
+
+	// 同じPC上のドローン（シミュレーター）には中継を置けない
+	if _, err := NewTelloDriver("127.0.0.1:8889", true); !errors.Is(err, ErrRelayLoopback) {
+		t.Errorf("期待 ErrRelayLoopback, 実際 %v", err)
+	}
+}
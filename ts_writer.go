@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"time"
+
+	"GobotProject/h264"
+)
+
+// MPEG-2 TSの定数
+const (
+	tsPacketSize    = 188
+	tsSyncByte      = 0x47
+	tsPIDPAT        = 0x0000
+	tsPIDPMT        = 0x1000
+	tsPIDVideo      = 0x0100
+	tsProgramNumber = 1
+	tsStreamTypeAVC = 0x1b // H.264
+	tsStreamIDVideo = 0xe0
+
+	// tsPTSDelay はPCRからPTSまでの遅延（デコーダーのバッファ分、100ms）
+	tsPTSDelay = videoTimescale / 10
+)
+
+// tsAUD はTSの映像に必要なアクセスユニットデリミタ（primary_pic_type=7: すべてのスライス）
+var tsAUD = []byte{0, 0, 0, 1, byte(h264.NALAUD), 0xf0}
+
+// TSWriter はH.264映像をMPEG-2 TSファイルに書き込むライター
+// フレームごとにPTS付きのPESを作り、キーフレームの前にPAT/PMTを入れて途中からでも再生できるようにする
+type TSWriter struct {
+	file       *os.File
+	buf        *bufio.Writer
+	startTime  time.Time
+	assembler  h264.Assembler
+	info       *h264.SPS       // 受信時刻が分からないときのフレームの間隔
+	timing     frameTiming     // 受信時刻からフレームの間隔を求める
+	timestamp  uint64          // 最後のフレームのPCR（90kHz）
+	continuity map[uint16]byte // PIDごとの連続性カウンタ
+	frames     int
+	pes        []byte // 再利用するPESのバッファ
+}
+
+// NewTSWriter は新しいTSライターを作成
+func NewTSWriter(filename string) (*TSWriter, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &TSWriter{
+		file:       file,
+		buf:        bufio.NewWriter(file),
+		startTime:  time.Now(),
+		continuity: make(map[uint16]byte),
+	}, nil
+}
+
+// WriteFrame は受信データからフレームを取り出し、PESとして書き込む
+func (w *TSWriter) WriteFrame(data []byte) error {
+	if w.file == nil {
+		return ErrRecordingClosed
+	}
+	for _, au := range w.assembler.Write(data) {
+		if err := w.writeAccessUnit(au); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteAccessUnit は1フレームをPESとして書き込む
+func (w *TSWriter) WriteAccessUnit(au h264.AccessUnit) error {
+	if w.file == nil {
+		return ErrRecordingClosed
+	}
+	return w.writeAccessUnit(au)
+}
+
+// FrameCount は書き込んだフレーム数を返す
+func (w *TSWriter) FrameCount() int {
+	return w.frames
+}
+
+// Close は残りのフレームを書き込み、ファイルを閉じる
+func (w *TSWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+
+	var err error
+	for _, au := range w.assembler.Flush() {
+		if err == nil {
+			err = w.writeAccessUnit(au)
+		}
+	}
+	if flushErr := w.buf.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.file = nil
+	if err == nil {
+		log.Printf("TS録画完了: %d フレーム, 録画時間: %v", w.frames, time.Since(w.startTime))
+		if gaps := w.timing.gaps; gaps.Count > 0 {
+			log.Printf("フレームの欠落: %d 箇所（約 %d フレーム、最長 %v）", gaps.Count, gaps.Dropped, gaps.Longest)
+		}
+	}
+	return err
+}
+
+// writeAccessUnit は1フレームをPESとして書き込む
+func (w *TSWriter) writeAccessUnit(au h264.AccessUnit) error {
+	// NALを含まないフレームは書き込むものがない（MP4と同じく数えない）
+	if len(au.NALs) == 0 {
+		return nil
+	}
+	if w.frames == 0 || au.Keyframe {
+		if err := w.writePSI(); err != nil {
+			return err
+		}
+	}
+	for _, nal := range au.NALs {
+		if w.info == nil && h264.TypeOf(nal) == h264.NALSPS {
+			w.info, _ = h264.ParseSPS(nal)
+		}
+	}
+
+	// PTSは受信時刻に合わせて進める（フレームが欠落したら間隔が空く）
+	delta := w.timing.stamp(au.Time, frameDelta(w.info))
+	if w.frames > 0 {
+		w.timestamp += uint64(delta)
+	}
+	pcr := w.timestamp
+	pts := pcr + tsPTSDelay
+
+	// PESヘッダー（PES_packet_lengthは映像なので0=無制限、PTSのみ）
+	pes := append(w.pes[:0], 0, 0, 1, tsStreamIDVideo, 0, 0, 0x80, 0x80, 5)
+	pes = appendTimestamp(pes, 0x20, pts)
+
+	// H.264のTSでは各アクセスユニットの先頭にAUDが必要
+	if h264.TypeOf(au.NALs[0]) != h264.NALAUD {
+		pes = append(pes, tsAUD...)
+	}
+	for _, nal := range au.NALs {
+		pes = appendAnnexB(pes, nal)
+	}
+	w.pes = pes
+
+	w.frames++
+	return w.writePES(pes, pcr, au.Keyframe)
+}
+
+// writePES はPESをTSパケットに分割して書き込む
+// 最初のパケットのアダプテーションフィールドにPCR（キーフレームならランダムアクセス表示も）を入れる
+func (w *TSWriter) writePES(pes []byte, pcr uint64, keyframe bool) error {
+	first := true
+	for len(pes) > 0 {
+		var adaptation []byte
+		if first {
+			flags := byte(0x10) // PCRあり
+			if keyframe {
+				flags |= 0x40 // random_access_indicator
+			}
+			adaptation = append([]byte{7, flags}, pcrBytes(pcr)...)
+		}
+
+		// 残りがパケットに収まらない分はアダプテーションフィールドを詰め物で伸ばす
+		space := tsPacketSize - 4 - len(adaptation)
+		if len(pes) < space {
+			adaptation = stuffAdaptation(adaptation, space-len(pes))
+			space = len(pes)
+		}
+
+		packet := w.packetHeader(tsPIDVideo, first, adaptation != nil)
+		packet = append(packet, adaptation...)
+		packet = append(packet, pes[:space]...)
+		if _, err := w.buf.Write(packet); err != nil {
+			return err
+		}
+		pes = pes[space:]
+		first = false
+	}
+	return nil
+}
+
+// writePSI はPATとPMTを書き込む
+func (w *TSWriter) writePSI() error {
+	pat := []byte{
+		0x00,       // table_id: PAT
+		0xb0, 0x0d, // section_syntax_indicator, section_length=13
+		0x00, 0x01, // transport_stream_id
+		0xc1,       // version 0, current_next_indicator
+		0x00, 0x00, // section_number, last_section_number
+		0x00, tsProgramNumber,
+		0xe0 | tsPIDPMT>>8, tsPIDPMT & 0xff,
+	}
+	pmt := []byte{
+		0x02,       // table_id: PMT
+		0xb0, 0x12, // section_syntax_indicator, section_length=18
+		0x00, tsProgramNumber,
+		0xc1,
+		0x00, 0x00,
+		0xe0 | tsPIDVideo>>8, tsPIDVideo & 0xff, // PCR_PID
+		0xf0, 0x00, // program_info_length=0
+		tsStreamTypeAVC, 0xe0 | tsPIDVideo>>8, tsPIDVideo & 0xff,
+		0xf0, 0x00, // ES_info_length=0
+	}
+
+	for _, section := range []struct {
+		pid  uint16
+		data []byte
+	}{{tsPIDPAT, pat}, {tsPIDPMT, pmt}} {
+		packet := w.packetHeader(section.pid, true, false)
+		packet = append(packet, 0) // pointer_field
+		packet = append(packet, section.data...)
+		packet = append(packet, u32(crc32MPEG2(section.data))...)
+		for len(packet) < tsPacketSize {
+			packet = append(packet, 0xff)
+		}
+		if _, err := w.buf.Write(packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// packetHeader はTSパケットのヘッダー（4バイト）を作成し、連続性カウンタを進める
+func (w *TSWriter) packetHeader(pid uint16, unitStart, adaptation bool) []byte {
+	header := make([]byte, 4, tsPacketSize)
+	header[0] = tsSyncByte
+	header[1] = byte(pid >> 8 & 0x1f)
+	if unitStart {
+		header[1] |= 0x40
+	}
+	header[2] = byte(pid)
+	header[3] = 0x10 | w.continuity[pid] // ペイロードあり
+	if adaptation {
+		header[3] |= 0x20
+	}
+	w.continuity[pid] = (w.continuity[pid] + 1) & 0x0f
+	return header
+}
+
+// stuffAdaptation はアダプテーションフィールドをn バイト伸ばす（なければ作る）
+func stuffAdaptation(adaptation []byte, n int) []byte {
+	if adaptation == nil {
+		if n == 1 {
+			return []byte{0} // 長さ0のアダプテーションフィールド
+		}
+		adaptation = []byte{0, 0x00} // フラグなし
+		n -= 2
+	}
+	for i := 0; i < n; i++ {
+		adaptation = append(adaptation, 0xff)
+	}
+	adaptation[0] = byte(len(adaptation) - 1)
+	return adaptation
+}
+
+// pcrBytes はPCR（90kHzのベース部分のみ、拡張部は0）を6バイトにする
+func pcrBytes(base uint64) []byte {
+	return []byte{
+		byte(base >> 25), byte(base >> 17), byte(base >> 9), byte(base >> 1),
+		byte(base&1)<<7 | 0x7e, 0,
+	}
+}
+
+// appendTimestamp はPESヘッダーのPTS/DTS（33ビット、マーカービット付き5バイト）を追加する
+func appendTimestamp(b []byte, prefix byte, ts uint64) []byte {
+	return append(b,
+		prefix|byte(ts>>29)&0x0e|1,
+		byte(ts>>22),
+		byte(ts>>14)&0xfe|1,
+		byte(ts>>7),
+		byte(ts<<1)&0xfe|1,
+	)
+}
+
+// crc32MPEG2 はPSIセクションのCRC（CRC-32/MPEG-2）を計算する
+func crc32MPEG2(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}